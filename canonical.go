@@ -0,0 +1,132 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnscodec
+
+import (
+	"bytes"
+	"cmp"
+	"slices"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// CanonicalAnswerBytes returns a deterministic serialization of the valid RRs.
+//
+// Each RR is serialized in the canonical form defined by RFC4034 section 6.2,
+// i.e., without name compression and with the owner name and the names in
+// the RDATA of the types listed by RFC4034 section 6.2 converted to lowercase,
+// except that the TTL is always zero, since it varies across otherwise
+// equivalent responses. The RRs are sorted by owner name using the canonical
+// ordering defined by RFC4034 section 6.1, then by type, then by class, and
+// then by RDATA, and concatenated.
+//
+// Therefore, responses containing the same valid RRs produce the same bytes
+// regardless of the order of the RRs, their TTLs, and the case of names,
+// which makes the returned bytes suitable as a cache key.
+func (r *Response) CanonicalAnswerBytes() ([]byte, error) {
+	type entry struct {
+		labels []string
+		header *dns.RR_Header
+		rdata  []byte
+		wire   []byte
+	}
+	entries := make([]entry, 0, len(r.ValidRRs))
+	for _, rr := range r.ValidRRs {
+		rr = canonicalRR(rr)
+		wire := make([]byte, dns.Len(rr))
+		off, err := dns.PackRR(rr, wire, 0, nil, false)
+		if err != nil {
+			return nil, err
+		}
+		// Note: PackRR sets the RDLENGTH, and the RDATA ends the RR
+		wire = wire[:off]
+		entries = append(entries, entry{
+			labels: dns.SplitDomainName(rr.Header().Name),
+			header: rr.Header(),
+			rdata:  wire[off-int(rr.Header().Rdlength):],
+			wire:   wire,
+		})
+	}
+	slices.SortFunc(entries, func(a, b entry) int {
+		return cmp.Or(
+			canonicalCompareLabels(a.labels, b.labels),
+			cmp.Compare(a.header.Rrtype, b.header.Rrtype),
+			cmp.Compare(a.header.Class, b.header.Class),
+			bytes.Compare(a.rdata, b.rdata),
+		)
+	})
+	var out []byte
+	for _, e := range entries {
+		out = append(out, e.wire...)
+	}
+	return out, nil
+}
+
+// canonicalRR returns a copy of rr converted to the canonical form
+// defined by RFC4034 section 6.2, except that the TTL is zero.
+func canonicalRR(rr dns.RR) dns.RR {
+	rr = dns.Copy(rr)
+	header := rr.Header()
+	header.Name = strings.ToLower(dns.Fqdn(header.Name))
+	header.Ttl = 0
+	switch rr := rr.(type) {
+	case *dns.NS:
+		rr.Ns = strings.ToLower(rr.Ns)
+	case *dns.MD:
+		rr.Md = strings.ToLower(rr.Md)
+	case *dns.MF:
+		rr.Mf = strings.ToLower(rr.Mf)
+	case *dns.CNAME:
+		rr.Target = strings.ToLower(rr.Target)
+	case *dns.SOA:
+		rr.Ns = strings.ToLower(rr.Ns)
+		rr.Mbox = strings.ToLower(rr.Mbox)
+	case *dns.MB:
+		rr.Mb = strings.ToLower(rr.Mb)
+	case *dns.MG:
+		rr.Mg = strings.ToLower(rr.Mg)
+	case *dns.MR:
+		rr.Mr = strings.ToLower(rr.Mr)
+	case *dns.PTR:
+		rr.Ptr = strings.ToLower(rr.Ptr)
+	case *dns.MINFO:
+		rr.Rmail = strings.ToLower(rr.Rmail)
+		rr.Email = strings.ToLower(rr.Email)
+	case *dns.MX:
+		rr.Mx = strings.ToLower(rr.Mx)
+	case *dns.RP:
+		rr.Mbox = strings.ToLower(rr.Mbox)
+		rr.Txt = strings.ToLower(rr.Txt)
+	case *dns.AFSDB:
+		rr.Hostname = strings.ToLower(rr.Hostname)
+	case *dns.RT:
+		rr.Host = strings.ToLower(rr.Host)
+	case *dns.PX:
+		rr.Map822 = strings.ToLower(rr.Map822)
+		rr.Mapx400 = strings.ToLower(rr.Mapx400)
+	case *dns.NAPTR:
+		rr.Replacement = strings.ToLower(rr.Replacement)
+	case *dns.KX:
+		rr.Exchanger = strings.ToLower(rr.Exchanger)
+	case *dns.SRV:
+		rr.Target = strings.ToLower(rr.Target)
+	case *dns.DNAME:
+		rr.Target = strings.ToLower(rr.Target)
+	case *dns.RRSIG:
+		rr.SignerName = strings.ToLower(rr.SignerName)
+	}
+	return rr
+}
+
+// canonicalCompareLabels compares the labels of two lowercase names
+// using the canonical ordering defined by RFC4034 section 6.1, i.e.,
+// starting from the rightmost label.
+func canonicalCompareLabels(a, b []string) int {
+	for ia, ib := len(a)-1, len(b)-1; ia >= 0 && ib >= 0; ia, ib = ia-1, ib-1 {
+		if v := strings.Compare(a[ia], b[ib]); v != 0 {
+			return v
+		}
+	}
+	return cmp.Compare(len(a), len(b))
+}
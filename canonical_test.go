@@ -0,0 +1,117 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnscodec
+
+import (
+	"net"
+	"testing"
+
+	"github.com/bassosimone/runtimex"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResponseCanonicalAnswerBytes(t *testing.T) {
+	newCNAME := func(name, target string, ttl uint32) dns.RR {
+		return &dns.CNAME{
+			Hdr: dns.RR_Header{
+				Name:   name,
+				Rrtype: dns.TypeCNAME,
+				Class:  dns.ClassINET,
+				Ttl:    ttl,
+			},
+			Target: target,
+		}
+	}
+	newA := func(name string, ttl uint32, addr string) dns.RR {
+		return &dns.A{
+			Hdr: dns.RR_Header{
+				Name:   name,
+				Rrtype: dns.TypeA,
+				Class:  dns.ClassINET,
+				Ttl:    ttl,
+			},
+			A: net.ParseIP(addr),
+		}
+	}
+
+	first := &Response{ValidRRs: []dns.RR{
+		newCNAME("www.example.com.", "example.com.", 300),
+		newA("example.com.", 300, "10.0.0.1"),
+		newA("example.com.", 300, "10.0.0.2"),
+	}}
+	second := &Response{ValidRRs: []dns.RR{
+		newA("example.com.", 60, "10.0.0.2"),
+		newA("EXAMPLE.com.", 30, "10.0.0.1"),
+		newCNAME("WWW.Example.COM.", "Example.COM.", 10),
+	}}
+	different := &Response{ValidRRs: []dns.RR{
+		newCNAME("www.example.com.", "example.com.", 300),
+		newA("example.com.", 300, "10.0.0.1"),
+		newA("example.com.", 300, "10.0.0.3"),
+	}}
+
+	firstBytes, err := first.CanonicalAnswerBytes()
+	require.NoError(t, err)
+	secondBytes, err := second.CanonicalAnswerBytes()
+	require.NoError(t, err)
+	require.Equal(t, firstBytes, secondBytes)
+	differentBytes, err := different.CanonicalAnswerBytes()
+	require.NoError(t, err)
+	require.NotEqual(t, firstBytes, differentBytes)
+
+	t.Run("CanonicalOrder", func(t *testing.T) {
+		// RFC4034 section 6.1: the owner name sorts before its
+		// descendants, and the A records sort by RDATA
+		var rrs []dns.RR
+		offset := 0
+		for offset < len(firstBytes) {
+			rr, next, err := dns.UnpackRR(firstBytes, offset)
+			require.NoError(t, err)
+			require.Zero(t, rr.Header().Ttl)
+			rrs = append(rrs, rr)
+			offset = next
+		}
+		require.Len(t, rrs, 3)
+		require.Equal(t, "10.0.0.1", rrs[0].(*dns.A).A.String())
+		require.Equal(t, "10.0.0.2", rrs[1].(*dns.A).A.String())
+		require.Equal(t, "www.example.com.", rrs[2].Header().Name)
+	})
+
+	t.Run("DoesNotModifyRRs", func(t *testing.T) {
+		require.Equal(t, "WWW.Example.COM.", second.ValidRRs[2].Header().Name)
+		require.Equal(t, uint32(10), second.ValidRRs[2].Header().Ttl)
+	})
+
+	t.Run("Empty", func(t *testing.T) {
+		data := runtimex.PanicOnError1((&Response{}).CanonicalAnswerBytes())
+		require.Empty(t, data)
+	})
+
+	t.Run("PackError", func(t *testing.T) {
+		resp := &Response{ValidRRs: []dns.RR{newA("example..com.", 300, "10.0.0.1")}}
+		data, err := resp.CanonicalAnswerBytes()
+		require.Error(t, err)
+		require.Nil(t, data)
+	})
+}
+
+func TestCanonicalCompareLabels(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected int
+	}{
+		{"example.", "example.", 0},
+		{"example.", "a.example.", -1},
+		{"z.example.", "a.example.", 1},
+		{"yljkjljk.a.example.", "z.a.example.", -1},
+		{"a.example.", "example.com.", 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.a+"_"+tt.b, func(t *testing.T) {
+			got := canonicalCompareLabels(dns.SplitDomainName(tt.a), dns.SplitDomainName(tt.b))
+			require.Equal(t, tt.expected, got)
+		})
+	}
+}
@@ -0,0 +1,168 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnscodec
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/miekg/dns"
+)
+
+// ErrMissingRRSIG indicates that a response lacks RRSIG records even
+// though DNSSEC was requested and the resolver did not set the AD bit.
+var ErrMissingRRSIG = errors.New("missing RRSIG in DNS response")
+
+// HasRRSIG returns whether the valid RRs include RRSIG records.
+func (r *Response) HasRRSIG() bool {
+	return responseHasRRSIG(r.ValidRRs)
+}
+
+// ValidateDNSSECPresence returns [ErrMissingRRSIG] when the response
+// has the AD bit unset and the answer section contains no RRSIG records.
+//
+// Use this function when the query requested DNSSEC signatures through
+// [QueryFlagDNSSec] to flag resolvers that silently strip signatures.
+//
+// This is a presence and consistency check only: it does NOT perform any
+// DNSSEC validation and does NOT verify any signature. Callers needing
+// authenticated data must use a validating resolver or library.
+func ValidateDNSSECPresence(resp *dns.Msg) error {
+	if !resp.AuthenticatedData && !responseHasRRSIG(resp.Answer) {
+		return ErrMissingRRSIG
+	}
+	return nil
+}
+
+// ErrUncoveredRRset indicates that an answer RRset is not covered
+// by any RRSIG record even though other RRsets may be.
+var ErrUncoveredRRset = errors.New("RRset not covered by RRSIG in DNS response")
+
+// ValidateRRSIGCoverage returns [ErrUncoveredRRset] when an RRset in the
+// answer section is not covered by an RRSIG record with the same owner
+// name and class and whose type covered field matches the RRset type.
+//
+// Use this function when the query requested DNSSEC signatures through
+// [QueryFlagDNSSec] to flag responses whose signatures were stripped for
+// some RRsets only, which [ValidateDNSSECPresence] cannot detect.
+//
+// A CNAME synthesized from a covered DNAME in the same answer section
+// does not need to be covered, since synthesized CNAMEs are unsigned
+// (RFC6672 section 5.1).
+//
+// This is a structural check only: it does NOT perform any DNSSEC
+// validation and does NOT verify any signature, so RRSIGs that are
+// expired, forged, or signed by the wrong key satisfy this check.
+func ValidateRRSIGCoverage(resp *dns.Msg) error {
+	type rrset struct {
+		name   string
+		rrtype uint16
+		class  uint16
+	}
+	covered := make(map[rrset]bool)
+	for _, rr := range resp.Answer {
+		if sig, ok := rr.(*dns.RRSIG); ok {
+			covered[rrset{responseCanonicalName(sig.Hdr.Name), sig.TypeCovered, sig.Hdr.Class}] = true
+		}
+	}
+	var dnames []*dns.DNAME
+	for _, rr := range resp.Answer {
+		dname, ok := rr.(*dns.DNAME)
+		if ok && covered[rrset{responseCanonicalName(dname.Hdr.Name), dns.TypeDNAME, dname.Hdr.Class}] {
+			dnames = append(dnames, dname)
+		}
+	}
+	for _, rr := range resp.Answer {
+		if _, ok := rr.(*dns.RRSIG); ok || IsMetaRR(rr) {
+			continue
+		}
+		if cname, ok := rr.(*dns.CNAME); ok && dnssecIsSynthesizedCNAME(cname, dnames) {
+			continue
+		}
+		header := rr.Header()
+		if !covered[rrset{responseCanonicalName(header.Name), header.Rrtype, header.Class}] {
+			return fmt.Errorf("%w: %s %s", ErrUncoveredRRset, header.Name, dns.Type(header.Rrtype))
+		}
+	}
+	return nil
+}
+
+// dnssecIsSynthesizedCNAME returns whether the given CNAME is the one
+// synthesized from one of the given DNAMEs (RFC6672 section 3.1).
+func dnssecIsSynthesizedCNAME(cname *dns.CNAME, dnames []*dns.DNAME) bool {
+	for _, dname := range dnames {
+		if dname.Hdr.Class != cname.Hdr.Class {
+			continue
+		}
+		target, ok := responseSubstituteDNAME(cname.Hdr.Name, dname)
+		if ok && target == responseCanonicalName(cname.Target) {
+			return true
+		}
+	}
+	return false
+}
+
+// responseHasRRSIG returns whether rrs contains RRSIG records.
+func responseHasRRSIG(rrs []dns.RR) bool {
+	for _, rr := range rrs {
+		if _, ok := rr.(*dns.RRSIG); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// RecordsDNSKEY returns all the DNSKEY records in the response.
+//
+// This method only extracts the records and does NOT validate them.
+func (r *Response) RecordsDNSKEY() ([]*dns.DNSKEY, error) {
+	out := make([]*dns.DNSKEY, 0, len(r.ValidRRs))
+	for _, rr := range r.ValidRRs {
+		switch rr := rr.(type) {
+		case *dns.DNSKEY:
+			out = append(out, rr)
+		}
+	}
+	if len(out) < 1 {
+		return nil, ErrNoData
+	}
+	return out, nil
+}
+
+// RecordsDS returns all the DS records in the response.
+//
+// This method only extracts the records and does NOT validate them.
+func (r *Response) RecordsDS() ([]*dns.DS, error) {
+	out := make([]*dns.DS, 0, len(r.ValidRRs))
+	for _, rr := range r.ValidRRs {
+		switch rr := rr.(type) {
+		case *dns.DS:
+			out = append(out, rr)
+		}
+	}
+	if len(out) < 1 {
+		return nil, ErrNoData
+	}
+	return out, nil
+}
+
+// DNSKEYsByKeyTag is like [*Response.RecordsDNSKEY] but returns a map
+// from the key tag (RFC4034 appendix B) of each DNSKEY to the DNSKEY,
+// which allows to match DS records using their KeyTag field.
+//
+// Because key tags are not unique, distinct keys may have the same key
+// tag, in which case the map contains the first such key in response order.
+func (r *Response) DNSKEYsByKeyTag() (map[uint16]*dns.DNSKEY, error) {
+	keys, err := r.RecordsDNSKEY()
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[uint16]*dns.DNSKEY, len(keys))
+	for _, key := range keys {
+		tag := key.KeyTag()
+		if _, found := out[tag]; !found {
+			out[tag] = key
+		}
+	}
+	return out, nil
+}
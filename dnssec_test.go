@@ -0,0 +1,304 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnscodec
+
+import (
+	"net"
+	"testing"
+
+	"github.com/bassosimone/runtimex"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateDNSSECPresence(t *testing.T) {
+	newAnswer := func() dns.RR {
+		return &dns.A{
+			Hdr: dns.RR_Header{
+				Name:   "example.com.",
+				Rrtype: dns.TypeA,
+				Class:  dns.ClassINET,
+			},
+			A: net.IPv4(127, 0, 0, 1),
+		}
+	}
+	newRRSIG := func() dns.RR {
+		return &dns.RRSIG{
+			Hdr: dns.RR_Header{
+				Name:   "example.com.",
+				Rrtype: dns.TypeRRSIG,
+				Class:  dns.ClassINET,
+			},
+			TypeCovered: dns.TypeA,
+		}
+	}
+
+	tests := []struct {
+		name              string
+		answer            []dns.RR
+		authenticatedData bool
+		expectedHasRRSIG  bool
+		expectedErr       error
+	}{
+		{
+			name:              "Signed",
+			answer:            []dns.RR{newAnswer(), newRRSIG()},
+			authenticatedData: false,
+			expectedHasRRSIG:  true,
+			expectedErr:       nil,
+		},
+
+		{
+			name:              "SignedAndValidated",
+			answer:            []dns.RR{newAnswer(), newRRSIG()},
+			authenticatedData: true,
+			expectedHasRRSIG:  true,
+			expectedErr:       nil,
+		},
+
+		{
+			name:              "Stripped",
+			answer:            []dns.RR{newAnswer()},
+			authenticatedData: false,
+			expectedHasRRSIG:  false,
+			expectedErr:       ErrMissingRRSIG,
+		},
+
+		{
+			name:              "StrippedButValidated",
+			answer:            []dns.RR{newAnswer()},
+			authenticatedData: true,
+			expectedHasRRSIG:  false,
+			expectedErr:       nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := new(dns.Msg)
+			query.SetQuestion("example.com.", dns.TypeA)
+			query.SetEdns0(QueryMaxResponseSizeUDP, true)
+			msg := new(dns.Msg)
+			msg.SetReply(query)
+			msg.AuthenticatedData = tt.authenticatedData
+			msg.Answer = tt.answer
+
+			resp, err := ParseResponse(query, msg)
+			require.NoError(t, err)
+			require.Equal(t, tt.expectedHasRRSIG, resp.HasRRSIG())
+
+			err = ValidateDNSSECPresence(msg)
+			if tt.expectedErr != nil {
+				require.ErrorIs(t, err, tt.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestResponseRecordsDNSKEYAndDS(t *testing.T) {
+	newKey := func(flags uint16) *dns.DNSKEY {
+		key := &dns.DNSKEY{
+			Hdr: dns.RR_Header{
+				Name:   "example.com.",
+				Rrtype: dns.TypeDNSKEY,
+				Class:  dns.ClassINET,
+				Ttl:    3600,
+			},
+			Flags:     flags,
+			Protocol:  3,
+			Algorithm: dns.ECDSAP256SHA256,
+		}
+		runtimex.PanicOnError1(key.Generate(256))
+		return key
+	}
+	ksk := newKey(dns.ZONE | dns.SEP)
+	zsk := newKey(dns.ZONE)
+	ds := ksk.ToDS(dns.SHA256)
+	require.NotNil(t, ds)
+
+	t.Run("DNSKEY", func(t *testing.T) {
+		resp := &Response{ValidRRs: []dns.RR{ksk, zsk, &dns.RRSIG{TypeCovered: dns.TypeDNSKEY}}}
+
+		keys, err := resp.RecordsDNSKEY()
+		require.NoError(t, err)
+		require.Equal(t, []*dns.DNSKEY{ksk, zsk}, keys)
+
+		byTag, err := resp.DNSKEYsByKeyTag()
+		require.NoError(t, err)
+		require.Len(t, byTag, 2)
+		require.Same(t, ksk, byTag[ksk.KeyTag()])
+		require.Same(t, zsk, byTag[zsk.KeyTag()])
+		require.Same(t, ksk, byTag[ds.KeyTag])
+
+		dsRecords, err := resp.RecordsDS()
+		require.ErrorIs(t, err, ErrNoData)
+		require.Nil(t, dsRecords)
+
+		// Make sure Records agrees with the typed extractors.
+		rs, err := resp.Records()
+		require.NoError(t, err)
+		require.Equal(t, keys, rs.DNSKEY)
+		require.Empty(t, rs.DS)
+	})
+
+	t.Run("DS", func(t *testing.T) {
+		resp := &Response{ValidRRs: []dns.RR{ds}}
+
+		dsRecords, err := resp.RecordsDS()
+		require.NoError(t, err)
+		require.Equal(t, []*dns.DS{ds}, dsRecords)
+
+		keys, err := resp.RecordsDNSKEY()
+		require.ErrorIs(t, err, ErrNoData)
+		require.Nil(t, keys)
+
+		byTag, err := resp.DNSKEYsByKeyTag()
+		require.ErrorIs(t, err, ErrNoData)
+		require.Nil(t, byTag)
+
+		// Make sure Records agrees with the typed extractors.
+		rs, err := resp.Records()
+		require.NoError(t, err)
+		require.Equal(t, dsRecords, rs.DS)
+		require.Empty(t, rs.DNSKEY)
+	})
+
+	t.Run("KeyTagCollision", func(t *testing.T) {
+		clone := dns.Copy(ksk).(*dns.DNSKEY)
+		resp := &Response{ValidRRs: []dns.RR{ksk, clone}}
+
+		byTag, err := resp.DNSKEYsByKeyTag()
+		require.NoError(t, err)
+		require.Len(t, byTag, 1)
+		require.Same(t, ksk, byTag[ksk.KeyTag()])
+	})
+}
+
+func TestValidateRRSIGCoverage(t *testing.T) {
+	header := func(name string, rrtype uint16) dns.RR_Header {
+		return dns.RR_Header{Name: name, Rrtype: rrtype, Class: dns.ClassINET}
+	}
+	newA := func(name string) dns.RR {
+		return &dns.A{Hdr: header(name, dns.TypeA), A: net.IPv4(127, 0, 0, 1)}
+	}
+	newAAAA := func(name string) dns.RR {
+		return &dns.AAAA{Hdr: header(name, dns.TypeAAAA), AAAA: net.ParseIP("::1")}
+	}
+	newRRSIG := func(name string, covered uint16) dns.RR {
+		return &dns.RRSIG{Hdr: header(name, dns.TypeRRSIG), TypeCovered: covered}
+	}
+	newDNAME := func(name, target string) dns.RR {
+		return &dns.DNAME{Hdr: header(name, dns.TypeDNAME), Target: target}
+	}
+	newCNAME := func(name, target string) dns.RR {
+		return &dns.CNAME{Hdr: header(name, dns.TypeCNAME), Target: target}
+	}
+
+	tests := []struct {
+		name        string
+		answer      []dns.RR
+		expectedErr error
+	}{
+		{
+			name:        "Empty",
+			answer:      nil,
+			expectedErr: nil,
+		},
+
+		{
+			name: "AllCovered",
+			answer: []dns.RR{
+				newA("example.com."),
+				newA("example.com."),
+				newRRSIG("example.com.", dns.TypeA),
+				newAAAA("example.com."),
+				newRRSIG("EXAMPLE.com.", dns.TypeAAAA),
+			},
+			expectedErr: nil,
+		},
+
+		{
+			name: "AAAAStripped",
+			answer: []dns.RR{
+				newA("example.com."),
+				newRRSIG("example.com.", dns.TypeA),
+				newAAAA("example.com."),
+			},
+			expectedErr: ErrUncoveredRRset,
+		},
+
+		{
+			name: "SignatureForAnotherName",
+			answer: []dns.RR{
+				newA("example.com."),
+				newRRSIG("www.example.com.", dns.TypeA),
+			},
+			expectedErr: ErrUncoveredRRset,
+		},
+
+		{
+			name: "SignedDNAME",
+			answer: []dns.RR{
+				newDNAME("example.com.", "example.net."),
+				newRRSIG("example.com.", dns.TypeDNAME),
+				newCNAME("www.example.com.", "www.example.net."),
+				newA("www.example.net."),
+				newRRSIG("www.example.net.", dns.TypeA),
+			},
+			expectedErr: nil,
+		},
+
+		{
+			name: "UnsignedDNAME",
+			answer: []dns.RR{
+				newDNAME("example.com.", "example.net."),
+				newCNAME("www.example.com.", "www.example.net."),
+				newA("www.example.net."),
+				newRRSIG("www.example.net.", dns.TypeA),
+			},
+			expectedErr: ErrUncoveredRRset,
+		},
+
+		{
+			name: "CNAMENotMatchingDNAME",
+			answer: []dns.RR{
+				newDNAME("example.com.", "example.net."),
+				newRRSIG("example.com.", dns.TypeDNAME),
+				newCNAME("www.example.com.", "www.example.org."),
+				newA("www.example.org."),
+				newRRSIG("www.example.org.", dns.TypeA),
+			},
+			expectedErr: ErrUncoveredRRset,
+		},
+
+		{
+			name: "Unsigned",
+			answer: []dns.RR{
+				newA("example.com."),
+			},
+			expectedErr: ErrUncoveredRRset,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := new(dns.Msg)
+			msg.Answer = tt.answer
+			err := ValidateRRSIGCoverage(msg)
+			if tt.expectedErr != nil {
+				require.ErrorIs(t, err, tt.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+
+	t.Run("ErrorMentionsRRset", func(t *testing.T) {
+		msg := new(dns.Msg)
+		msg.Answer = []dns.RR{newAAAA("example.com.")}
+		err := ValidateRRSIGCoverage(msg)
+		require.ErrorContains(t, err, "example.com. AAAA")
+	})
+}
@@ -0,0 +1,97 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnscodec
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"mime"
+	"net/url"
+
+	"github.com/miekg/dns"
+)
+
+// DoHContentType is the media type of DNS-over-HTTPS messages.
+//
+// Use it for the Content-Type header when sending a query using
+// DNS-over-HTTPS POST and for the Accept header (see RFC8484 section 6).
+const DoHContentType = "application/dns-message"
+
+// ErrInvalidDoHEndpoint indicates that the DNS-over-HTTPS endpoint URL is malformed.
+var ErrInvalidDoHEndpoint = errors.New("invalid DNS-over-HTTPS endpoint")
+
+// ErrWrongContentType indicates that the DNS-over-HTTPS response has
+// a Content-Type other than [DoHContentType].
+var ErrWrongContentType = errors.New("wrong DNS-over-HTTPS response content type")
+
+// NewDoHGetURL returns the URL for sending the query using DNS-over-HTTPS GET.
+//
+// The URL is obtained by adding the `dns` query parameter containing the
+// packed query, base64url encoded without padding as required by RFC8484
+// section 4.1, to the endpoint URL (e.g., https://dns.google/dns-query).
+// Existing query parameters of the endpoint URL are preserved.
+//
+// RFC8484 recommends using zero as the query ID to maximize HTTP cache
+// friendliness, so callers should consider setting [Query.ID] to zero.
+//
+// This method returns [ErrInvalidDoHEndpoint] if the endpoint URL is
+// malformed or lacks either the scheme or the host.
+func (q *Query) NewDoHGetURL(endpoint string) (string, error) {
+	// 1. parse and validate the endpoint URL
+	URL, err := url.Parse(endpoint)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", ErrInvalidDoHEndpoint, err.Error())
+	}
+	if URL.Scheme == "" || URL.Host == "" {
+		return "", fmt.Errorf("%w: missing scheme or host", ErrInvalidDoHEndpoint)
+	}
+	values, err := url.ParseQuery(URL.RawQuery)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", ErrInvalidDoHEndpoint, err.Error())
+	}
+
+	// 2. serialize the query
+	rawQuery, err := q.Pack()
+	if err != nil {
+		return "", err
+	}
+
+	// 3. add the dns query parameter
+	values.Set("dns", base64.RawURLEncoding.EncodeToString(rawQuery))
+	URL.RawQuery = values.Encode()
+	return URL.String(), nil
+}
+
+// NewDoHPostBody returns the body for sending the query using DNS-over-HTTPS POST.
+//
+// The body is the packed query, which must be sent along with the
+// [DoHContentType] Content-Type header as required by RFC8484 section 4.1.
+//
+// RFC8484 section 4.1 says that clients SHOULD use zero as the query ID
+// in every DNS request, because HTTP already correlates each response
+// with its request, so callers should consider setting [Query.ID] to zero.
+func (q *Query) NewDoHPostBody() ([]byte, error) {
+	return q.Pack()
+}
+
+// ParseDoHResponse is like [ParseResponseBytes] but first checks that
+// the DNS-over-HTTPS response Content-Type is [DoHContentType].
+//
+// This catches captive portals and misconfigured endpoints that return
+// non-DNS bodies (e.g., HTML error pages) with a 200 status code. The
+// media type comparison is case insensitive and ignores parameters
+// (e.g., "application/dns-message; charset=utf-8").
+//
+// This function returns [ErrWrongContentType] if the Content-Type is
+// missing, malformed, or different from [DoHContentType].
+func ParseDoHResponse(query *dns.Msg, contentType string, body []byte, options ...ParseOption) (*Response, error) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrWrongContentType, err.Error())
+	}
+	if mediaType != DoHContentType {
+		return nil, fmt.Errorf("%w: %s", ErrWrongContentType, mediaType)
+	}
+	return ParseResponseBytes(query, body, options...)
+}
@@ -0,0 +1,207 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnscodec
+
+import (
+	"encoding/base64"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/bassosimone/runtimex"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueryNewDoHGetURL(t *testing.T) {
+	tests := []struct {
+		name           string
+		endpoint       string
+		expectedPrefix string
+		expectedValues url.Values
+	}{
+		{
+			name:           "WithoutParameters",
+			endpoint:       "https://dns.google/dns-query",
+			expectedPrefix: "https://dns.google/dns-query?",
+			expectedValues: url.Values{},
+		},
+
+		{
+			name:           "WithParameters",
+			endpoint:       "https://dns.example.com/dns-query?ct=application/dns-message&x=1",
+			expectedPrefix: "https://dns.example.com/dns-query?",
+			expectedValues: url.Values{
+				"ct": {"application/dns-message"},
+				"x":  {"1"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Note: we need a packed query whose length is not a multiple
+			// of three, such that the standard encoding would require padding.
+			query := NewQuery("www.example.com", dns.TypeA)
+			query.ID = 0
+			msg := runtimex.PanicOnError1(query.NewMsg())
+			rawQuery := runtimex.PanicOnError1(msg.Pack())
+			require.NotEqual(t, 0, len(rawQuery)%3)
+
+			URL, err := query.NewDoHGetURL(tt.endpoint)
+			require.NoError(t, err)
+			require.True(t, strings.HasPrefix(URL, tt.expectedPrefix))
+
+			parsed, err := url.Parse(URL)
+			require.NoError(t, err)
+			values := parsed.Query()
+			encoded := values.Get("dns")
+			require.NotContains(t, encoded, "=")
+			decoded, err := base64.RawURLEncoding.DecodeString(encoded)
+			require.NoError(t, err)
+			require.Equal(t, rawQuery, decoded)
+
+			values.Del("dns")
+			require.Equal(t, tt.expectedValues, values)
+		})
+	}
+}
+
+func TestQueryNewDoHGetURLFailure(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    *Query
+		endpoint string
+		expected error
+	}{
+		{
+			name:     "UnparseableURL",
+			query:    NewQuery("www.example.com", dns.TypeA),
+			endpoint: "https://dns.google:port/dns-query",
+			expected: ErrInvalidDoHEndpoint,
+		},
+
+		{
+			name:     "MissingScheme",
+			query:    NewQuery("www.example.com", dns.TypeA),
+			endpoint: "dns.google/dns-query",
+			expected: ErrInvalidDoHEndpoint,
+		},
+
+		{
+			name:     "InvalidQueryParameters",
+			query:    NewQuery("www.example.com", dns.TypeA),
+			endpoint: "https://dns.google/dns-query?x=%zz",
+			expected: ErrInvalidDoHEndpoint,
+		},
+
+		{
+			name:     "InvalidQueryName",
+			query:    NewQuery("bad name.example", dns.TypeA),
+			endpoint: "https://dns.google/dns-query",
+			expected: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			URL, err := tt.query.NewDoHGetURL(tt.endpoint)
+			require.Error(t, err)
+			if tt.expected != nil {
+				require.ErrorIs(t, err, tt.expected)
+			}
+			require.Empty(t, URL)
+		})
+	}
+}
+
+func TestQueryNewDoHPostBody(t *testing.T) {
+	query := NewQuery("www.example.com", dns.TypeAAAA)
+	query.ID = 0
+
+	body, err := query.NewDoHPostBody()
+	require.NoError(t, err)
+
+	msg := new(dns.Msg)
+	require.NoError(t, msg.Unpack(body))
+	require.Equal(t, uint16(0), msg.Id)
+	require.Len(t, msg.Question, 1)
+	require.Equal(t, dns.Question{
+		Name:   "www.example.com.",
+		Qtype:  dns.TypeAAAA,
+		Qclass: dns.ClassINET,
+	}, msg.Question[0])
+}
+
+func TestQueryNewDoHPostBodyFailure(t *testing.T) {
+	query := NewQuery(strings.Repeat("a", 64)+".example.com", dns.TypeA)
+
+	body, err := query.NewDoHPostBody()
+	require.ErrorIs(t, err, ErrLabelTooLong)
+	require.Nil(t, body)
+}
+
+func TestParseDoHResponse(t *testing.T) {
+	query := runtimex.PanicOnError1(NewQuery("www.example.com", dns.TypeA).NewMsg())
+	resp := new(dns.Msg)
+	resp.SetReply(query)
+	resp.RecursionAvailable = true
+	resp.Answer = []dns.RR{&dns.A{
+		Hdr: dns.RR_Header{Name: "www.example.com.", Rrtype: dns.TypeA, Class: dns.ClassINET},
+		A:   []byte{127, 0, 0, 1},
+	}}
+	body := runtimex.PanicOnError1(resp.Pack())
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        []byte
+		expectedErr error
+	}{
+		{
+			name:        "Canonical",
+			contentType: DoHContentType,
+			body:        body,
+		},
+
+		{
+			name:        "WithParameters",
+			contentType: "Application/DNS-Message; charset=utf-8",
+			body:        body,
+		},
+
+		{
+			name:        "HTML",
+			contentType: "text/html",
+			body:        []byte("<html><body>Please log in</body></html>"),
+			expectedErr: ErrWrongContentType,
+		},
+
+		{
+			name:        "Missing",
+			contentType: "",
+			body:        body,
+			expectedErr: ErrWrongContentType,
+		},
+
+		{
+			name:        "InvalidBody",
+			contentType: DoHContentType,
+			body:        []byte{1, 2, 3},
+			expectedErr: ErrCannotUnmarshalMessage,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rp, err := ParseDoHResponse(query, tt.contentType, tt.body)
+			if tt.expectedErr != nil {
+				require.ErrorIs(t, err, tt.expectedErr)
+				require.Nil(t, rp)
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, rp.ValidRRs, 1)
+		})
+	}
+}
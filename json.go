@@ -0,0 +1,182 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnscodec
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// jsonMessage is the JSON DNS message format used by Google and Cloudflare.
+type jsonMessage struct {
+	Status     int            `json:"Status"`
+	TC         bool           `json:"TC"`
+	RD         bool           `json:"RD"`
+	RA         bool           `json:"RA"`
+	AD         bool           `json:"AD"`
+	CD         bool           `json:"CD"`
+	Question   []jsonQuestion `json:"Question"`
+	Answer     []jsonRR       `json:"Answer,omitempty"`
+	Authority  []jsonRR       `json:"Authority,omitempty"`
+	Additional []jsonRR       `json:"Additional,omitempty"`
+}
+
+// jsonQuestion is a question inside a [jsonMessage].
+type jsonQuestion struct {
+	Name string `json:"name"`
+	Type uint16 `json:"type"`
+}
+
+// jsonRR is a resource record inside a [jsonMessage].
+type jsonRR struct {
+	Name string `json:"name"`
+	Type uint16 `json:"type"`
+	TTL  uint32 `json:"TTL"`
+	Data string `json:"data"`
+}
+
+// ParseJSONResponse is like [ParseResponse] but parses a response using
+// the JSON format used by Google and Cloudflare DNS-over-HTTPS services.
+//
+// This function converts the JSON response into a synthetic [*dns.Msg]
+// and then runs the same validation performed by [ParseResponse]. Since
+// the JSON format lacks the query ID, the synthetic message uses the ID
+// of the query. Each record is converted by parsing its presentation
+// format, so all the types supported by [dns.NewRR] are supported.
+//
+// This function returns [ErrCannotUnmarshalMessage] if the JSON is
+// malformed or contains records that cannot be converted.
+func ParseJSONResponse(query *dns.Msg, data []byte, options ...ParseOption) (*Response, error) {
+	resp, err := jsonUnmarshalMsg(query, data)
+	if err != nil {
+		return nil, err
+	}
+	return ParseResponse(query, resp, options...)
+}
+
+// jsonUnmarshalMsg converts a JSON response into a [*dns.Msg].
+func jsonUnmarshalMsg(query *dns.Msg, data []byte) (*dns.Msg, error) {
+	var jm jsonMessage
+	if err := json.Unmarshal(data, &jm); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrCannotUnmarshalMessage, err.Error())
+	}
+
+	resp := new(dns.Msg)
+	resp.Id = query.Id
+	resp.Response = true
+	resp.Opcode = query.Opcode
+	resp.Rcode = jm.Status
+	resp.Truncated = jm.TC
+	resp.RecursionDesired = jm.RD
+	resp.RecursionAvailable = jm.RA
+	resp.AuthenticatedData = jm.AD
+	resp.CheckingDisabled = jm.CD
+
+	for _, jq := range jm.Question {
+		resp.Question = append(resp.Question, dns.Question{
+			Name:   dns.Fqdn(jq.Name),
+			Qtype:  jq.Type,
+			Qclass: dns.ClassINET,
+		})
+	}
+
+	var err error
+	if resp.Answer, err = jsonUnmarshalRRs(jm.Answer); err != nil {
+		return nil, err
+	}
+	if resp.Ns, err = jsonUnmarshalRRs(jm.Authority); err != nil {
+		return nil, err
+	}
+	if resp.Extra, err = jsonUnmarshalRRs(jm.Additional); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// jsonUnmarshalRRs converts JSON records into [dns.RR] values.
+func jsonUnmarshalRRs(jrrs []jsonRR) ([]dns.RR, error) {
+	var out []dns.RR
+	for _, jrr := range jrrs {
+		rrtype, ok := dns.TypeToString[jrr.Type]
+		if !ok {
+			rrtype = fmt.Sprintf("TYPE%d", jrr.Type)
+		}
+		data := jrr.Data
+		if jrr.Type == dns.TypeTXT || jrr.Type == dns.TypeSPF {
+			data = jsonQuoteTXTData(data)
+		}
+		line := fmt.Sprintf("%s %d IN %s %s", dns.Fqdn(jrr.Name), jrr.TTL, rrtype, data)
+		rr, err := dns.NewRR(line)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrCannotUnmarshalMessage, err.Error())
+		}
+		if rr == nil {
+			return nil, fmt.Errorf("%w: empty record", ErrCannotUnmarshalMessage)
+		}
+		out = append(out, rr)
+	}
+	return out, nil
+}
+
+// jsonQuoteTXTData quotes the TXT or SPF data unless already quoted.
+//
+// Some services (e.g., Google) return TXT data without quotes, which
+// [dns.NewRR] would split at whitespace into distinct strings, thus
+// silently corrupting the data (e.g., "v=spf1 -all" would become
+// "v=spf1" and "-all"). Hence, we quote and escape such data.
+func jsonQuoteTXTData(data string) string {
+	if strings.HasPrefix(data, `"`) {
+		return data
+	}
+	data = strings.ReplaceAll(data, `\`, `\\`)
+	data = strings.ReplaceAll(data, `"`, `\"`)
+	return `"` + data + `"`
+}
+
+// MarshalJSONResponse serializes the response using the JSON format
+// used by Google and Cloudflare DNS-over-HTTPS services.
+//
+// The Status field contains the response RCODE, the flags and the
+// question come from the response message, and the Answer field contains
+// the [*Response.ValidRRs] using their header TTLs and their presentation
+// format as data. The result can be parsed using [ParseJSONResponse].
+func (r *Response) MarshalJSONResponse() ([]byte, error) {
+	jm := jsonMessage{
+		Status: r.RCODE(),
+		TC:     r.Response.Truncated,
+		RD:     r.Response.RecursionDesired,
+		RA:     r.Response.RecursionAvailable,
+		AD:     r.Response.AuthenticatedData,
+		CD:     r.Response.CheckingDisabled,
+	}
+	for _, q := range r.Response.Question {
+		jm.Question = append(jm.Question, jsonQuestion{Name: q.Name, Type: q.Qtype})
+	}
+	for _, rr := range r.ValidRRs {
+		jm.Answer = append(jm.Answer, jsonMarshalRR(rr))
+	}
+	return json.Marshal(jm)
+}
+
+// jsonMarshalRR converts a [dns.RR] into a [jsonRR].
+//
+// The data is the presentation format of the RR without the first four
+// tab-separated fields (name, TTL, class, and type). We do not strip the
+// header presentation format because some RRs (e.g., [*dns.RFC3597])
+// print the class and the type differently from [dns.RR_Header].
+func jsonMarshalRR(rr dns.RR) jsonRR {
+	header := rr.Header()
+	var data string
+	if fields := strings.SplitN(rr.String(), "\t", 5); len(fields) == 5 {
+		data = fields[4]
+	}
+	return jsonRR{
+		Name: header.Name,
+		Type: header.Rrtype,
+		TTL:  header.Ttl,
+		Data: data,
+	}
+}
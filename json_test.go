@@ -0,0 +1,200 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnscodec
+
+import (
+	"testing"
+
+	"github.com/bassosimone/runtimex"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseJSONResponse(t *testing.T) {
+	tests := []struct {
+		name        string
+		qtype       uint16
+		data        string
+		expectedErr error
+		expectedRRs []string
+	}{
+		{
+			name:  "A",
+			qtype: dns.TypeA,
+			data: `{"Status":0,"TC":false,"RD":true,"RA":true,"AD":false,"CD":false,
+				"Question":[{"name":"www.example.com.","type":1}],
+				"Answer":[{"name":"www.example.com.","type":5,"TTL":300,"data":"example.com."},
+					{"name":"example.com.","type":1,"TTL":300,"data":"93.184.216.34"}]}`,
+			expectedRRs: []string{
+				"www.example.com.\t300\tIN\tCNAME\texample.com.",
+				"example.com.\t300\tIN\tA\t93.184.216.34",
+			},
+		},
+
+		{
+			name:  "AAAA",
+			qtype: dns.TypeAAAA,
+			data: `{"Status":0,"Question":[{"name":"www.example.com","type":28}],
+				"Answer":[{"name":"www.example.com","type":28,"TTL":60,"data":"2001:db8::1"}]}`,
+			expectedRRs: []string{
+				"www.example.com.\t60\tIN\tAAAA\t2001:db8::1",
+			},
+		},
+
+		{
+			name:  "MX",
+			qtype: dns.TypeMX,
+			data: `{"Status":0,"Question":[{"name":"www.example.com.","type":15}],
+				"Answer":[{"name":"www.example.com.","type":15,"TTL":60,"data":"10 mx.example.com."}]}`,
+			expectedRRs: []string{
+				"www.example.com.\t60\tIN\tMX\t10 mx.example.com.",
+			},
+		},
+
+		{
+			name:  "TXT",
+			qtype: dns.TypeTXT,
+			data: `{"Status":0,"Question":[{"name":"www.example.com.","type":16}],
+				"Answer":[{"name":"www.example.com.","type":16,"TTL":60,"data":"\"v=spf1 -all\""}]}`,
+			expectedRRs: []string{
+				"www.example.com.\t60\tIN\tTXT\t\"v=spf1 -all\"",
+			},
+		},
+
+		{
+			name:  "UnquotedTXT",
+			qtype: dns.TypeTXT,
+			data: `{"Status":0,"Question":[{"name":"www.example.com.","type":16}],
+				"Answer":[{"name":"www.example.com.","type":16,"TTL":60,"data":"v=spf1 -all"},
+					{"name":"www.example.com.","type":16,"TTL":60,"data":"say \"hi\" \\o/"}]}`,
+			expectedRRs: []string{
+				"www.example.com.\t60\tIN\tTXT\t\"v=spf1 -all\"",
+				"www.example.com.\t60\tIN\tTXT\t\"say \\\"hi\\\" \\\\o/\"",
+			},
+		},
+
+		{
+			name:  "NS",
+			qtype: dns.TypeNS,
+			data: `{"Status":0,"Question":[{"name":"www.example.com.","type":2}],
+				"Answer":[{"name":"www.example.com.","type":2,"TTL":60,"data":"ns1.example.com."}]}`,
+			expectedRRs: []string{
+				"www.example.com.\t60\tIN\tNS\tns1.example.com.",
+			},
+		},
+
+		{
+			name:  "NXDOMAIN",
+			qtype: dns.TypeA,
+			data: `{"Status":3,"Question":[{"name":"www.example.com.","type":1}],
+				"Authority":[{"name":"example.com.","type":6,"TTL":60,
+				"data":"ns.example.com. admin.example.com. 1 7200 3600 1209600 3600"}]}`,
+			expectedErr: ErrNoName,
+		},
+
+		{
+			name:        "MalformedJSON",
+			qtype:       dns.TypeA,
+			data:        `{"Status":`,
+			expectedErr: ErrCannotUnmarshalMessage,
+		},
+
+		{
+			name:  "MalformedRecord",
+			qtype: dns.TypeA,
+			data: `{"Status":0,"Question":[{"name":"www.example.com.","type":1}],
+				"Answer":[{"name":"www.example.com.","type":1,"TTL":60,"data":"not-an-address"}]}`,
+			expectedErr: ErrCannotUnmarshalMessage,
+		},
+
+		{
+			name:  "MismatchingQuestion",
+			qtype: dns.TypeA,
+			data: `{"Status":0,"Question":[{"name":"www.example.org.","type":1}],
+				"Answer":[{"name":"www.example.org.","type":1,"TTL":60,"data":"93.184.216.34"}]}`,
+			expectedErr: ErrInvalidResponse,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := runtimex.PanicOnError1(NewQuery("www.example.com", tt.qtype).NewMsg())
+
+			resp, err := ParseJSONResponse(query, []byte(tt.data))
+			if tt.expectedErr != nil {
+				require.ErrorIs(t, err, tt.expectedErr)
+				require.Nil(t, resp)
+				return
+			}
+
+			require.NoError(t, err)
+			var got []string
+			for _, rr := range resp.ValidRRs {
+				got = append(got, rr.String())
+			}
+			require.Equal(t, tt.expectedRRs, got)
+			require.Equal(t, query.Id, resp.Response.Id)
+		})
+	}
+}
+
+func TestResponseMarshalJSONResponse(t *testing.T) {
+	query := runtimex.PanicOnError1(NewQuery("www.example.com", dns.TypeMX).NewMsg())
+	resp := new(dns.Msg)
+	resp.SetReply(query)
+	resp.RecursionAvailable = true
+	resp.Answer = []dns.RR{
+		&dns.CNAME{
+			Hdr:    dns.RR_Header{Name: "www.example.com.", Rrtype: dns.TypeCNAME, Class: dns.ClassINET, Ttl: 120},
+			Target: "example.com.",
+		},
+		&dns.MX{
+			Hdr:        dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeMX, Class: dns.ClassINET, Ttl: 300},
+			Preference: 10,
+			Mx:         "mx.example.com.",
+		},
+	}
+	parsed := runtimex.PanicOnError1(ParseResponse(query, resp))
+
+	data, err := parsed.MarshalJSONResponse()
+	require.NoError(t, err)
+	require.JSONEq(t, `{"Status":0,"TC":false,"RD":true,"RA":true,"AD":false,"CD":false,
+		"Question":[{"name":"www.example.com.","type":15}],
+		"Answer":[{"name":"www.example.com.","type":5,"TTL":120,"data":"example.com."},
+			{"name":"example.com.","type":15,"TTL":300,"data":"10 mx.example.com."}]}`, string(data))
+
+	// Make sure we can round trip through the decoder
+	roundTrip, err := ParseJSONResponse(query, data)
+	require.NoError(t, err)
+	require.Equal(t, len(parsed.ValidRRs), len(roundTrip.ValidRRs))
+	for idx := range parsed.ValidRRs {
+		require.Equal(t, parsed.ValidRRs[idx].String(), roundTrip.ValidRRs[idx].String())
+	}
+}
+
+func TestResponseMarshalJSONResponseUnknownType(t *testing.T) {
+	const rrtype = 65280
+	query := runtimex.PanicOnError1(NewQuery("example.com", rrtype).NewMsg())
+	resp := new(dns.Msg)
+	resp.SetReply(query)
+	resp.RecursionAvailable = true
+	resp.Answer = []dns.RR{
+		&dns.RFC3597{
+			Hdr:   dns.RR_Header{Name: "example.com.", Rrtype: rrtype, Class: dns.ClassINET, Ttl: 5},
+			Rdata: "0102",
+		},
+	}
+	parsed := runtimex.PanicOnError1(ParseResponse(query, resp))
+
+	data, err := parsed.MarshalJSONResponse()
+	require.NoError(t, err)
+	require.JSONEq(t, `{"Status":0,"TC":false,"RD":true,"RA":true,"AD":false,"CD":false,
+		"Question":[{"name":"example.com.","type":65280}],
+		"Answer":[{"name":"example.com.","type":65280,"TTL":5,"data":"\\# 2 0102"}]}`, string(data))
+
+	// Make sure we can round trip through the decoder
+	roundTrip, err := ParseJSONResponse(query, data)
+	require.NoError(t, err)
+	require.Len(t, roundTrip.ValidRRs, 1)
+	require.Equal(t, parsed.ValidRRs[0].String(), roundTrip.ValidRRs[0].String())
+}
@@ -0,0 +1,86 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnscodec
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// MergeResponses merges the valid RRs of responses for the same question.
+//
+// This is useful to consolidate the answers obtained by sending the same
+// question to several resolvers in parallel. The responses must have been
+// returned by [ParseResponse] (or similar) for queries containing the same
+// question, where names are compared case insensitively such that queries
+// using [QueryFlag0x20Randomize] can be merged. Query IDs may differ.
+//
+// The returned [*Response] points to the query and response messages of
+// the first response and contains the union of the valid RRs, in first-seen
+// order. Two RRs are duplicates when they have the same name (compared case
+// insensitively), class, type, and RDATA (e.g., the same address for A and
+// AAAA, the same target for CNAME) regardless of the TTL, in which case we
+// keep the first one.
+//
+// This function returns [ErrInvalidQuery] if there are no responses or
+// the questions of the responses do not match.
+func MergeResponses(resps ...*Response) (*Response, error) {
+	// 1. make sure all the responses share the same question
+	if len(resps) < 1 {
+		return nil, fmt.Errorf("%w: no responses to merge", ErrInvalidQuery)
+	}
+	q0, err := mergeQuestion(resps[0])
+	if err != nil {
+		return nil, err
+	}
+	for _, resp := range resps[1:] {
+		qx, err := mergeQuestion(resp)
+		if err != nil {
+			return nil, err
+		}
+		if qx != q0 {
+			return nil, fmt.Errorf("%w: cannot merge responses for distinct questions", ErrInvalidQuery)
+		}
+	}
+
+	// 2. compute the union of the valid RRs
+	var valid []dns.RR
+	for _, resp := range resps {
+		for _, rr := range resp.ValidRRs {
+			if !mergeContainsRR(valid, rr) {
+				valid = append(valid, rr)
+			}
+		}
+	}
+
+	// 3. assemble the merged response
+	merged := &Response{
+		Query:            resps[0].Query,
+		Response:         resps[0].Response,
+		ValidRRs:         valid,
+		IncludeAuthority: resps[0].IncludeAuthority,
+	}
+	return merged, nil
+}
+
+// mergeQuestion returns the normalized question of the response query.
+func mergeQuestion(resp *Response) (dns.Question, error) {
+	if resp == nil || resp.Query == nil || len(resp.Query.Question) != 1 {
+		return dns.Question{}, ErrInvalidQuery
+	}
+	q0 := resp.Query.Question[0]
+	q0.Name = strings.ToLower(dns.Fqdn(q0.Name))
+	return q0, nil
+}
+
+// mergeContainsRR returns whether rrs contains a duplicate of rr.
+func mergeContainsRR(rrs []dns.RR, rr dns.RR) bool {
+	for _, entry := range rrs {
+		if dns.IsDuplicate(entry, rr) {
+			return true
+		}
+	}
+	return false
+}
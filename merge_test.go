@@ -0,0 +1,138 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnscodec
+
+import (
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergeResponses(t *testing.T) {
+	newQuery := func(name string, qtype uint16, id uint16) *dns.Msg {
+		msg := new(dns.Msg)
+		msg.SetQuestion(name, qtype)
+		msg.Id = id
+		return msg
+	}
+	newA := func(name string, ttl uint32, addr string) *dns.A {
+		return &dns.A{
+			Hdr: dns.RR_Header{
+				Name:   name,
+				Rrtype: dns.TypeA,
+				Class:  dns.ClassINET,
+				Ttl:    ttl,
+			},
+			A: net.ParseIP(addr),
+		}
+	}
+	newCNAME := func(name, target string) *dns.CNAME {
+		return &dns.CNAME{
+			Hdr: dns.RR_Header{
+				Name:   name,
+				Rrtype: dns.TypeCNAME,
+				Class:  dns.ClassINET,
+				Ttl:    300,
+			},
+			Target: target,
+		}
+	}
+
+	t.Run("OverlappingA", func(t *testing.T) {
+		cname := newCNAME("www.example.com.", "example.com.")
+		a1 := newA("example.com.", 300, "10.0.0.1")
+		a2 := newA("example.com.", 300, "10.0.0.2")
+		a3 := newA("example.com.", 300, "10.0.0.3")
+		first := &Response{
+			Query:    newQuery("www.example.com.", dns.TypeA, 1),
+			Response: new(dns.Msg),
+			ValidRRs: []dns.RR{cname, a1, a2},
+		}
+		second := &Response{
+			Query:    newQuery("WwW.ExAmPlE.cOm.", dns.TypeA, 2),
+			Response: new(dns.Msg),
+			ValidRRs: []dns.RR{
+				newCNAME("WWW.EXAMPLE.COM.", "example.com."),
+				newA("example.com.", 60, "10.0.0.2"),
+				a3,
+				newA("EXAMPLE.COM.", 300, "10.0.0.1"),
+			},
+		}
+
+		merged, err := MergeResponses(first, second)
+		require.NoError(t, err)
+		require.Same(t, first.Query, merged.Query)
+		require.Same(t, first.Response, merged.Response)
+		require.Equal(t, []dns.RR{cname, a1, a2, a3}, merged.ValidRRs)
+		addrs, err := merged.AddrsA()
+		require.NoError(t, err)
+		require.Len(t, addrs, 3)
+	})
+
+	t.Run("SingleResponse", func(t *testing.T) {
+		a1 := newA("example.com.", 300, "10.0.0.1")
+		resp := &Response{
+			Query:    newQuery("example.com.", dns.TypeA, 1),
+			ValidRRs: []dns.RR{a1, a1},
+		}
+		merged, err := MergeResponses(resp)
+		require.NoError(t, err)
+		require.Equal(t, []dns.RR{a1}, merged.ValidRRs)
+	})
+
+	t.Run("Failures", func(t *testing.T) {
+		tests := []struct {
+			name  string
+			resps []*Response
+		}{
+			{
+				name:  "NoResponses",
+				resps: nil,
+			},
+
+			{
+				name:  "NilResponse",
+				resps: []*Response{nil},
+			},
+
+			{
+				name:  "NilQuery",
+				resps: []*Response{{}},
+			},
+
+			{
+				name: "DistinctNames",
+				resps: []*Response{
+					{Query: newQuery("example.com.", dns.TypeA, 1)},
+					{Query: newQuery("example.org.", dns.TypeA, 1)},
+				},
+			},
+
+			{
+				name: "DistinctTypes",
+				resps: []*Response{
+					{Query: newQuery("example.com.", dns.TypeA, 1)},
+					{Query: newQuery("example.com.", dns.TypeAAAA, 1)},
+				},
+			},
+
+			{
+				name: "InvalidSecondQuery",
+				resps: []*Response{
+					{Query: newQuery("example.com.", dns.TypeA, 1)},
+					{Query: new(dns.Msg)},
+				},
+			},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				merged, err := MergeResponses(tt.resps...)
+				require.ErrorIs(t, err, ErrInvalidQuery)
+				require.Nil(t, merged)
+			})
+		}
+	})
+}
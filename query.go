@@ -8,6 +8,15 @@
 package dnscodec
 
 import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"slices"
+	"strings"
+
 	"github.com/miekg/dns"
 	"golang.org/x/net/idna"
 )
@@ -18,6 +27,59 @@ const (
 
 	// QueryFlagDNSSec enables requesting for DNSSEC signatures.
 	QueryFlagDNSSec
+
+	// QueryFlag0x20Randomize enables randomizing the case of the ASCII
+	// letters in the query name (draft-vixie-dnsext-dns0x20).
+	//
+	// The randomization happens after IDNA encoding, therefore it only
+	// applies to ASCII labels and to the ASCII form of IDNA labels. Use
+	// [ValidateResponse0x20] to check whether the response preserves the case.
+	QueryFlag0x20Randomize
+
+	// QueryFlagNoRecursion disables setting the RD bit.
+	//
+	// By default, the RD bit is set. Use this flag when querying
+	// authoritative servers directly, so that they return referrals in
+	// the authority section rather than attempting recursion.
+	QueryFlagNoRecursion
+
+	// QueryFlagCheckingDisabled enables setting the CD bit.
+	//
+	// The CD bit only affects validating resolvers, which return data
+	// even when DNSSEC validation fails. This flag is independent of the DO
+	// bit set by [QueryFlagDNSSec], which is usually also needed to obtain
+	// the signatures for analyzing the returned data.
+	QueryFlagCheckingDisabled
+
+	// QueryFlagRequestNSID enables requesting the name server
+	// identifier (RFC5001). Use [*Response.NSID] to read it back.
+	QueryFlagRequestNSID
+
+	// QueryFlagRequestKeepalive enables signaling support for the
+	// EDNS(0) TCP keepalive option (RFC7828), which is only meaningful
+	// for queries sent over TCP or TLS. Use [*Response.KeepaliveTimeout]
+	// to read the idle timeout advertised by the server.
+	QueryFlagRequestKeepalive
+
+	// QueryFlagNoEDNS disables EDNS(0), such that the query does not
+	// include an OPT record and the response size is limited to 512
+	// octets (RFC1035 section 4.2.1). This is useful to probe servers
+	// and middleboxes that do not support EDNS(0).
+	//
+	// Because they require an OPT record, combining this flag with
+	// [QueryFlagBlockLengthPadding], [QueryFlagDNSSec],
+	// [QueryFlagRequestNSID], [QueryFlagRequestKeepalive], or with
+	// EDNS(0) options causes [*Query.NewMsg] to fail with
+	// [ErrEDNSRequired].
+	QueryFlagNoEDNS
+
+	// QueryFlagAuthenticData enables setting the AD bit, which asks the
+	// resolver to report whether it validated the answer (RFC6840 section
+	// 5.7). Use [*Response.IsAuthenticatedData] to read the AD bit.
+	//
+	// This flag does not cause any local DNSSEC validation: the AD bit
+	// in the response is only as trustworthy as the path to the resolver.
+	QueryFlagAuthenticData
 )
 
 const (
@@ -30,6 +92,35 @@ const (
 	QueryMaxResponseSizeTCP = 4096
 )
 
+// Errors emitted by [*Query.NewMsg].
+var (
+	// ErrInvalidECSAddress indicates that the ECS address is neither IPv4 nor IPv6.
+	ErrInvalidECSAddress = errors.New("invalid ECS address")
+
+	// ErrInvalidClientCookie indicates that the client cookie is not 8 bytes long.
+	ErrInvalidClientCookie = errors.New("invalid client cookie")
+
+	// ErrInvalidServerCookie indicates that the server cookie is not between
+	// 8 and 32 bytes long or that it is set without a client cookie.
+	ErrInvalidServerCookie = errors.New("invalid server cookie")
+
+	// ErrInvalidECSPrefixLen indicates that the ECS prefix length is out
+	// of range for the address family of the ECS address.
+	ErrInvalidECSPrefixLen = errors.New("invalid ECS prefix length")
+
+	// ErrNameTooLong indicates that the encoded query name exceeds
+	// the 255 octets limit defined by RFC1035 section 2.3.4.
+	ErrNameTooLong = errors.New("query name too long")
+
+	// ErrLabelTooLong indicates that a label of the encoded query name
+	// exceeds the 63 octets limit defined by RFC1035 section 2.3.4.
+	ErrLabelTooLong = errors.New("query name label too long")
+
+	// ErrEDNSRequired indicates that the query uses [QueryFlagNoEDNS]
+	// along with flags or options requiring EDNS(0).
+	ErrEDNSRequired = errors.New("query requires EDNS(0)")
+)
+
 // Query is a DNS query.
 //
 // This struct contain private fields used by the transports
@@ -37,14 +128,54 @@ const (
 //
 // Construct using [NewQuery] or set the MANDATORY fields.
 type Query struct {
+	// Class is the OPTIONAL query class.
+	//
+	// When zero, we use [dns.ClassINET]. Use [dns.ClassCHAOS] for
+	// server fingerprinting queries (e.g., version.bind TXT).
+	Class uint16
+
+	// ClientCookie is the OPTIONAL 8-byte DNS client cookie (RFC7873).
+	//
+	// When set, the query includes a cookie option containing it.
+	ClientCookie []byte
+
 	// Flags OPTIONALLY modify the query flags.
 	//
-	// Use [QueryFlagBlockLengthPadding] and [QueryFlagDNSSec].
+	// Use a bitwise OR of the QueryFlag* constants (e.g.,
+	// [QueryFlagDNSSec] or [QueryFlag0x20Randomize]).
 	Flags uint16
 
+	// ECSAddress is the OPTIONAL EDNS Client Subnet (RFC7871) address.
+	//
+	// When set, the query includes an ECS option whose address is
+	// masked to [Query.ECSPrefixLen] bits to avoid leaking extra bits.
+	ECSAddress net.IP
+
+	// ECSPrefixLen is the OPTIONAL ECS source prefix length.
+	//
+	// It must not exceed 32 for IPv4 and 128 for IPv6.
+	ECSPrefixLen uint8
+
+	// ExtraOptions contains OPTIONAL additional EDNS(0) options.
+	//
+	// Use this field to include options that this package does not
+	// natively support (e.g., [*dns.EDNS0_LOCAL]). They are emitted after
+	// the standard options, in slice order, but before the RFC8467 padding
+	// option, such that the padding accounts for them. [Query.OptionsOrder]
+	// applies to them as well. The options are not copied, so do not
+	// modify them while they are in use by a query.
+	ExtraOptions []dns.EDNS0
+
 	// ID is the OPTIONAL query ID.
 	ID uint16
 
+	// IDNAProfile is the OPTIONAL IDNA profile used to encode the name.
+	//
+	// When nil, we use [idna.Lookup], which rejects some names that
+	// resolvers accept (e.g., legacy hostnames). Use [idna.Registration],
+	// [idna.Punycode], or a custom profile for more lenient encoding.
+	IDNAProfile *idna.Profile
+
 	// MaxSize is the OPTIONAL maximum response size
 	// to include in the query using EDNS(0).
 	//
@@ -54,76 +185,784 @@ type Query struct {
 	// Name is the MANDATORY domain name to query.
 	Name string
 
+	// OptionsOrder OPTIONALLY controls the order of the EDNS(0) options.
+	//
+	// Options whose code appears in this list are emitted first, in the
+	// list order, followed by the remaining options in the default order.
+	// By default, the RFC8467 padding option is the last option.
+	OptionsOrder []uint16
+
+	// ServerCookie is the OPTIONAL 8-to-32-byte DNS server cookie (RFC7873).
+	//
+	// When set along with [Query.ClientCookie], the cookie option also
+	// contains the server cookie, as clients should echo the server cookie
+	// they previously received (RFC7873 section 5.1). The server cookie is
+	// the part following the first 8 bytes of [*Response.ServerCookie].
+	ServerCookie []byte
+
+	// PaddingBlockSize is the OPTIONAL block size used by [QueryFlagBlockLengthPadding].
+	//
+	// When zero, we use the 128 octets block size recommended for
+	// clients by RFC8467 section 4.1. Any nonzero value is valid,
+	// including values that are not a power of two (e.g., the 468
+	// octets block size recommended for servers).
+	PaddingBlockSize uint16
+
 	// Type is the query type.
 	Type uint16
 }
 
+// QueryOption is an option for [NewQuery].
+type QueryOption func(q *Query)
+
+// WithID sets the [Query.ID] field.
+func WithID(id uint16) QueryOption {
+	return func(q *Query) {
+		q.ID = id
+	}
+}
+
+// WithMaxSize sets the [Query.MaxSize] field.
+func WithMaxSize(size uint16) QueryOption {
+	return func(q *Query) {
+		q.MaxSize = size
+	}
+}
+
+// WithDNSSEC sets the [QueryFlagDNSSec] flag.
+func WithDNSSEC() QueryOption {
+	return func(q *Query) {
+		q.Flags |= QueryFlagDNSSec
+	}
+}
+
+// WithPadding sets the [QueryFlagBlockLengthPadding] flag.
+func WithPadding() QueryOption {
+	return func(q *Query) {
+		q.Flags |= QueryFlagBlockLengthPadding
+	}
+}
+
+// IDGenerator generates the query IDs used by [NewQuery], [NewQueries],
+// and [*Query.DualStack]. The default is [dns.Id], which returns a
+// cryptographically random ID, and production code should not change it.
+//
+// Tests and deterministic tooling may override it, but should do so before
+// constructing queries, since the variable itself is not protected by a lock.
+// Concurrent calls to [NewQuery] are safe as long as the generator is.
+var IDGenerator func() uint16 = dns.Id
+
+// queryDistinctID returns an ID generated using [IDGenerator] for which
+// used returns false. When the generator keeps returning used IDs (e.g.,
+// because it is deterministic), we fall back to incrementing the last ID.
+func queryDistinctID(used func(id uint16) bool) uint16 {
+	id := IDGenerator()
+	for attempt := 0; attempt < 16 && used(id); attempt++ {
+		id = IDGenerator()
+	}
+	for used(id) {
+		id++
+	}
+	return id
+}
+
 // NewQuery constructs a new [*Query] with safe defaults.
 //
-// By default, the query uses a randomized ID, requests recursion, and uses
-// [QueryMaxResponseSizeUDP] as the EDNS(0) maximum response size.
-func NewQuery(name string, qtype uint16) *Query {
-	return &Query{
+// By default, the query uses a randomized ID obtained from [IDGenerator],
+// requests recursion, and uses [QueryMaxResponseSizeUDP] as the EDNS(0)
+// maximum response size.
+//
+// The options are applied in order after setting the defaults, therefore
+// options applied later override options applied earlier.
+func NewQuery(name string, qtype uint16, options ...QueryOption) *Query {
+	q := &Query{
+		Class:   dns.ClassINET,
 		Name:    name,
 		Type:    qtype,
 		Flags:   0,
-		ID:      dns.Id(),
+		ID:      IDGenerator(),
 		MaxSize: QueryMaxResponseSizeUDP,
 	}
+	for _, option := range options {
+		option(q)
+	}
+	return q
+}
+
+// NewQueries constructs a new [*Query] for each of the given types.
+//
+// The queries share the name and use the defaults used by [NewQuery],
+// except that each query has a fresh random ID and all the IDs are
+// guaranteed to differ, such that responses could be matched to the
+// right query when sending the queries concurrently.
+//
+// This function validates the name once before constructing the queries,
+// and returns an error if [*Query.NewMsg] would reject the name.
+func NewQueries(name string, qtypes ...uint16) ([]*Query, error) {
+	probe := &Query{Name: name}
+	punyName, err := probe.IDNAEncodedName()
+	if err != nil {
+		return nil, err
+	}
+	if err := queryValidateNameLength(dns.Fqdn(punyName)); err != nil {
+		return nil, err
+	}
+	queries := make([]*Query, 0, len(qtypes))
+	ids := make(map[uint16]bool, len(qtypes))
+	for _, qtype := range qtypes {
+		q := NewQuery(name, qtype)
+		if ids[q.ID] {
+			q.ID = queryDistinctID(func(id uint16) bool { return ids[id] })
+		}
+		ids[q.ID] = true
+		queries = append(queries, q)
+	}
+	return queries, nil
+}
+
+// NewQueryPTR constructs a new PTR [*Query] for reverse resolving the given IP address.
+//
+// The query name is the `.in-addr.arpa.` or `.ip6.arpa.` name obtained using
+// [dns.ReverseAddr] and the defaults are the same used by [NewQuery]. This
+// function fails if the IP address is nil or otherwise invalid.
+func NewQueryPTR(ip net.IP) (*Query, error) {
+	name, err := dns.ReverseAddr(ip.String())
+	if err != nil {
+		return nil, err
+	}
+	return NewQuery(name, dns.TypePTR), nil
+}
+
+// NewQueryTLSA constructs a new TLSA [*Query] for DANE (RFC6698).
+//
+// The query name is `_port._proto.name` (e.g., `_443._tcp.example.com`
+// for port 443 and proto "tcp") as documented by RFC6698 section 3 and
+// the defaults are the same used by [NewQuery].
+func NewQueryTLSA(port uint16, proto, name string) *Query {
+	return NewQuery(fmt.Sprintf("_%d._%s.%s", port, proto, name), dns.TypeTLSA)
+}
+
+// NewQuerySRV constructs a new SRV [*Query] for service discovery (RFC2782).
+//
+// The query name is `_service._proto.name` (e.g., `_xmpp-client._tcp.example.com`
+// for service "xmpp-client" and proto "tcp") and the defaults are the
+// same used by [NewQuery].
+func NewQuerySRV(service, proto, name string) *Query {
+	return NewQuery(fmt.Sprintf("_%s._%s.%s", service, proto, name), dns.TypeSRV)
+}
+
+// NewQueryANY constructs a new ANY [*Query] for diagnostics purposes.
+//
+// The defaults are the same used by [NewQuery]. Note that RFC8482 allows
+// servers to answer ANY queries with a minimal response, usually a single
+// HINFO record or a subset of the available RRsets, and many servers do
+// so. Parsing the response using [WithWarnings] flags minimal responses.
+func NewQueryANY(name string) *Query {
+	return NewQuery(name, dns.TypeANY)
+}
+
+// QueryProfile is a preset of query settings and response
+// interpretation rules suitable for a specific resolver persona.
+type QueryProfile int
+
+const (
+	// ProfileStub is the profile of a stub resolver querying a recursive
+	// resolver: the query sets the RD bit and [ParseResponse] uses
+	// the default response interpretation rules.
+	ProfileStub = QueryProfile(iota)
+
+	// ProfileIterative is the profile of an iterative resolver querying
+	// authoritative servers: the query does not set the RD bit and
+	// [ParseResponse] accepts referrals as with [WithReferrals].
+	ProfileIterative
+
+	// ProfileAuthoritativeProbe is the profile of a measurement tool
+	// probing an authoritative server: the query does not set the RD bit
+	// and [ParseResponse] fails with [ErrNotAuthoritative] unless the
+	// response has the AA bit set.
+	ProfileAuthoritativeProbe
+)
+
+// NewQueryWithProfile is like [NewQuery] but presets the query
+// settings according to the given [QueryProfile].
+//
+// Use [WithProfile] to have [ParseResponse] interpret the
+// response according to the same profile.
+func NewQueryWithProfile(name string, qtype uint16, profile QueryProfile, options ...QueryOption) *Query {
+	q := NewQuery(name, qtype)
+	switch profile {
+	case ProfileIterative, ProfileAuthoritativeProbe:
+		q.Flags |= QueryFlagNoRecursion
+	}
+	for _, option := range options {
+		option(q)
+	}
+	return q
+}
+
+// NewQueryFromMsg constructs a new [*Query] from an existing [*dns.Msg].
+//
+// This allows using messages constructed by other libraries along
+// with the rest of this package (e.g., [*Query.Clone], [ParseResponse]).
+// We copy the question name, type, and class, the ID, the RD, CD, and
+// AD bits, and, when the message has an OPT record, the maximum size,
+// the DO bit, and the supported EDNS(0) options, whose order we save
+// into [Query.OptionsOrder]. We split the cookie option, if any, into
+// [Query.ClientCookie] and [Query.ServerCookie], so that the full cookie
+// is echoed back. When the message has no OPT record, we set
+// [QueryFlagNoEDNS]. We save unsupported EDNS(0) options into
+// [Query.ExtraOptions] without copying them and we do not preserve
+// the padding length, which [*Query.NewMsg] recomputes.
+//
+// This function returns [ErrInvalidQuery] if msg does not contain
+// exactly one question or contains an invalid cookie option.
+func NewQueryFromMsg(msg *dns.Msg) (*Query, error) {
+	if len(msg.Question) != 1 {
+		return nil, ErrInvalidQuery
+	}
+	q0 := msg.Question[0]
+	q := &Query{
+		Class: q0.Qclass,
+		ID:    msg.Id,
+		Name:  q0.Name,
+		Type:  q0.Qtype,
+	}
+	if !msg.RecursionDesired {
+		q.Flags |= QueryFlagNoRecursion
+	}
+	if msg.CheckingDisabled {
+		q.Flags |= QueryFlagCheckingDisabled
+	}
+	if msg.AuthenticatedData {
+		q.Flags |= QueryFlagAuthenticData
+	}
+
+	opt := msg.IsEdns0()
+	if opt == nil {
+		q.Flags |= QueryFlagNoEDNS
+		return q, nil
+	}
+	q.MaxSize = opt.UDPSize()
+	if opt.Do() {
+		q.Flags |= QueryFlagDNSSec
+	}
+	for _, option := range opt.Option {
+		switch option := option.(type) {
+		case *dns.EDNS0_SUBNET:
+			q.ECSAddress = slices.Clone(option.Address)
+			q.ECSPrefixLen = option.SourceNetmask
+		case *dns.EDNS0_COOKIE:
+			// RFC7873 section 4: the client cookie is the first 8 octets
+			// and the optional server cookie is 8 to 32 octets long
+			cookie, err := hex.DecodeString(option.Cookie)
+			if err != nil || (len(cookie) != 8 && (len(cookie) < 16 || len(cookie) > 40)) {
+				return nil, fmt.Errorf("%w: invalid cookie", ErrInvalidQuery)
+			}
+			q.ClientCookie = cookie[:8:8]
+			if len(cookie) > 8 {
+				q.ServerCookie = cookie[8:]
+			}
+		case *dns.EDNS0_NSID:
+			q.Flags |= QueryFlagRequestNSID
+		case *dns.EDNS0_TCP_KEEPALIVE:
+			q.Flags |= QueryFlagRequestKeepalive
+		case *dns.EDNS0_PADDING:
+			q.Flags |= QueryFlagBlockLengthPadding
+		default:
+			q.ExtraOptions = append(q.ExtraOptions, option)
+		}
+		q.OptionsOrder = append(q.OptionsOrder, option.Option())
+	}
+	return q, nil
 }
 
 // Clone returns a deep copy of the query.
+//
+// The copy has the same ID of the original query. Assign a new ID
+// (e.g., using [IDGenerator]) when the copy is a distinct query rather
+// than a retransmission (see also [*Query.Retransmit]).
 func (q *Query) Clone() *Query {
 	return &Query{
-		Name:    q.Name,
-		Type:    q.Type,
-		Flags:   q.Flags,
-		ID:      q.ID,
-		MaxSize: q.MaxSize,
+		Class:            q.Class,
+		Name:             q.Name,
+		Type:             q.Type,
+		Flags:            q.Flags,
+		ID:               q.ID,
+		IDNAProfile:      q.IDNAProfile,
+		MaxSize:          q.MaxSize,
+		OptionsOrder:     slices.Clone(q.OptionsOrder),
+		ECSAddress:       slices.Clone(q.ECSAddress),
+		ECSPrefixLen:     q.ECSPrefixLen,
+		ExtraOptions:     slices.Clone(q.ExtraOptions),
+		ClientCookie:     slices.Clone(q.ClientCookie),
+		ServerCookie:     slices.Clone(q.ServerCookie),
+		PaddingBlockSize: q.PaddingBlockSize,
+	}
+}
+
+// Retransmit returns a copy of the query suitable for retransmitting it.
+//
+// A retransmission MUST use the same ID and question of the original
+// query (RFC1035 section 7.1), such that a late response to any
+// transmission matches. Therefore, unlike [NewQuery], which generates
+// a fresh random ID, this method preserves the ID.
+//
+// When using [QueryFlag0x20Randomize], each call to [*Query.NewMsg]
+// randomizes the case of the name again, so that a late response to
+// a previous transmission fails [ValidateResponse0x20]. In such a case,
+// retransmit the message built for the first transmission instead.
+func (q *Query) Retransmit() *Query {
+	return q.Clone()
+}
+
+// DualStack returns two clones of the query for the A and AAAA types.
+//
+// Each clone has a fresh random ID and the two IDs are guaranteed to
+// differ, such that responses could be matched to the right query.
+// All the other settings are copied from the original query.
+func (q *Query) DualStack() (a *Query, aaaa *Query) {
+	a, aaaa = q.Clone(), q.Clone()
+	a.Type, aaaa.Type = dns.TypeA, dns.TypeAAAA
+	a.ID = IDGenerator()
+	aaaa.ID = queryDistinctID(func(id uint16) bool { return id == a.ID })
+	return
+}
+
+// class returns the query class, defaulting to [dns.ClassINET].
+func (q *Query) class() uint16 {
+	if q.Class == 0 {
+		return dns.ClassINET
+	}
+	return q.Class
+}
+
+// String returns a human-readable summary of the query suitable for
+// logging, e.g., "www.example.com. IN A (id=37, edns=1232, flags=do,pad)".
+// With [QueryFlagNoEDNS], the summary contains "edns=off" instead.
+//
+// This method does not build the query message, therefore it is cheaper
+// than [*Query.NewMsg] and never fails. The name is not IDNA encoded.
+func (q *Query) String() string {
+	var flags []string
+	for _, entry := range queryFlagNames {
+		if q.Flags&entry.flag != 0 {
+			flags = append(flags, entry.name)
+		}
+	}
+	edns := fmt.Sprint(q.MaxSize)
+	if q.Flags&QueryFlagNoEDNS != 0 {
+		edns = "off"
+	}
+	out := fmt.Sprintf("%s %s %s (id=%d, edns=%s",
+		dns.Fqdn(q.Name), dns.Class(q.class()), dns.Type(q.Type), q.ID, edns)
+	if len(flags) > 0 {
+		out += ", flags=" + strings.Join(flags, ",")
+	}
+	return out + ")"
+}
+
+// queryFlagNames maps the query flags to the names used by [*Query.String].
+var queryFlagNames = []struct {
+	flag uint16
+	name string
+}{
+	{QueryFlagDNSSec, "do"},
+	{QueryFlagBlockLengthPadding, "pad"},
+	{QueryFlag0x20Randomize, "0x20"},
+	{QueryFlagNoRecursion, "nord"},
+	{QueryFlagCheckingDisabled, "cd"},
+	{QueryFlagRequestNSID, "nsid"},
+	{QueryFlagRequestKeepalive, "keepalive"},
+	{QueryFlagAuthenticData, "ad"},
+}
+
+// IDNAEncodedName returns the result of IDNA encoding the query name.
+//
+// This method performs the same IDNA encoding applied by [*Query.NewMsg]
+// without building the whole message, thus allowing callers to know in
+// advance whether (and why) the name would be rejected.
+//
+// The leading underscore-prefixed labels (e.g., "_443._tcp" or "_dmarc")
+// are passed through without IDNA encoding when they only contain ASCII
+// letters, digits, hyphens, and underscores, because [idna.Lookup] rejects
+// underscores, which are nonetheless legal in service labels (RFC8552).
+// The remaining labels are IDNA encoded as usual.
+//
+// The returned name is not necessarily fully qualified.
+func (q *Query) IDNAEncodedName() (string, error) {
+	profile := q.IDNAProfile
+	if profile == nil {
+		profile = idna.Lookup
+	}
+	prefix, rest := querySplitUnderscoreLabels(q.Name)
+	if rest == "" || rest == "." {
+		return prefix + rest, nil
+	}
+	name, err := profile.ToASCII(rest)
+	if err != nil {
+		return "", err
 	}
+	return prefix + name, nil
+}
+
+// querySplitUnderscoreLabels splits name into the prefix containing the
+// leading underscore-prefixed labels, including their trailing dots, and
+// the rest of the name. Only labels containing ASCII letters, digits,
+// hyphens, and underscores are considered part of the prefix.
+func querySplitUnderscoreLabels(name string) (prefix, rest string) {
+	rest = name
+	for strings.HasPrefix(rest, "_") {
+		label, tail, found := strings.Cut(rest, ".")
+		if !queryIsUnderscoreLabel(label) {
+			break
+		}
+		if !found {
+			return name, ""
+		}
+		rest = tail
+	}
+	return name[:len(name)-len(rest)], rest
+}
+
+// queryIsUnderscoreLabel returns whether label is an underscore-prefixed
+// label only containing ASCII letters, digits, hyphens, and underscores.
+func queryIsUnderscoreLabel(label string) bool {
+	if !strings.HasPrefix(label, "_") {
+		return false
+	}
+	for _, c := range []byte(label) {
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9', c == '-', c == '_':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// ASCIIName returns the fully qualified ASCII name used on the wire.
+//
+// Unlike [*Query.IDNAEncodedName], the returned name is fully qualified
+// and validated against the RFC1035 length limits, exactly as done by
+// [*Query.NewMsg], but without the [QueryFlag0x20Randomize] randomization.
+// Names that are already ASCII are not modified except for becoming
+// fully qualified. Use [ResponseUnicodeName] for the reverse mapping.
+func (q *Query) ASCIIName() (string, error) {
+	name, err := q.IDNAEncodedName()
+	if err != nil {
+		return "", err
+	}
+	name = dns.Fqdn(name)
+	if err := queryValidateNameLength(name); err != nil {
+		return "", err
+	}
+	return name, nil
 }
 
 // NewMsg creates a new [*dns.Msg] from the [*Query].
 func (q *Query) NewMsg() (*dns.Msg, error) {
-	// IDNA encode the domain name.
-	punyName, err := idna.Lookup.ToASCII(q.Name)
+	msg := new(dns.Msg)
+	if err := q.FillMsg(msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// EDNSOptions returns the EDNS(0) options that [*Query.NewMsg] attaches
+// to the message (e.g., ECS, cookie, NSID, [Query.ExtraOptions], and
+// padding), in wire order, given the current query fields and flags.
+//
+// To stay in sync with [*Query.NewMsg], and because the padding length
+// depends on the whole message length, this method builds the message
+// internally and returns its options. Note that the DO bit requested
+// by [QueryFlagDNSSec] is part of the OPT record header rather than an
+// option, so it is not included. This method returns nil options when
+// the query uses [QueryFlagNoEDNS] and the same error that
+// [*Query.NewMsg] would return when the query is invalid.
+func (q *Query) EDNSOptions() ([]dns.EDNS0, error) {
+	msg, err := q.NewMsg()
 	if err != nil {
 		return nil, err
 	}
+	opt := msg.IsEdns0()
+	if opt == nil {
+		return nil, nil
+	}
+	return opt.Option, nil
+}
+
+// Pack creates a new [*dns.Msg] from the [*Query] and serializes it.
+//
+// Because the padding computed by [*Query.NewMsg] depends on the message
+// length, prefer this method to packing the message yourself, since any
+// change to the message before packing could invalidate the padding.
+func (q *Query) Pack() ([]byte, error) {
+	msg, err := q.NewMsg()
+	if err != nil {
+		return nil, err
+	}
+	return msg.Pack()
+}
+
+// NewReplyMsg creates a reply to the given query message containing
+// the given answer RRs.
+//
+// This function is mainly useful to build test fixtures. Pass the query
+// message that was actually sent (e.g., the one returned by [*Query.NewMsg]),
+// since building a new message would randomize again the case of the name
+// when using [QueryFlag0x20Randomize]. The reply is built using
+// [*dns.Msg.SetReply], thus it passes [ValidateResponseForQuery] and
+// [ValidateResponse0x20] against the query message. The reply sets the RA
+// bit when the query sets the RD bit, like a recursive resolver would.
+//
+// When the query contains an OPT record, the reply contains an OPT record
+// with the same DO bit and the given EDNS(0) UDP buffer size, or the UDP
+// buffer size of the query when udpSize is zero.
+func NewReplyMsg(query *dns.Msg, udpSize uint16, rrs ...dns.RR) *dns.Msg {
+	reply := new(dns.Msg)
+	reply.SetReply(query)
+	reply.RecursionAvailable = query.RecursionDesired
+	reply.CheckingDisabled = query.CheckingDisabled
+	reply.Answer = append(reply.Answer, rrs...)
+	if opt := query.IsEdns0(); opt != nil {
+		if udpSize == 0 {
+			udpSize = opt.UDPSize()
+		}
+		reply.SetEdns0(udpSize, opt.Do())
+	}
+	return reply
+}
+
+// PackWithContext is like [*Query.Pack] but first checks whether the
+// context is done, in which case it returns the context error.
+//
+// This method does not perform any I/O: it is a convenience for
+// cancellation-aware callers that should not waste time encoding
+// queries (e.g., performing IDNA processing) that would not be sent.
+func (q *Query) PackWithContext(ctx context.Context) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return q.Pack()
+}
+
+// FillMsg is like [*Query.NewMsg] but fills a caller-provided [*dns.Msg].
+//
+// On success, the previous content of msg is discarded: the header is
+// reset and the question, answer, authority, and additional sections
+// (including any OPT record) are cleared before being populated. The
+// underlying slices are reused to reduce allocations. Therefore, the
+// resulting message always contains exactly one question.
+//
+// On failure, msg is left unmodified.
+func (q *Query) FillMsg(msg *dns.Msg) error {
+	// IDNA encode the domain name.
+	punyName, err := q.IDNAEncodedName()
+	if err != nil {
+		return err
+	}
+
+	// Create the EDNS(0) options before touching msg.
+	var options []dns.EDNS0
+	if q.ECSAddress != nil {
+		ecs, err := q.newECSOption()
+		if err != nil {
+			return err
+		}
+		options = append(options, ecs)
+	}
+	if q.ServerCookie != nil && (q.ClientCookie == nil || len(q.ServerCookie) < 8 || len(q.ServerCookie) > 32) {
+		return ErrInvalidServerCookie
+	}
+	if q.ClientCookie != nil {
+		if len(q.ClientCookie) != 8 {
+			return ErrInvalidClientCookie
+		}
+		cookie := &dns.EDNS0_COOKIE{
+			Code:   dns.EDNS0COOKIE,
+			Cookie: hex.EncodeToString(q.ClientCookie) + hex.EncodeToString(q.ServerCookie),
+		}
+		options = append(options, cookie)
+	}
+	if q.Flags&QueryFlagRequestNSID != 0 {
+		options = append(options, &dns.EDNS0_NSID{Code: dns.EDNS0NSID})
+	}
+	if q.Flags&QueryFlagRequestKeepalive != 0 {
+		// RFC7828 section 3.2.1: clients MUST NOT include a timeout
+		options = append(options, &dns.EDNS0_TCP_KEEPALIVE{Code: dns.EDNS0TCPKEEPALIVE})
+	}
+	options = append(options, q.ExtraOptions...)
+	const ednsFlags = QueryFlagBlockLengthPadding | QueryFlagDNSSec
+	if q.Flags&QueryFlagNoEDNS != 0 && (q.Flags&ednsFlags != 0 || len(options) > 0) {
+		return ErrEDNSRequired
+	}
 
 	// Ensure the domain name is fully qualified.
 	if !dns.IsFqdn(punyName) {
 		punyName = dns.Fqdn(punyName)
 	}
 
+	// Ensure the domain name does not exceed the RFC1035 limits.
+	if err := queryValidateNameLength(punyName); err != nil {
+		return err
+	}
+
+	// Randomize the case of the domain name, if needed.
+	if q.Flags&QueryFlag0x20Randomize != 0 {
+		punyName = query0x20Randomize(punyName, rand.Uint64)
+	}
+
 	// Create the query message.
 	question := dns.Question{
 		Name:   punyName,
 		Qtype:  q.Type,
-		Qclass: dns.ClassINET,
+		Qclass: q.class(),
 	}
-	msg := new(dns.Msg)
+	queryResetMsg(msg)
 	msg.Id = q.ID
-	msg.RecursionDesired = true
-	msg.Question = make([]dns.Question, 1)
-	msg.Question[0] = question
+	msg.RecursionDesired = q.Flags&QueryFlagNoRecursion == 0
+	msg.CheckingDisabled = q.Flags&QueryFlagCheckingDisabled != 0
+	msg.AuthenticatedData = q.Flags&QueryFlagAuthenticData != 0
+	msg.Question = append(msg.Question, question)
+	if q.Flags&QueryFlagNoEDNS != 0 {
+		return nil
+	}
 
 	// Set the EDNS(0) query options
 	msg.SetEdns0(q.MaxSize, q.Flags&QueryFlagDNSSec != 0)
+	msg.IsEdns0().Option = append(msg.IsEdns0().Option, options...)
 
 	// Clients SHOULD pad queries to the closest multiple of
-	// 128 octets RFC8467#section-4.1. We inflate the query
+	// 128 octets RFC8467#section-4.1, unless the caller has
+	// chosen a different block size. We inflate the query
 	// length by the size of the option (i.e. 4 octets). The
-	// cast to uint is necessary to make the modulus operation
-	// work as intended when the desiredBlockSize is smaller
-	// than (query.Len()+4) ¯\_(ツ)_/¯.
+	// outer modulus avoids adding a whole block of padding when
+	// the query length is already a multiple of the block size.
 	if q.Flags&QueryFlagBlockLengthPadding != 0 {
-		const desiredSize = 128
-		remainder := (desiredSize - uint16(msg.Len()+4)) % desiredSize
+		blockSize := int(q.PaddingBlockSize)
+		if blockSize <= 0 {
+			blockSize = 128
+		}
+		remainder := (blockSize - (msg.Len()+4)%blockSize) % blockSize
 		opt := new(dns.EDNS0_PADDING)
 		opt.Padding = make([]byte, remainder)
 		msg.IsEdns0().Option = append(msg.IsEdns0().Option, opt)
 	}
 
-	return msg, nil
+	// Honor the EDNS(0) options order requested by the caller.
+	msg.IsEdns0().Option = queryOrderOptions(msg.IsEdns0().Option, q.OptionsOrder)
+
+	return nil
+}
+
+// newECSOption creates the EDNS Client Subnet option.
+func (q *Query) newECSOption() (*dns.EDNS0_SUBNET, error) {
+	var (
+		family uint16
+		addr   net.IP
+		bits   int
+	)
+	switch {
+	case q.ECSAddress.To4() != nil:
+		family, addr, bits = 1, q.ECSAddress.To4(), 8*net.IPv4len
+	case len(q.ECSAddress) == net.IPv6len:
+		family, addr, bits = 2, q.ECSAddress, 8*net.IPv6len
+	default:
+		return nil, ErrInvalidECSAddress
+	}
+	if int(q.ECSPrefixLen) > bits {
+		return nil, ErrInvalidECSPrefixLen
+	}
+	ecs := &dns.EDNS0_SUBNET{
+		Code:          dns.EDNS0SUBNET,
+		Family:        family,
+		SourceNetmask: q.ECSPrefixLen,
+		SourceScope:   0,
+		Address:       addr.Mask(net.CIDRMask(int(q.ECSPrefixLen), bits)),
+	}
+	return ecs, nil
+}
+
+// queryValidateNameLength ensures that the given fully-qualified name
+// does not exceed the limits defined by RFC1035 section 2.3.4.
+func queryValidateNameLength(name string) error {
+	wireLength := 1 // the root label
+	for _, label := range dns.SplitDomainName(name) {
+		if len(label) > 63 {
+			return fmt.Errorf("%w: %q", ErrLabelTooLong, label)
+		}
+		wireLength += len(label) + 1
+	}
+	if wireLength > 255 {
+		return fmt.Errorf("%w: %d octets", ErrNameTooLong, wireLength)
+	}
+	return nil
+}
+
+// query0x20Randomize randomizes the case of the ASCII letters
+// in name consuming the random bits returned by uint64fn.
+func query0x20Randomize(name string, uint64fn func() uint64) string {
+	out := []byte(name)
+	var (
+		bits  uint64
+		avail int
+	)
+	for idx, ch := range out {
+		lower := ch | 0x20
+		if lower < 'a' || lower > 'z' {
+			continue
+		}
+		if avail <= 0 {
+			bits, avail = uint64fn(), 64
+		}
+		if bits&1 != 0 {
+			out[idx] = lower &^ 0x20
+		} else {
+			out[idx] = lower
+		}
+		bits, avail = bits>>1, avail-1
+	}
+	return string(out)
+}
+
+// queryOrderOptions returns the options sorted according to the given order.
+//
+// Options whose code appears in order come first, in the order specified by
+// order, while the other options follow. Options with the same code retain
+// their relative order. An empty order returns the options unmodified.
+func queryOrderOptions(options []dns.EDNS0, order []uint16) []dns.EDNS0 {
+	if len(order) <= 0 {
+		return options
+	}
+	out := make([]dns.EDNS0, 0, len(options))
+	for idx, code := range order {
+		if slices.Contains(order[:idx], code) {
+			continue // avoid emitting options twice
+		}
+		for _, option := range options {
+			if option.Option() == code {
+				out = append(out, option)
+			}
+		}
+	}
+	for _, option := range options {
+		if !slices.Contains(order, option.Option()) {
+			out = append(out, option)
+		}
+	}
+	return out
+}
+
+// queryResetMsg resets msg while reusing the backing arrays of its sections.
+func queryResetMsg(msg *dns.Msg) {
+	clear(msg.Question)
+	clear(msg.Answer)
+	clear(msg.Ns)
+	clear(msg.Extra)
+	*msg = dns.Msg{
+		Question: msg.Question[:0],
+		Answer:   msg.Answer[:0],
+		Ns:       msg.Ns[:0],
+		Extra:    msg.Extra[:0],
+	}
 }
@@ -3,20 +3,72 @@
 package dnscodec
 
 import (
+	"context"
+	"math/rand/v2"
+	"net"
+	"strings"
 	"testing"
 
 	"github.com/bassosimone/runtimex"
 	"github.com/miekg/dns"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/net/idna"
 )
 
+func TestNewQueryWithOptions(t *testing.T) {
+	t.Run("Defaults", func(t *testing.T) {
+		query := NewQuery("www.example.com", dns.TypeA)
+		require.Equal(t, "www.example.com", query.Name)
+		require.Equal(t, dns.TypeA, query.Type)
+		require.Equal(t, uint16(dns.ClassINET), query.Class)
+		require.Equal(t, uint16(0), query.Flags)
+		require.Equal(t, uint16(QueryMaxResponseSizeUDP), query.MaxSize)
+	})
+
+	t.Run("AllOptions", func(t *testing.T) {
+		query := NewQuery(
+			"www.example.com",
+			dns.TypeA,
+			WithID(1234),
+			WithMaxSize(QueryMaxResponseSizeTCP),
+			WithDNSSEC(),
+			WithPadding(),
+		)
+		require.Equal(t, uint16(1234), query.ID)
+		require.Equal(t, uint16(QueryMaxResponseSizeTCP), query.MaxSize)
+		require.Equal(t, uint16(QueryFlagDNSSec|QueryFlagBlockLengthPadding), query.Flags)
+	})
+
+	t.Run("LaterOptionsWin", func(t *testing.T) {
+		query := NewQuery(
+			"www.example.com",
+			dns.TypeA,
+			WithID(1234),
+			WithMaxSize(QueryMaxResponseSizeTCP),
+			WithID(5678),
+			WithMaxSize(512),
+		)
+		require.Equal(t, uint16(5678), query.ID)
+		require.Equal(t, uint16(512), query.MaxSize)
+	})
+}
+
 func TestQueryClone(t *testing.T) {
 	query := &Query{
-		Name:    "www.example.com",
-		Type:    dns.TypeA,
-		Flags:   QueryFlagBlockLengthPadding | QueryFlagDNSSec,
-		ID:      1234,
-		MaxSize: QueryMaxResponseSizeTCP,
+		Class:            dns.ClassCHAOS,
+		Name:             "www.example.com",
+		Type:             dns.TypeA,
+		Flags:            QueryFlagBlockLengthPadding | QueryFlagDNSSec,
+		ID:               1234,
+		IDNAProfile:      idna.Registration,
+		MaxSize:          QueryMaxResponseSizeTCP,
+		OptionsOrder:     []uint16{dns.EDNS0PADDING},
+		ECSAddress:       net.ParseIP("130.192.91.211"),
+		ECSPrefixLen:     24,
+		ExtraOptions:     []dns.EDNS0{&dns.EDNS0_NSID{Code: dns.EDNS0NSID}},
+		ClientCookie:     []byte{1, 2, 3, 4, 5, 6, 7, 8},
+		ServerCookie:     []byte{9, 10, 11, 12, 13, 14, 15, 16},
+		PaddingBlockSize: 468,
 	}
 
 	clone := query.Clone()
@@ -24,17 +76,156 @@ func TestQueryClone(t *testing.T) {
 	require.NotSame(t, query, clone)
 	require.Equal(t, query, clone)
 
+	clone.Class = dns.ClassINET
 	clone.Name = "www.example.net"
 	clone.Type = dns.TypeAAAA
 	clone.Flags = 0
 	clone.ID = 5678
 	clone.MaxSize = QueryMaxResponseSizeUDP
+	clone.OptionsOrder[0] = dns.EDNS0COOKIE
+	clone.ECSAddress[15] = 1
+	clone.ECSPrefixLen = 16
+	clone.ExtraOptions[0] = nil
+	clone.ClientCookie[0] = 0
+	clone.ServerCookie[0] = 0
+	clone.PaddingBlockSize = 0
 
+	require.Equal(t, uint16(dns.ClassCHAOS), query.Class)
 	require.Equal(t, "www.example.com", query.Name)
 	require.Equal(t, dns.TypeA, query.Type)
 	require.Equal(t, uint16(QueryFlagBlockLengthPadding|QueryFlagDNSSec), query.Flags)
 	require.Equal(t, uint16(1234), query.ID)
 	require.Equal(t, uint16(QueryMaxResponseSizeTCP), query.MaxSize)
+	require.Equal(t, []uint16{dns.EDNS0PADDING}, query.OptionsOrder)
+	require.Equal(t, net.ParseIP("130.192.91.211"), query.ECSAddress)
+	require.Equal(t, uint8(24), query.ECSPrefixLen)
+	require.Equal(t, []dns.EDNS0{&dns.EDNS0_NSID{Code: dns.EDNS0NSID}}, query.ExtraOptions)
+	require.Equal(t, []byte{1, 2, 3, 4, 5, 6, 7, 8}, query.ClientCookie)
+	require.Equal(t, []byte{9, 10, 11, 12, 13, 14, 15, 16}, query.ServerCookie)
+	require.Equal(t, uint16(468), query.PaddingBlockSize)
+}
+
+func TestQueryRetransmit(t *testing.T) {
+	query := NewQuery("www.example.com", dns.TypeA, WithDNSSEC())
+	retry := query.Retransmit()
+
+	require.NotSame(t, query, retry)
+	require.Equal(t, query, retry)
+	require.Equal(t, query.ID, retry.ID)
+
+	msg := runtimex.PanicOnError1(query.NewMsg())
+	retryMsg := runtimex.PanicOnError1(retry.NewMsg())
+	require.Equal(t, msg.Id, retryMsg.Id)
+	require.Equal(t, msg.Question, retryMsg.Question)
+}
+
+func TestQueryString(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    *Query
+		expected string
+	}{
+		{
+			name:     "Default",
+			query:    NewQuery("www.example.com", dns.TypeA, WithID(37)),
+			expected: "www.example.com. IN A (id=37, edns=1232)",
+		},
+
+		{
+			name:     "WithFlags",
+			query:    NewQuery("www.example.com.", dns.TypeAAAA, WithID(37), WithDNSSEC(), WithPadding()),
+			expected: "www.example.com. IN AAAA (id=37, edns=1232, flags=do,pad)",
+		},
+
+		{
+			name: "NoEDNS",
+			query: &Query{
+				Name:    "www.example.com",
+				Type:    dns.TypeA,
+				ID:      37,
+				MaxSize: QueryMaxResponseSizeUDP,
+				Flags:   QueryFlagNoEDNS | QueryFlagNoRecursion,
+			},
+			expected: "www.example.com. IN A (id=37, edns=off, flags=nord)",
+		},
+
+		{
+			name: "AllFlags",
+			query: &Query{
+				Name:    "example.com",
+				Type:    dns.TypeTXT,
+				ID:      1,
+				MaxSize: QueryMaxResponseSizeTCP,
+				Flags: QueryFlagBlockLengthPadding | QueryFlagDNSSec | QueryFlag0x20Randomize |
+					QueryFlagNoRecursion | QueryFlagCheckingDisabled | QueryFlagRequestNSID |
+					QueryFlagRequestKeepalive | QueryFlagAuthenticData,
+			},
+			expected: "example.com. IN TXT (id=1, edns=4096, flags=do,pad,0x20,nord,cd,nsid,keepalive,ad)",
+		},
+
+		{
+			name: "CHAOS",
+			query: &Query{
+				Class: dns.ClassCHAOS,
+				Name:  "version.bind",
+				Type:  dns.TypeTXT,
+				ID:    37,
+			},
+			expected: "version.bind. CH TXT (id=37, edns=0)",
+		},
+
+		{
+			name:     "EmptyQuery",
+			query:    &Query{},
+			expected: ". IN None (id=0, edns=0)",
+		},
+
+		{
+			name:     "UnknownType",
+			query:    &Query{Name: "example.com", Type: 65280},
+			expected: "example.com. IN TYPE65280 (id=0, edns=0)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.expected, tt.query.String())
+		})
+	}
+}
+
+func TestQueryNewMsgClass(t *testing.T) {
+	t.Run("CHAOS", func(t *testing.T) {
+		query := NewQuery("version.bind.", dns.TypeTXT)
+		query.Class = dns.ClassCHAOS
+		msg := runtimex.PanicOnError1(query.NewMsg())
+		require.Equal(t, []dns.Question{{
+			Name:   "version.bind.",
+			Qtype:  dns.TypeTXT,
+			Qclass: dns.ClassCHAOS,
+		}}, msg.Question)
+
+		// Make sure the response validation accounts for the class
+		resp := new(dns.Msg)
+		resp.SetReply(msg)
+		resp.Answer = []dns.RR{&dns.TXT{
+			Hdr: dns.RR_Header{
+				Name:   "version.bind.",
+				Rrtype: dns.TypeTXT,
+				Class:  dns.ClassCHAOS,
+			},
+			Txt: []string{"9.18.0"},
+		}}
+		parsed, err := ParseResponse(msg, resp)
+		require.NoError(t, err)
+		require.Len(t, parsed.ValidRRs, 1)
+	})
+
+	t.Run("ZeroMeansINET", func(t *testing.T) {
+		query := &Query{Name: "www.example.com", Type: dns.TypeA}
+		msg := runtimex.PanicOnError1(query.NewMsg())
+		require.Equal(t, uint16(dns.ClassINET), msg.Question[0].Qclass)
+	})
 }
 
 func TestQueryNewMsgIDNA(t *testing.T) {
@@ -61,6 +252,371 @@ func TestQueryNewMsgIDNAError(t *testing.T) {
 	require.Error(t, err)
 }
 
+func TestNewQueries(t *testing.T) {
+	qtypes := []uint16{
+		dns.TypeA,
+		dns.TypeAAAA,
+		dns.TypeMX,
+		dns.TypeTXT,
+		dns.TypeNS,
+		dns.TypeCNAME,
+	}
+
+	queries, err := NewQueries("www.example.com", qtypes...)
+	require.NoError(t, err)
+	require.Len(t, queries, len(qtypes))
+
+	ids := map[uint16]bool{}
+	for idx, query := range queries {
+		require.Equal(t, "www.example.com", query.Name)
+		require.Equal(t, qtypes[idx], query.Type)
+		require.Equal(t, uint16(QueryMaxResponseSizeUDP), query.MaxSize)
+		require.False(t, ids[query.ID])
+		ids[query.ID] = true
+	}
+
+	// Make sure the queries are independent of each other
+	queries[0].Flags |= QueryFlagDNSSec
+	require.Zero(t, queries[1].Flags)
+}
+
+func TestNewQueriesInvalidName(t *testing.T) {
+	tests := []struct {
+		name        string
+		qname       string
+		expectedErr error
+	}{
+		{
+			name:  "IDNAError",
+			qname: "bad name.example",
+		},
+
+		{
+			name:        "LabelTooLong",
+			qname:       strings.Repeat("a", 64) + ".example.com",
+			expectedErr: ErrLabelTooLong,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			queries, err := NewQueries(tt.qname, dns.TypeA, dns.TypeAAAA)
+			require.Error(t, err)
+			if tt.expectedErr != nil {
+				require.ErrorIs(t, err, tt.expectedErr)
+			}
+			require.Nil(t, queries)
+		})
+	}
+}
+
+func TestIDGenerator(t *testing.T) {
+	saved := IDGenerator
+	t.Cleanup(func() { IDGenerator = saved })
+	IDGenerator = func() uint16 { return 37 }
+
+	t.Run("NewQuery", func(t *testing.T) {
+		query := NewQuery("www.example.com", dns.TypeA)
+		require.Equal(t, uint16(37), query.ID)
+	})
+
+	t.Run("NewQueries", func(t *testing.T) {
+		queries, err := NewQueries("www.example.com", dns.TypeA, dns.TypeAAAA, dns.TypeMX)
+		require.NoError(t, err)
+		require.Equal(t, uint16(37), queries[0].ID)
+		require.Equal(t, uint16(38), queries[1].ID)
+		require.Equal(t, uint16(39), queries[2].ID)
+	})
+
+	t.Run("DualStack", func(t *testing.T) {
+		a, aaaa := NewQuery("www.example.com", dns.TypeA).DualStack()
+		require.Equal(t, uint16(37), a.ID)
+		require.Equal(t, uint16(38), aaaa.ID)
+	})
+}
+
+func TestNewQueryPTR(t *testing.T) {
+	tests := []struct {
+		name     string
+		ip       net.IP
+		expected string
+	}{
+		{
+			name:     "IPv4",
+			ip:       net.ParseIP("8.8.8.8"),
+			expected: "8.8.8.8.in-addr.arpa.",
+		},
+
+		{
+			name:     "IPv6",
+			ip:       net.ParseIP("2001:4860:4860::8888"),
+			expected: "8.8.8.8.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.6.8.4.0.6.8.4.1.0.0.2.ip6.arpa.",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, err := NewQueryPTR(tt.ip)
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, query.Name)
+			require.Equal(t, dns.TypePTR, query.Type)
+			require.Equal(t, uint16(QueryMaxResponseSizeUDP), query.MaxSize)
+
+			msg, err := query.NewMsg()
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, msg.Question[0].Name)
+		})
+	}
+}
+
+func TestNewQueryPTRInvalidIP(t *testing.T) {
+	tests := []struct {
+		name string
+		ip   net.IP
+	}{
+		{"Nil", nil},
+		{"InvalidLength", net.IP{1, 2, 3}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, err := NewQueryPTR(tt.ip)
+			require.Error(t, err)
+			require.Nil(t, query)
+		})
+	}
+}
+
+func TestNewQueryTLSA(t *testing.T) {
+	tests := []struct {
+		name     string
+		port     uint16
+		proto    string
+		host     string
+		expected string
+	}{
+		{"HTTPS", 443, "tcp", "www.example.com", "_443._tcp.www.example.com"},
+		{"SMTP", 25, "tcp", "mail.example.com.", "_25._tcp.mail.example.com."},
+		{"QUIC", 443, "udp", "example.com", "_443._udp.example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := NewQueryTLSA(tt.port, tt.proto, tt.host)
+			require.Equal(t, tt.expected, query.Name)
+			require.Equal(t, dns.TypeTLSA, query.Type)
+			require.Equal(t, uint16(QueryMaxResponseSizeUDP), query.MaxSize)
+
+			msg, err := query.NewMsg()
+			require.NoError(t, err)
+			require.Equal(t, dns.Fqdn(tt.expected), msg.Question[0].Name)
+		})
+	}
+}
+
+func TestNewQuerySRV(t *testing.T) {
+	query := NewQuerySRV("xmpp-client", "tcp", "example.com")
+	require.Equal(t, "_xmpp-client._tcp.example.com", query.Name)
+	require.Equal(t, dns.TypeSRV, query.Type)
+	require.Equal(t, uint16(QueryMaxResponseSizeUDP), query.MaxSize)
+
+	msg, err := query.NewMsg()
+	require.NoError(t, err)
+	require.Equal(t, "_xmpp-client._tcp.example.com.", msg.Question[0].Name)
+}
+
+func TestNewQueryANY(t *testing.T) {
+	query := NewQueryANY("example.com")
+	require.Equal(t, "example.com", query.Name)
+	require.Equal(t, dns.TypeANY, query.Type)
+	require.Equal(t, uint16(QueryMaxResponseSizeUDP), query.MaxSize)
+}
+
+func TestQueryDualStack(t *testing.T) {
+	query := NewQuery("www.example.com", dns.TypeMX)
+	query.Flags = QueryFlagBlockLengthPadding | QueryFlagDNSSec
+	query.MaxSize = QueryMaxResponseSizeTCP
+
+	a, aaaa := query.DualStack()
+	require.NotSame(t, query, a)
+	require.NotSame(t, query, aaaa)
+
+	require.Equal(t, dns.TypeA, a.Type)
+	require.Equal(t, dns.TypeAAAA, aaaa.Type)
+	require.NotEqual(t, a.ID, aaaa.ID)
+
+	for _, clone := range []*Query{a, aaaa} {
+		require.Equal(t, query.Name, clone.Name)
+		require.Equal(t, query.Flags, clone.Flags)
+		require.Equal(t, query.MaxSize, clone.MaxSize)
+	}
+	require.Equal(t, dns.TypeMX, query.Type)
+}
+
+func TestQueryIDNAEncodedName(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		query := NewQuery("bücher.example", dns.TypeA)
+		name, err := query.IDNAEncodedName()
+		require.NoError(t, err)
+		require.Equal(t, "xn--bcher-kva.example", name)
+	})
+
+	t.Run("Failure", func(t *testing.T) {
+		query := NewQuery("bad name.example", dns.TypeA)
+		name, err := query.IDNAEncodedName()
+		require.Error(t, err)
+		require.Empty(t, name)
+
+		_, msgErr := query.NewMsg()
+		require.Equal(t, err.Error(), msgErr.Error())
+	})
+}
+
+func TestQueryASCIIName(t *testing.T) {
+	tests := []struct {
+		name        string
+		input       string
+		expected    string
+		expectedErr error
+	}{
+		{"IDNA", "bücher.example", "xn--bcher-kva.example.", nil},
+		{"ASCII", "www.example.com.", "www.example.com.", nil},
+		{"LabelTooLong", strings.Repeat("a", 64) + ".example", "", ErrLabelTooLong},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := NewQuery(tt.input, dns.TypeA)
+			query.Flags |= QueryFlag0x20Randomize
+			name, err := query.ASCIIName()
+			if tt.expectedErr != nil {
+				require.ErrorIs(t, err, tt.expectedErr)
+				require.Empty(t, name)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, name)
+		})
+	}
+
+	t.Run("IDNAError", func(t *testing.T) {
+		query := NewQuery("bad name.example", dns.TypeA)
+		name, err := query.ASCIIName()
+		require.Error(t, err)
+		require.Empty(t, name)
+	})
+}
+
+func TestQueryIDNAEncodedNameUnderscoreLabels(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+		wantErr  bool
+	}{
+		{"TLSA", "_443._tcp.example.com", "_443._tcp.example.com", false},
+		{"FullyQualified", "_443._tcp.example.com.", "_443._tcp.example.com.", false},
+		{"DMARC", "_dmarc.Example.COM", "_dmarc.example.com", false},
+		{"IDNAAfterServiceLabels", "_25._tcp.bücher.example", "_25._tcp.xn--bcher-kva.example", false},
+		{"OnlyServiceLabel", "_sip", "_sip", false},
+		{"OnlyServiceLabelFullyQualified", "_sip.", "_sip.", false},
+		{"NoUnderscore", "www.bücher.example", "www.xn--bcher-kva.example", false},
+		{"UnderscoreNotPrefix", "mail_server.example.com", "", true},
+		{"InvalidServiceLabel", "_bad label.example.com", "", true},
+		{"NonASCIIServiceLabel", "_bücher.example.com", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := NewQuery(tt.input, dns.TypeTLSA)
+			name, err := query.IDNAEncodedName()
+			if tt.wantErr {
+				require.Error(t, err)
+				require.Empty(t, name)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, name)
+		})
+	}
+}
+
+func TestQueryIDNAProfile(t *testing.T) {
+	tests := []struct {
+		name     string
+		profile  *idna.Profile
+		expected string
+		wantErr  bool
+	}{
+		{"DefaultLookup", nil, "", true},
+		{"ExplicitLookup", idna.Lookup, "", true},
+		{"Punycode", idna.Punycode, "mail_server.xn--bcher-kva.example.", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := NewQuery("mail_server.bücher.example", dns.TypeA)
+			query.IDNAProfile = tt.profile
+			msg, err := query.NewMsg()
+			if tt.wantErr {
+				require.Error(t, err)
+				require.Nil(t, msg)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, msg.Question[0].Name)
+		})
+	}
+}
+
+func TestQueryFillMsg(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		msg := new(dns.Msg)
+		msg.SetQuestion("www.example.net.", dns.TypeAAAA)
+		msg.Response = true
+		msg.Authoritative = true
+		msg.Rcode = dns.RcodeNameError
+		msg.Answer = []dns.RR{&dns.CNAME{
+			Hdr: dns.RR_Header{
+				Name:   "www.example.net.",
+				Rrtype: dns.TypeCNAME,
+				Class:  dns.ClassINET,
+			},
+			Target: "example.net.",
+		}}
+		msg.Ns = []dns.RR{&dns.NS{
+			Hdr: dns.RR_Header{
+				Name:   "example.net.",
+				Rrtype: dns.TypeNS,
+				Class:  dns.ClassINET,
+			},
+			Ns: "ns.example.net.",
+		}}
+		msg.SetEdns0(QueryMaxResponseSizeTCP, true)
+
+		query := NewQuery("www.example.com", dns.TypeA)
+		query.ID = 1234
+		require.NoError(t, query.FillMsg(msg))
+
+		expect := runtimex.PanicOnError1(query.NewMsg())
+		require.Equal(t, expect.String(), msg.String())
+		require.Len(t, msg.Question, 1)
+		require.Empty(t, msg.Answer)
+		require.Empty(t, msg.Ns)
+		require.Len(t, msg.Extra, 1)
+	})
+
+	t.Run("Failure", func(t *testing.T) {
+		msg := new(dns.Msg)
+		msg.SetQuestion("www.example.net.", dns.TypeAAAA)
+		orig := msg.String()
+
+		query := NewQuery("bad name.example", dns.TypeA)
+		require.Error(t, query.FillMsg(msg))
+		require.Equal(t, orig, msg.String())
+	})
+}
+
 func TestQueryNewMsgPadding(t *testing.T) {
 	query := NewQuery("www.example.com", dns.TypeA)
 	query.ID = 1
@@ -88,3 +644,858 @@ func TestQueryNewMsgPadding(t *testing.T) {
 	require.Equal(t, baseLen+4+expectedPadding, len(rawPad))
 	require.Equal(t, 0, len(rawPad)%128)
 }
+
+func TestQueryNewMsgPaddingBlockSize(t *testing.T) {
+	tests := []struct {
+		name      string
+		blockSize uint16
+		expected  int
+	}{
+		{name: "Default", blockSize: 0, expected: 128},
+		{name: "PowerOfTwo", blockSize: 64, expected: 64},
+		{name: "ServerRecommended", blockSize: 468, expected: 468},
+		{name: "One", blockSize: 1, expected: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, name := range []string{"a.com", "www.example.com", "a-much-longer-name.subdomain.example.org"} {
+				query := NewQuery(name, dns.TypeA, WithPadding())
+				query.PaddingBlockSize = tt.blockSize
+				msg := runtimex.PanicOnError1(query.NewMsg())
+				rawQuery := runtimex.PanicOnError1(msg.Pack())
+				require.Equal(t, 0, len(rawQuery)%tt.expected)
+
+				// Make sure we never add a whole block of padding
+				pad := msg.IsEdns0().Option[len(msg.IsEdns0().Option)-1].(*dns.EDNS0_PADDING)
+				require.Less(t, len(pad.Padding), tt.expected)
+			}
+		})
+	}
+}
+
+func TestQueryPack(t *testing.T) {
+	names := []string{"a.com", "www.example.com", "a-much-longer-name.subdomain.example.org"}
+	for _, name := range names {
+		t.Run(name, func(t *testing.T) {
+			query := NewQuery(name, dns.TypeA, WithPadding())
+
+			rawQuery, err := query.Pack()
+			require.NoError(t, err)
+			require.Equal(t, 0, len(rawQuery)%128)
+
+			msg := new(dns.Msg)
+			require.NoError(t, msg.Unpack(rawQuery))
+			require.Equal(t, query.ID, msg.Id)
+		})
+	}
+}
+
+func TestQueryPackError(t *testing.T) {
+	query := NewQuery("www.ex\x00ample.com", dns.TypeA)
+	rawQuery, err := query.Pack()
+	require.Error(t, err)
+	require.Nil(t, rawQuery)
+}
+
+func TestNewReplyMsg(t *testing.T) {
+	answer := &dns.A{
+		Hdr: dns.RR_Header{
+			Name:   "www.example.com.",
+			Rrtype: dns.TypeA,
+			Class:  dns.ClassINET,
+		},
+		A: net.IPv4(127, 0, 0, 1),
+	}
+
+	t.Run("RoundTrip", func(t *testing.T) {
+		query := NewQuery("www.example.com", dns.TypeA, WithDNSSEC(), WithMaxSize(QueryMaxResponseSizeTCP))
+		queryMsg := runtimex.PanicOnError1(query.NewMsg())
+		reply := NewReplyMsg(queryMsg, 0, answer)
+		require.True(t, reply.RecursionAvailable)
+		require.Equal(t, uint16(QueryMaxResponseSizeTCP), reply.IsEdns0().UDPSize())
+		require.True(t, reply.IsEdns0().Do())
+
+		resp, err := ParseResponse(queryMsg, reply)
+		require.NoError(t, err)
+		addrs := runtimex.PanicOnError1(resp.RecordsA())
+		require.Equal(t, []string{"127.0.0.1"}, addrs)
+	})
+
+	t.Run("CustomUDPSize", func(t *testing.T) {
+		query := NewQuery("www.example.com", dns.TypeA)
+		queryMsg := runtimex.PanicOnError1(query.NewMsg())
+		reply := NewReplyMsg(queryMsg, 512, answer)
+		require.Equal(t, uint16(512), reply.IsEdns0().UDPSize())
+		require.False(t, reply.IsEdns0().Do())
+	})
+
+	t.Run("0x20Randomize", func(t *testing.T) {
+		query := NewQuery("www.example.com", dns.TypeA)
+		query.Flags |= QueryFlag0x20Randomize
+		queryMsg := runtimex.PanicOnError1(query.NewMsg())
+		reply := NewReplyMsg(queryMsg, 0, answer)
+		require.Equal(t, queryMsg.Question, reply.Question)
+
+		q0, err := ValidateResponse0x20(queryMsg, reply)
+		require.NoError(t, err)
+		require.Equal(t, queryMsg.Question[0], q0)
+	})
+
+	t.Run("NoEDNS", func(t *testing.T) {
+		query := NewQuery("www.example.com", dns.TypeA)
+		query.Flags |= QueryFlagNoEDNS | QueryFlagNoRecursion
+		queryMsg := runtimex.PanicOnError1(query.NewMsg())
+		reply := NewReplyMsg(queryMsg, 512, answer)
+		require.Nil(t, reply.IsEdns0())
+		require.False(t, reply.RecursionAvailable)
+
+		reply.Authoritative = true
+		raw := runtimex.PanicOnError1(reply.Pack())
+		resp, err := query.ValidateAndParse(raw)
+		require.NoError(t, err)
+		require.Len(t, resp.ValidRRs, 1)
+	})
+}
+
+func TestQueryPackWithContext(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		query := NewQuery("www.example.com", dns.TypeA)
+		rawQuery, err := query.PackWithContext(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, runtimex.PanicOnError1(query.Pack()), rawQuery)
+	})
+
+	t.Run("Canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		query := NewQuery("www.example.com", dns.TypeA)
+		rawQuery, err := query.PackWithContext(ctx)
+		require.ErrorIs(t, err, context.Canceled)
+		require.Nil(t, rawQuery)
+	})
+
+	t.Run("PackError", func(t *testing.T) {
+		query := NewQuery("www.ex\x00ample.com", dns.TypeA)
+		rawQuery, err := query.PackWithContext(context.Background())
+		require.Error(t, err)
+		require.Nil(t, rawQuery)
+	})
+}
+
+func TestQueryNewMsgNoRecursion(t *testing.T) {
+	tests := []struct {
+		name     string
+		flags    uint16
+		expectRD bool
+	}{
+		{name: "Default", flags: 0, expectRD: true},
+		{name: "NoRecursion", flags: QueryFlagNoRecursion, expectRD: false},
+		{name: "NoRecursionWithDNSSec", flags: QueryFlagNoRecursion | QueryFlagDNSSec, expectRD: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := NewQuery("www.example.com", dns.TypeA)
+			query.Flags = tt.flags
+			msg := runtimex.PanicOnError1(query.NewMsg())
+			require.Equal(t, tt.expectRD, msg.RecursionDesired)
+
+			// Make sure the flag survives serialization
+			rawQuery := runtimex.PanicOnError1(msg.Pack())
+			parsed := new(dns.Msg)
+			require.NoError(t, parsed.Unpack(rawQuery))
+			require.Equal(t, tt.expectRD, parsed.RecursionDesired)
+		})
+	}
+}
+
+func TestQueryNewMsgCheckingDisabled(t *testing.T) {
+	tests := []struct {
+		name     string
+		flags    uint16
+		expectCD bool
+		expectDO bool
+	}{
+		{name: "Default", flags: 0, expectCD: false, expectDO: false},
+		{name: "CheckingDisabled", flags: QueryFlagCheckingDisabled, expectCD: true, expectDO: false},
+		{name: "DNSSec", flags: QueryFlagDNSSec, expectCD: false, expectDO: true},
+		{
+			name:     "CheckingDisabledAndDNSSec",
+			flags:    QueryFlagCheckingDisabled | QueryFlagDNSSec,
+			expectCD: true,
+			expectDO: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := NewQuery("www.example.com", dns.TypeA)
+			query.Flags = tt.flags
+			msg := runtimex.PanicOnError1(query.NewMsg())
+			require.Equal(t, tt.expectCD, msg.CheckingDisabled)
+			require.Equal(t, tt.expectDO, msg.IsEdns0().Do())
+		})
+	}
+}
+
+func TestQueryNewMsgAuthenticData(t *testing.T) {
+	query := NewQuery("www.example.com", dns.TypeA)
+	msg := new(dns.Msg)
+	require.NoError(t, msg.Unpack(runtimex.PanicOnError1(query.Pack())))
+	require.False(t, msg.AuthenticatedData)
+
+	query.Flags |= QueryFlagAuthenticData
+	msg = new(dns.Msg)
+	require.NoError(t, msg.Unpack(runtimex.PanicOnError1(query.Pack())))
+	require.True(t, msg.AuthenticatedData)
+}
+
+func TestQueryNewMsgRequestNSID(t *testing.T) {
+	query := NewQuery("www.example.com", dns.TypeA)
+	msg := runtimex.PanicOnError1(query.NewMsg())
+	for _, opt := range msg.IsEdns0().Option {
+		require.NotEqual(t, uint16(dns.EDNS0NSID), opt.Option())
+	}
+
+	query.Flags |= QueryFlagRequestNSID
+	msg = runtimex.PanicOnError1(query.NewMsg())
+	var nsid *dns.EDNS0_NSID
+	for _, opt := range msg.IsEdns0().Option {
+		if o, ok := opt.(*dns.EDNS0_NSID); ok {
+			nsid = o
+		}
+	}
+	require.NotNil(t, nsid)
+	require.Empty(t, nsid.Nsid)
+}
+
+func TestQueryNewMsgRequestKeepalive(t *testing.T) {
+	query := NewQuery("www.example.com", dns.TypeA)
+	msg := runtimex.PanicOnError1(query.NewMsg())
+	for _, opt := range msg.IsEdns0().Option {
+		require.NotEqual(t, uint16(dns.EDNS0TCPKEEPALIVE), opt.Option())
+	}
+
+	query.Flags |= QueryFlagRequestKeepalive
+	rawMsg := runtimex.PanicOnError1(query.Pack())
+	msg = new(dns.Msg)
+	require.NoError(t, msg.Unpack(rawMsg))
+	var keepalive *dns.EDNS0_TCP_KEEPALIVE
+	for _, opt := range msg.IsEdns0().Option {
+		if o, ok := opt.(*dns.EDNS0_TCP_KEEPALIVE); ok {
+			keepalive = o
+		}
+	}
+	require.NotNil(t, keepalive)
+	require.Equal(t, uint16(0), keepalive.Timeout)
+}
+
+func TestQueryNewMsgNoEDNS(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		query := NewQuery("www.example.com", dns.TypeA)
+		query.Flags |= QueryFlagNoEDNS | QueryFlagCheckingDisabled
+		msg := runtimex.PanicOnError1(query.NewMsg())
+		require.Nil(t, msg.IsEdns0())
+		require.Empty(t, msg.Extra)
+		require.True(t, msg.CheckingDisabled)
+		require.Len(t, msg.Question, 1)
+	})
+
+	t.Run("Conflicts", func(t *testing.T) {
+		tests := []struct {
+			name   string
+			modify func(q *Query)
+		}{
+			{"Padding", func(q *Query) { q.Flags |= QueryFlagBlockLengthPadding }},
+			{"DNSSec", func(q *Query) { q.Flags |= QueryFlagDNSSec }},
+			{"RequestNSID", func(q *Query) { q.Flags |= QueryFlagRequestNSID }},
+			{"RequestKeepalive", func(q *Query) { q.Flags |= QueryFlagRequestKeepalive }},
+			{"ClientCookie", func(q *Query) { q.ClientCookie = []byte{1, 2, 3, 4, 5, 6, 7, 8} }},
+			{"ECS", func(q *Query) { q.ECSAddress = net.IPv4(10, 0, 0, 0); q.ECSPrefixLen = 24 }},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				query := NewQuery("www.example.com", dns.TypeA)
+				query.Flags |= QueryFlagNoEDNS
+				tt.modify(query)
+				msg, err := query.NewMsg()
+				require.ErrorIs(t, err, ErrEDNSRequired)
+				require.Nil(t, msg)
+			})
+		}
+	})
+}
+
+func TestQueryNewMsgNameLength(t *testing.T) {
+	label63 := strings.Repeat("a", 63)
+	label64 := strings.Repeat("a", 64)
+
+	tests := []struct {
+		name        string
+		qname       string
+		expectedErr error
+		expectedMsg string
+	}{
+		{
+			name:  "MaximumLabel",
+			qname: label63 + ".example.com",
+		},
+
+		{
+			name:        "LabelTooLong",
+			qname:       "www." + label64 + ".example.com",
+			expectedErr: ErrLabelTooLong,
+			expectedMsg: label64,
+		},
+
+		{
+			// 4 labels of 63 octets plus 4 length octets plus the root
+			// label amount to 257 octets, which exceeds the limit.
+			name:        "NameTooLong",
+			qname:       strings.Join([]string{label63, label63, label63, label63}, "."),
+			expectedErr: ErrNameTooLong,
+		},
+
+		{
+			name:        "ThreeHundredOctetsName",
+			qname:       strings.Repeat("abcdefghi.", 30),
+			expectedErr: ErrNameTooLong,
+			expectedMsg: "301 octets",
+		},
+
+		{
+			// 3 labels of 63 octets plus 1 label of 61 octets plus 4
+			// length octets plus the root label amount to 255 octets.
+			name:  "MaximumName",
+			qname: strings.Join([]string{label63, label63, label63, label63[:61]}, "."),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := NewQuery(tt.qname, dns.TypeA)
+			msg, err := query.NewMsg()
+			if tt.expectedErr != nil {
+				require.ErrorIs(t, err, tt.expectedErr)
+				require.ErrorContains(t, err, tt.expectedMsg)
+				require.Nil(t, msg)
+				return
+			}
+			require.NoError(t, err)
+			_, err = msg.Pack()
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestQueryOrderOptions(t *testing.T) {
+	cookie := &dns.EDNS0_COOKIE{Code: dns.EDNS0COOKIE, Cookie: "0102030405060708"}
+	nsid := &dns.EDNS0_NSID{Code: dns.EDNS0NSID}
+	local1 := &dns.EDNS0_LOCAL{Code: dns.EDNS0LOCALSTART, Data: []byte{1}}
+	local2 := &dns.EDNS0_LOCAL{Code: dns.EDNS0LOCALSTART, Data: []byte{2}}
+	pad := &dns.EDNS0_PADDING{}
+	options := []dns.EDNS0{cookie, local1, nsid, local2, pad}
+
+	tests := []struct {
+		name     string
+		order    []uint16
+		expected []dns.EDNS0
+	}{
+		{
+			name:     "NoOrder",
+			order:    nil,
+			expected: []dns.EDNS0{cookie, local1, nsid, local2, pad},
+		},
+
+		{
+			name:     "PaddingFirst",
+			order:    []uint16{dns.EDNS0PADDING},
+			expected: []dns.EDNS0{pad, cookie, local1, nsid, local2},
+		},
+
+		{
+			name:     "PartialOrder",
+			order:    []uint16{dns.EDNS0NSID, dns.EDNS0LOCALSTART},
+			expected: []dns.EDNS0{nsid, local1, local2, cookie, pad},
+		},
+
+		{
+			name:     "DuplicateAndMissingCodes",
+			order:    []uint16{dns.EDNS0SUBNET, dns.EDNS0COOKIE, dns.EDNS0COOKIE},
+			expected: []dns.EDNS0{cookie, local1, nsid, local2, pad},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.expected, queryOrderOptions(options, tt.order))
+		})
+	}
+}
+
+func TestQueryNewMsgECS(t *testing.T) {
+	tests := []struct {
+		name           string
+		addr           net.IP
+		prefixLen      uint8
+		expectedFamily uint16
+		expectedAddr   net.IP
+		expectedErr    error
+	}{
+		{
+			name:           "IPv4",
+			addr:           net.ParseIP("130.192.91.211"),
+			prefixLen:      24,
+			expectedFamily: 1,
+			expectedAddr:   net.IPv4(130, 192, 91, 0).To4(),
+		},
+
+		{
+			name:           "IPv6",
+			addr:           net.ParseIP("2001:db8:1234:5678::1"),
+			prefixLen:      56,
+			expectedFamily: 2,
+			expectedAddr:   net.ParseIP("2001:db8:1234:5600::"),
+		},
+
+		{
+			name:           "IPv4ZeroPrefix",
+			addr:           net.ParseIP("130.192.91.211"),
+			prefixLen:      0,
+			expectedFamily: 1,
+			expectedAddr:   net.IPv4(0, 0, 0, 0).To4(),
+		},
+
+		{
+			name:        "IPv4PrefixTooLong",
+			addr:        net.ParseIP("130.192.91.211"),
+			prefixLen:   33,
+			expectedErr: ErrInvalidECSPrefixLen,
+		},
+
+		{
+			name:        "IPv6PrefixTooLong",
+			addr:        net.ParseIP("2001:db8::1"),
+			prefixLen:   129,
+			expectedErr: ErrInvalidECSPrefixLen,
+		},
+
+		{
+			name:        "InvalidAddress",
+			addr:        net.IP{1, 2, 3},
+			prefixLen:   8,
+			expectedErr: ErrInvalidECSAddress,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := NewQuery("www.example.com", dns.TypeA)
+			query.ECSAddress = tt.addr
+			query.ECSPrefixLen = tt.prefixLen
+
+			msg, err := query.NewMsg()
+			if tt.expectedErr != nil {
+				require.ErrorIs(t, err, tt.expectedErr)
+				require.Nil(t, msg)
+				return
+			}
+			require.NoError(t, err)
+
+			rawMsg := runtimex.PanicOnError1(msg.Pack())
+			parsed := new(dns.Msg)
+			require.NoError(t, parsed.Unpack(rawMsg))
+			options := parsed.IsEdns0().Option
+			require.Len(t, options, 1)
+			ecs, ok := options[0].(*dns.EDNS0_SUBNET)
+			require.True(t, ok)
+			require.Equal(t, tt.expectedFamily, ecs.Family)
+			require.Equal(t, tt.prefixLen, ecs.SourceNetmask)
+			require.Equal(t, uint8(0), ecs.SourceScope)
+			require.True(t, tt.expectedAddr.Equal(ecs.Address))
+		})
+	}
+}
+
+func TestQueryNewMsgOptionsOrderOnWire(t *testing.T) {
+	tests := []struct {
+		name     string
+		order    []uint16
+		expected []uint16
+	}{
+		{
+			name:     "DefaultOrder",
+			order:    nil,
+			expected: []uint16{dns.EDNS0SUBNET, dns.EDNS0PADDING},
+		},
+
+		{
+			name:     "PaddingFirst",
+			order:    []uint16{dns.EDNS0PADDING},
+			expected: []uint16{dns.EDNS0PADDING, dns.EDNS0SUBNET},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := NewQuery("www.example.com", dns.TypeA)
+			query.Flags |= QueryFlagBlockLengthPadding
+			query.ECSAddress = net.ParseIP("130.192.91.211")
+			query.ECSPrefixLen = 24
+			query.OptionsOrder = tt.order
+
+			msg := runtimex.PanicOnError1(query.NewMsg())
+			rawMsg := runtimex.PanicOnError1(msg.Pack())
+			require.Equal(t, 0, len(rawMsg)%128)
+
+			parsed := new(dns.Msg)
+			require.NoError(t, parsed.Unpack(rawMsg))
+			var codes []uint16
+			for _, option := range parsed.IsEdns0().Option {
+				codes = append(codes, option.Option())
+			}
+			require.Equal(t, tt.expected, codes)
+		})
+	}
+}
+
+func TestQueryNewMsgExtraOptions(t *testing.T) {
+	newLocal := func(code uint16, data string) *dns.EDNS0_LOCAL {
+		return &dns.EDNS0_LOCAL{Code: code, Data: []byte(data)}
+	}
+
+	t.Run("Success", func(t *testing.T) {
+		query := NewQuery("www.example.com", dns.TypeA)
+		query.Flags |= QueryFlagBlockLengthPadding | QueryFlagRequestNSID
+		query.ExtraOptions = []dns.EDNS0{
+			newLocal(dns.EDNS0LOCALSTART+1, "second"),
+			newLocal(dns.EDNS0LOCALSTART, "first"),
+		}
+
+		msg := runtimex.PanicOnError1(query.NewMsg())
+		rawMsg := runtimex.PanicOnError1(msg.Pack())
+		require.Equal(t, 0, len(rawMsg)%128)
+
+		parsed := new(dns.Msg)
+		require.NoError(t, parsed.Unpack(rawMsg))
+		options := parsed.IsEdns0().Option
+		require.Len(t, options, 4)
+		require.Equal(t, uint16(dns.EDNS0NSID), options[0].Option())
+		require.Equal(t, newLocal(dns.EDNS0LOCALSTART+1, "second"), options[1])
+		require.Equal(t, newLocal(dns.EDNS0LOCALSTART, "first"), options[2])
+		require.Equal(t, uint16(dns.EDNS0PADDING), options[3].Option())
+	})
+
+	t.Run("NoEDNS", func(t *testing.T) {
+		query := NewQuery("www.example.com", dns.TypeA)
+		query.Flags |= QueryFlagNoEDNS
+		query.ExtraOptions = []dns.EDNS0{newLocal(dns.EDNS0LOCALSTART, "first")}
+
+		msg, err := query.NewMsg()
+		require.ErrorIs(t, err, ErrEDNSRequired)
+		require.Nil(t, msg)
+	})
+}
+
+func TestQueryEDNSOptions(t *testing.T) {
+	t.Run("PaddingAndDNSSEC", func(t *testing.T) {
+		query := NewQuery("www.example.com", dns.TypeA, WithDNSSEC(), WithPadding())
+		query.Flags |= QueryFlagRequestNSID
+
+		options, err := query.EDNSOptions()
+		require.NoError(t, err)
+		require.Len(t, options, 2)
+		require.Equal(t, uint16(dns.EDNS0NSID), options[0].Option())
+		require.Equal(t, uint16(dns.EDNS0PADDING), options[1].Option())
+
+		// Make sure the options match those of the actual message
+		// and that the DO bit lives in the OPT record header.
+		msg := runtimex.PanicOnError1(query.NewMsg())
+		require.Equal(t, msg.IsEdns0().Option, options)
+		require.True(t, msg.IsEdns0().Do())
+	})
+
+	t.Run("NoOptions", func(t *testing.T) {
+		query := NewQuery("www.example.com", dns.TypeA)
+		options, err := query.EDNSOptions()
+		require.NoError(t, err)
+		require.Empty(t, options)
+	})
+
+	t.Run("NoEDNS", func(t *testing.T) {
+		query := NewQuery("www.example.com", dns.TypeA)
+		query.Flags |= QueryFlagNoEDNS
+		options, err := query.EDNSOptions()
+		require.NoError(t, err)
+		require.Nil(t, options)
+	})
+
+	t.Run("InvalidQuery", func(t *testing.T) {
+		query := NewQuery("www.example.com", dns.TypeA)
+		query.ClientCookie = []byte{1, 2, 3}
+		options, err := query.EDNSOptions()
+		require.ErrorIs(t, err, ErrInvalidClientCookie)
+		require.Nil(t, options)
+	})
+}
+
+func TestQueryNewMsgClientCookie(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		query := NewQuery("www.example.com", dns.TypeA)
+		query.ClientCookie = []byte{1, 2, 3, 4, 5, 6, 7, 8}
+
+		msg := runtimex.PanicOnError1(query.NewMsg())
+		rawMsg := runtimex.PanicOnError1(msg.Pack())
+		parsed := new(dns.Msg)
+		require.NoError(t, parsed.Unpack(rawMsg))
+
+		options := parsed.IsEdns0().Option
+		require.Len(t, options, 1)
+		cookie, ok := options[0].(*dns.EDNS0_COOKIE)
+		require.True(t, ok)
+		require.Equal(t, "0102030405060708", cookie.Cookie)
+	})
+
+	t.Run("InvalidLength", func(t *testing.T) {
+		query := NewQuery("www.example.com", dns.TypeA)
+		query.ClientCookie = []byte{1, 2, 3, 4, 5, 6, 7}
+
+		msg, err := query.NewMsg()
+		require.ErrorIs(t, err, ErrInvalidClientCookie)
+		require.Nil(t, msg)
+	})
+
+	t.Run("ServerCookie", func(t *testing.T) {
+		query := NewQuery("www.example.com", dns.TypeA)
+		query.ClientCookie = []byte{1, 2, 3, 4, 5, 6, 7, 8}
+		query.ServerCookie = []byte{9, 10, 11, 12, 13, 14, 15, 16}
+
+		msg := runtimex.PanicOnError1(query.NewMsg())
+		options := msg.IsEdns0().Option
+		require.Len(t, options, 1)
+		cookie, ok := options[0].(*dns.EDNS0_COOKIE)
+		require.True(t, ok)
+		require.Equal(t, "0102030405060708090a0b0c0d0e0f10", cookie.Cookie)
+	})
+
+	t.Run("InvalidServerCookie", func(t *testing.T) {
+		tests := []struct {
+			name   string
+			client []byte
+			server []byte
+		}{
+			{"TooShort", []byte{1, 2, 3, 4, 5, 6, 7, 8}, make([]byte, 7)},
+			{"TooLong", []byte{1, 2, 3, 4, 5, 6, 7, 8}, make([]byte, 33)},
+			{"WithoutClientCookie", nil, make([]byte, 8)},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				query := NewQuery("www.example.com", dns.TypeA)
+				query.ClientCookie = tt.client
+				query.ServerCookie = tt.server
+
+				msg, err := query.NewMsg()
+				require.ErrorIs(t, err, ErrInvalidServerCookie)
+				require.Nil(t, msg)
+			})
+		}
+	})
+}
+
+func TestQuery0x20Randomize(t *testing.T) {
+	t.Run("Deterministic", func(t *testing.T) {
+		rng := rand.New(rand.NewPCG(1, 2))
+		name := query0x20Randomize("www.example-123.com.", rng.Uint64)
+		require.Equal(t, "www.eXampLe-123.CoM.", name)
+	})
+
+	t.Run("AllUpper", func(t *testing.T) {
+		allOnes := func() uint64 { return ^uint64(0) }
+		name := query0x20Randomize("www.Example-123.com.", allOnes)
+		require.Equal(t, "WWW.EXAMPLE-123.COM.", name)
+	})
+
+	t.Run("AllLower", func(t *testing.T) {
+		allZeros := func() uint64 { return 0 }
+		name := query0x20Randomize("WWW.Example-123.COM.", allZeros)
+		require.Equal(t, "www.example-123.com.", name)
+	})
+
+	t.Run("LongName", func(t *testing.T) {
+		// make sure we fetch new random bits after consuming 64 bits
+		var calls int
+		alternate := func() uint64 {
+			calls++
+			return 0x5555555555555555
+		}
+		input := strings.Repeat("a", 63) + "." + strings.Repeat("b", 63) + "."
+		name := query0x20Randomize(input, alternate)
+		require.Equal(t, 2, calls)
+		require.True(t, strings.EqualFold(input, name))
+		require.Equal(t, byte('A'), name[0])
+		require.Equal(t, byte('a'), name[1])
+		require.Equal(t, byte('b'), name[64])
+		require.Equal(t, byte('B'), name[65])
+	})
+}
+
+func TestQueryNewMsg0x20Randomize(t *testing.T) {
+	query := NewQuery("www.example.com", dns.TypeA)
+	query.Flags |= QueryFlag0x20Randomize
+	msg := runtimex.PanicOnError1(query.NewMsg())
+	require.True(t, strings.EqualFold("www.example.com.", msg.Question[0].Name))
+
+	resp := new(dns.Msg)
+	resp.SetReply(msg)
+	q0, err := ValidateResponse0x20(msg, resp)
+	require.NoError(t, err)
+	require.Equal(t, msg.Question[0], q0)
+}
+
+func TestNewQueryWithProfile(t *testing.T) {
+	tests := []struct {
+		name       string
+		profile    QueryProfile
+		expectedRD bool
+	}{
+		{"Stub", ProfileStub, true},
+		{"Iterative", ProfileIterative, false},
+		{"AuthoritativeProbe", ProfileAuthoritativeProbe, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := NewQueryWithProfile("www.example.com", dns.TypeA, tt.profile, WithDNSSEC())
+			require.Equal(t, uint16(QueryMaxResponseSizeUDP), query.MaxSize)
+			require.NotZero(t, query.Flags&QueryFlagDNSSec)
+
+			msg := runtimex.PanicOnError1(query.NewMsg())
+			require.Equal(t, tt.expectedRD, msg.RecursionDesired)
+			require.True(t, msg.IsEdns0().Do())
+		})
+	}
+}
+
+func TestNewQueryFromMsg(t *testing.T) {
+	newMsg := func() *dns.Msg {
+		msg := new(dns.Msg)
+		msg.SetQuestion("www.example.com.", dns.TypeAAAA)
+		msg.Id = 0x4242
+		return msg
+	}
+
+	tests := []struct {
+		name  string
+		msg   func() *dns.Msg
+		flags uint16
+	}{
+		{
+			name: "NoEDNS",
+			msg: func() *dns.Msg {
+				return newMsg()
+			},
+			flags: QueryFlagNoEDNS,
+		},
+
+		{
+			name: "HeaderBits",
+			msg: func() *dns.Msg {
+				msg := newMsg()
+				msg.RecursionDesired = false
+				msg.CheckingDisabled = true
+				msg.AuthenticatedData = true
+				msg.SetEdns0(QueryMaxResponseSizeUDP, false)
+				return msg
+			},
+			flags: QueryFlagNoRecursion | QueryFlagCheckingDisabled | QueryFlagAuthenticData,
+		},
+
+		{
+			name: "EDNSOptions",
+			msg: func() *dns.Msg {
+				msg := newMsg()
+				msg.SetEdns0(QueryMaxResponseSizeTCP, true)
+				msg.IsEdns0().Option = []dns.EDNS0{
+					&dns.EDNS0_NSID{Code: dns.EDNS0NSID},
+					&dns.EDNS0_LOCAL{Code: dns.EDNS0LOCALSTART, Data: []byte("local")},
+					&dns.EDNS0_COOKIE{Code: dns.EDNS0COOKIE, Cookie: "0102030405060708"},
+					&dns.EDNS0_TCP_KEEPALIVE{Code: dns.EDNS0TCPKEEPALIVE},
+					&dns.EDNS0_SUBNET{
+						Code:          dns.EDNS0SUBNET,
+						Family:        1,
+						SourceNetmask: 24,
+						Address:       net.ParseIP("192.0.2.0").To4(),
+					},
+				}
+				return msg
+			},
+			flags: QueryFlagDNSSec | QueryFlagRequestNSID | QueryFlagRequestKeepalive,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := tt.msg()
+			query, err := NewQueryFromMsg(msg)
+			require.NoError(t, err)
+			require.Equal(t, "www.example.com.", query.Name)
+			require.Equal(t, dns.TypeAAAA, query.Type)
+			require.Equal(t, uint16(0x4242), query.ID)
+			require.Equal(t, tt.flags, query.Flags)
+
+			// Make sure that re-creating the message from the
+			// query produces exactly the same wire format.
+			expected := runtimex.PanicOnError1(msg.Pack())
+			got := runtimex.PanicOnError1(runtimex.PanicOnError1(query.Clone().NewMsg()).Pack())
+			require.Equal(t, expected, got)
+		})
+	}
+
+	t.Run("Padding", func(t *testing.T) {
+		msg := newMsg()
+		msg.SetEdns0(QueryMaxResponseSizeUDP, false)
+		msg.IsEdns0().Option = []dns.EDNS0{&dns.EDNS0_PADDING{Padding: make([]byte, 7)}}
+		query, err := NewQueryFromMsg(msg)
+		require.NoError(t, err)
+		require.Equal(t, uint16(QueryFlagBlockLengthPadding), query.Flags)
+
+		rawMsg := runtimex.PanicOnError1(query.Pack())
+		require.Zero(t, len(rawMsg)%128)
+	})
+
+	t.Run("FullCookie", func(t *testing.T) {
+		const fullCookie = "0102030405060708" + "1112131415161718" + "2122232425262728"
+		msg := newMsg()
+		msg.SetEdns0(QueryMaxResponseSizeUDP, false)
+		msg.IsEdns0().Option = []dns.EDNS0{&dns.EDNS0_COOKIE{Code: dns.EDNS0COOKIE, Cookie: fullCookie}}
+		query, err := NewQueryFromMsg(msg)
+		require.NoError(t, err)
+		require.Equal(t, []byte{1, 2, 3, 4, 5, 6, 7, 8}, query.ClientCookie)
+		require.Len(t, query.ServerCookie, 16)
+
+		// Make sure the full 24-byte cookie is echoed back.
+		expected := runtimex.PanicOnError1(msg.Pack())
+		got := runtimex.PanicOnError1(query.Pack())
+		require.Equal(t, expected, got)
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		noQuestion := new(dns.Msg)
+		_, err := NewQueryFromMsg(noQuestion)
+		require.ErrorIs(t, err, ErrInvalidQuery)
+
+		twoQuestions := newMsg()
+		twoQuestions.Question = append(twoQuestions.Question, twoQuestions.Question[0])
+		_, err = NewQueryFromMsg(twoQuestions)
+		require.ErrorIs(t, err, ErrInvalidQuery)
+
+		badCookie := newMsg()
+		badCookie.SetEdns0(QueryMaxResponseSizeUDP, false)
+		badCookie.IsEdns0().Option = []dns.EDNS0{&dns.EDNS0_COOKIE{Code: dns.EDNS0COOKIE, Cookie: "0102"}}
+		_, err = NewQueryFromMsg(badCookie)
+		require.ErrorIs(t, err, ErrInvalidQuery)
+	})
+}
@@ -0,0 +1,154 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnscodec
+
+import (
+	"cmp"
+	"net"
+	"slices"
+
+	"github.com/miekg/dns"
+)
+
+// RecordSet contains the valid RRs of a [*Response] grouped by type.
+//
+// Construct using [*Response.Records]. Each field contains the same
+// values, in the same order, that the corresponding Records* method of
+// [*Response] would return, except that A and AAAA contain [net.IP]
+// values as returned by [*Response.AddrsA] and [*Response.AddrsAAAA].
+type RecordSet struct {
+	// A contains the addresses of the A records.
+	A []net.IP
+
+	// AAAA contains the addresses of the AAAA records.
+	AAAA []net.IP
+
+	// CAA contains the CAA records.
+	CAA []*dns.CAA
+
+	// CNAME contains the targets of the CNAME records.
+	CNAME []string
+
+	// DNSKEY contains the DNSKEY records.
+	DNSKEY []*dns.DNSKEY
+
+	// DS contains the DS records.
+	DS []*dns.DS
+
+	// HTTPS contains the HTTPS records sorted by ascending priority.
+	HTTPS []*dns.HTTPS
+
+	// MX contains the MX records sorted by ascending preference.
+	MX []*dns.MX
+
+	// NAPTR contains the NAPTR records sorted by ascending order and preference.
+	NAPTR []*dns.NAPTR
+
+	// NS contains the name servers of the NS records.
+	NS []string
+
+	// PTR contains the targets of the PTR records.
+	PTR []string
+
+	// SOA contains the SOA records.
+	SOA []*dns.SOA
+
+	// SRV contains the SRV records in response order.
+	SRV []*dns.SRV
+
+	// SVCB contains the SVCB records sorted by ascending priority.
+	SVCB []*dns.SVCB
+
+	// TLSA contains the TLSA records.
+	TLSA []*dns.TLSA
+
+	// TXT contains the character strings of the TXT records.
+	TXT [][]string
+
+	// Unknown contains the records whose type is unknown to [github.com/miekg/dns].
+	Unknown []*dns.RFC3597
+}
+
+// Records returns the valid RRs grouped by type in a [*RecordSet].
+//
+// This method scans the valid RRs once, so it is more efficient than
+// invoking several Records* methods. As with [*Response.RecordsNS] and
+// [*Response.RecordsSOA], set [Response.IncludeAuthority] to also obtain
+// the NS and SOA records in the authority section. This method returns
+// [ErrNoData] when the returned [*RecordSet] would be empty.
+func (r *Response) Records() (*RecordSet, error) {
+	rs := &RecordSet{}
+	var count int
+	for _, rr := range r.ValidRRs {
+		if rs.add(rr) {
+			count++
+		}
+	}
+	if r.IncludeAuthority && r.Response != nil {
+		for _, rr := range r.Response.Ns {
+			switch rr.(type) {
+			case *dns.NS, *dns.SOA:
+				if rs.add(rr) {
+					count++
+				}
+			}
+		}
+	}
+	if count < 1 {
+		return nil, ErrNoData
+	}
+	slices.SortStableFunc(rs.HTTPS, func(a, b *dns.HTTPS) int {
+		return cmp.Compare(a.Priority, b.Priority)
+	})
+	slices.SortStableFunc(rs.MX, func(a, b *dns.MX) int {
+		return cmp.Compare(a.Preference, b.Preference)
+	})
+	slices.SortStableFunc(rs.NAPTR, responseCompareNAPTR)
+	slices.SortStableFunc(rs.SVCB, func(a, b *dns.SVCB) int {
+		return cmp.Compare(a.Priority, b.Priority)
+	})
+	return rs, nil
+}
+
+// add adds rr to the [*RecordSet] and returns whether rr has a known type.
+func (rs *RecordSet) add(rr dns.RR) bool {
+	switch rr := rr.(type) {
+	case *dns.A:
+		rs.A = append(rs.A, rr.A)
+	case *dns.AAAA:
+		rs.AAAA = append(rs.AAAA, rr.AAAA)
+	case *dns.CAA:
+		rs.CAA = append(rs.CAA, rr)
+	case *dns.CNAME:
+		rs.CNAME = append(rs.CNAME, rr.Target)
+	case *dns.DNSKEY:
+		rs.DNSKEY = append(rs.DNSKEY, rr)
+	case *dns.DS:
+		rs.DS = append(rs.DS, rr)
+	case *dns.HTTPS:
+		rs.HTTPS = append(rs.HTTPS, rr)
+	case *dns.MX:
+		rs.MX = append(rs.MX, rr)
+	case *dns.NAPTR:
+		rs.NAPTR = append(rs.NAPTR, rr)
+	case *dns.NS:
+		rs.NS = append(rs.NS, rr.Ns)
+	case *dns.PTR:
+		rs.PTR = append(rs.PTR, rr.Ptr)
+	case *dns.SOA:
+		rs.SOA = append(rs.SOA, rr)
+	case *dns.SRV:
+		rs.SRV = append(rs.SRV, rr)
+	case *dns.SVCB:
+		rs.SVCB = append(rs.SVCB, rr)
+	case *dns.TLSA:
+		rs.TLSA = append(rs.TLSA, rr)
+	case *dns.TXT:
+		rs.TXT = append(rs.TXT, rr.Txt)
+	case *dns.RFC3597:
+		rs.Unknown = append(rs.Unknown, rr)
+	default:
+		return false
+	}
+	return true
+}
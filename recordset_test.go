@@ -0,0 +1,120 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnscodec
+
+import (
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResponseRecords(t *testing.T) {
+	header := func(rrtype uint16) dns.RR_Header {
+		return dns.RR_Header{
+			Name:   "example.com.",
+			Rrtype: rrtype,
+			Class:  dns.ClassINET,
+		}
+	}
+	mx20 := &dns.MX{Hdr: header(dns.TypeMX), Preference: 20, Mx: "mx2.example.com."}
+	mx10 := &dns.MX{Hdr: header(dns.TypeMX), Preference: 10, Mx: "mx1.example.com."}
+	caa := &dns.CAA{Hdr: header(dns.TypeCAA), Tag: "issue", Value: "ca.example.net"}
+	srv := &dns.SRV{Hdr: header(dns.TypeSRV), Priority: 10, Target: "srv.example.com."}
+	unknown := &dns.RFC3597{Hdr: header(65280), Rdata: "0102"}
+	soa := &dns.SOA{Hdr: header(dns.TypeSOA), Ns: "ns.example.com.", Mbox: "admin.example.com."}
+	resp := &Response{
+		ValidRRs: []dns.RR{
+			&dns.A{Hdr: header(dns.TypeA), A: net.IPv4(10, 0, 0, 1)},
+			mx20,
+			&dns.AAAA{Hdr: header(dns.TypeAAAA), AAAA: net.ParseIP("2001:db8::1")},
+			&dns.CNAME{Hdr: header(dns.TypeCNAME), Target: "alias.example.com."},
+			mx10,
+			&dns.TXT{Hdr: header(dns.TypeTXT), Txt: []string{"a", "b"}},
+			&dns.NS{Hdr: header(dns.TypeNS), Ns: "ns.example.com."},
+			&dns.PTR{Hdr: header(dns.TypePTR), Ptr: "ptr.example.com."},
+			caa,
+			srv,
+			unknown,
+			&dns.A{Hdr: header(dns.TypeA), A: net.IPv4(10, 0, 0, 2)},
+			&dns.DS{Hdr: header(dns.TypeDS)},
+		},
+		Response: &dns.Msg{Ns: []dns.RR{soa}},
+	}
+
+	rs, err := resp.Records()
+	require.NoError(t, err)
+	require.Equal(t, []net.IP{net.IPv4(10, 0, 0, 1), net.IPv4(10, 0, 0, 2)}, rs.A)
+	require.Equal(t, []net.IP{net.ParseIP("2001:db8::1")}, rs.AAAA)
+	require.Equal(t, []string{"alias.example.com."}, rs.CNAME)
+	require.Equal(t, []*dns.MX{mx10, mx20}, rs.MX)
+	require.Equal(t, [][]string{{"a", "b"}}, rs.TXT)
+	require.Equal(t, []string{"ns.example.com."}, rs.NS)
+	require.Equal(t, []string{"ptr.example.com."}, rs.PTR)
+	require.Equal(t, []*dns.CAA{caa}, rs.CAA)
+	require.Equal(t, []*dns.SRV{srv}, rs.SRV)
+	require.Equal(t, []*dns.RFC3597{unknown}, rs.Unknown)
+	require.Empty(t, rs.SOA)
+	require.Empty(t, rs.SVCB)
+	require.Empty(t, rs.HTTPS)
+	require.Empty(t, rs.TLSA)
+
+	// Make sure the authority section is honored
+	resp.IncludeAuthority = true
+	rs, err = resp.Records()
+	require.NoError(t, err)
+	require.Equal(t, []*dns.SOA{soa}, rs.SOA)
+}
+
+func TestResponseRecordsSortOrder(t *testing.T) {
+	header := func(rrtype uint16) dns.RR_Header {
+		return dns.RR_Header{
+			Name:   "example.com.",
+			Rrtype: rrtype,
+			Class:  dns.ClassINET,
+		}
+	}
+	svcb2 := &dns.SVCB{Hdr: header(dns.TypeSVCB), Priority: 2, Target: "b.example.com."}
+	svcb1 := &dns.SVCB{Hdr: header(dns.TypeSVCB), Priority: 1, Target: "a.example.com."}
+	https2 := &dns.HTTPS{SVCB: dns.SVCB{Hdr: header(dns.TypeHTTPS), Priority: 2, Target: "."}}
+	https0 := &dns.HTTPS{SVCB: dns.SVCB{Hdr: header(dns.TypeHTTPS), Priority: 0, Target: "x.example.com."}}
+	tlsa := &dns.TLSA{Hdr: header(dns.TypeTLSA), Usage: 3}
+	naptr2 := &dns.NAPTR{Hdr: header(dns.TypeNAPTR), Order: 100, Preference: 20}
+	naptr1 := &dns.NAPTR{Hdr: header(dns.TypeNAPTR), Order: 100, Preference: 10}
+	resp := &Response{ValidRRs: []dns.RR{svcb2, https2, naptr2, svcb1, https0, tlsa, naptr1}}
+
+	rs, err := resp.Records()
+	require.NoError(t, err)
+	require.Equal(t, []*dns.SVCB{svcb1, svcb2}, rs.SVCB)
+	require.Equal(t, []*dns.HTTPS{https0, https2}, rs.HTTPS)
+	require.Equal(t, []*dns.TLSA{tlsa}, rs.TLSA)
+	require.Equal(t, []*dns.NAPTR{naptr1, naptr2}, rs.NAPTR)
+}
+
+func TestResponseRecordsNoData(t *testing.T) {
+	tests := []struct {
+		name string
+		resp *Response
+	}{
+		{
+			name: "Empty",
+			resp: &Response{ValidRRs: []dns.RR{}},
+		},
+
+		{
+			name: "OnlyUnsupportedTypes",
+			resp: &Response{ValidRRs: []dns.RR{&dns.HINFO{
+				Hdr: dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeHINFO, Class: dns.ClassINET},
+			}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rs, err := tt.resp.Records()
+			require.ErrorIs(t, err, ErrNoData)
+			require.Nil(t, rs)
+		})
+	}
+}
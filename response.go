@@ -9,57 +9,217 @@
 package dnscodec
 
 import (
+	"cmp"
+	"encoding/hex"
 	"errors"
+	"fmt"
+	"maps"
+	"math/rand/v2"
+	"net"
+	"net/netip"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/miekg/dns"
+	"golang.org/x/net/idna"
 )
 
 // Additional errors emitted by [ValidateResponseForQuery].
 var (
-	// ErrInvalidQuery means that the query does not contain a single question.
+	// ErrInvalidQuery means that the query does not contain any question.
 	ErrInvalidQuery = errors.New("invalid query")
+
+	// ErrMultipleQuestions means that the query contains more than one
+	// question, which is usually caused by reusing a [*dns.Msg].
+	ErrMultipleQuestions = errors.New("query contains multiple questions")
+
+	// ErrTruncatedResponse means that the response matches the query but
+	// has the TC bit set, which is a signal to retry using TCP.
+	ErrTruncatedResponse = errors.New("truncated DNS response")
+)
+
+// ValidationReason is the reason why a [*ValidationError] occurred.
+type ValidationReason int
+
+const (
+	// ReasonNotAResponse means the message does not have the QR bit set.
+	ReasonNotAResponse = ValidationReason(iota)
+
+	// ReasonIDMismatch means the response ID differs from the query ID.
+	ReasonIDMismatch
+
+	// ReasonQuestionCount means the response does not contain any question.
+	//
+	// Responses containing more than one question fail with
+	// [ReasonExtraQuestions] instead.
+	ReasonQuestionCount
+
+	// ReasonNameMismatch means the response question name differs from
+	// the query question name, ignoring the case.
+	ReasonNameMismatch
+
+	// ReasonClassMismatch means the response question class differs
+	// from the query question class.
+	ReasonClassMismatch
+
+	// ReasonTypeMismatch means the response question type differs
+	// from the query question type.
+	ReasonTypeMismatch
+
+	// ReasonCaseMismatch means the response question name does not have
+	// exactly the same case of the query question name.
+	ReasonCaseMismatch
+
+	// ReasonExtraQuestions means the response contains more than one
+	// question, e.g., because the server echoes extra questions.
+	ReasonExtraQuestions
 )
 
+// String implements [fmt.Stringer].
+func (r ValidationReason) String() string {
+	switch r {
+	case ReasonNotAResponse:
+		return "NotAResponse"
+	case ReasonIDMismatch:
+		return "IDMismatch"
+	case ReasonQuestionCount:
+		return "QuestionCount"
+	case ReasonNameMismatch:
+		return "NameMismatch"
+	case ReasonClassMismatch:
+		return "ClassMismatch"
+	case ReasonTypeMismatch:
+		return "TypeMismatch"
+	case ReasonCaseMismatch:
+		return "CaseMismatch"
+	case ReasonExtraQuestions:
+		return "ExtraQuestions"
+	default:
+		return fmt.Sprintf("ValidationReason(%d)", int(r))
+	}
+}
+
+// ValidationError is the error returned when a response is not valid
+// for the query. It wraps [ErrInvalidResponse], therefore errors.Is
+// checks against [ErrInvalidResponse] still work as intended.
+type ValidationError struct {
+	// Reason is the reason why the validation failed.
+	Reason ValidationReason
+
+	// Expected is the expected value (e.g., the query ID).
+	Expected string
+
+	// Actual is the value contained in the response.
+	Actual string
+}
+
+// Error implements error.
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%s: %s: expected %q, got %q",
+		ErrInvalidResponse.Error(), e.Reason, e.Expected, e.Actual)
+}
+
+// Unwrap returns [ErrInvalidResponse].
+func (e *ValidationError) Unwrap() error {
+	return ErrInvalidResponse
+}
+
+// newValidationError creates a new [*ValidationError].
+func newValidationError(reason ValidationReason, expected, actual any) error {
+	return &ValidationError{
+		Reason:   reason,
+		Expected: fmt.Sprint(expected),
+		Actual:   fmt.Sprint(actual),
+	}
+}
+
 // ValidateResponseForQuery validates a DNS response for a given query.
 // On success it returns the single validated question from the query.
+//
+// The question names are compared case insensitively and regardless of
+// whether they are fully qualified, since a query message built by other
+// code may lack the trailing dot. The returned question name is always
+// fully qualified.
+//
+// A response that matches the query but has the TC bit set causes this
+// function to return [ErrTruncatedResponse], which is distinct from
+// [ErrInvalidResponse]. This is not a hard failure but rather a signal
+// that the caller should retry the query using TCP.
+//
+// When the response does not match the query, this function returns a
+// [*ValidationError] wrapping [ErrInvalidResponse].
 func ValidateResponseForQuery(query, resp *dns.Msg) (dns.Question, error) {
 	// 1. make sure the message is actually a response
 	if !resp.Response {
-		return dns.Question{}, ErrInvalidResponse
+		return dns.Question{}, newValidationError(ReasonNotAResponse, true, false)
 	}
 
 	// 2. make sure the response ID matches the query ID
 	if resp.Id != query.Id {
-		return dns.Question{}, ErrInvalidResponse
+		return dns.Question{}, newValidationError(ReasonIDMismatch, query.Id, resp.Id)
 	}
 
 	// 3. make sure the query and the response contains a question
-	if len(query.Question) != 1 {
+	switch {
+	case len(query.Question) == 0:
 		return dns.Question{}, ErrInvalidQuery
+	case len(query.Question) > 1:
+		return dns.Question{}, ErrMultipleQuestions
 	}
-	if len(resp.Question) != 1 {
-		return dns.Question{}, ErrInvalidResponse
+	switch {
+	case len(resp.Question) == 0:
+		return dns.Question{}, newValidationError(ReasonQuestionCount, 1, 0)
+	case len(resp.Question) > 1:
+		return dns.Question{}, newValidationError(ReasonExtraQuestions, 1, len(resp.Question))
 	}
 	resp0 := resp.Question[0]
 	query0 := query.Question[0]
 
 	// 4. make sure the question name is correct
+	query0.Name = dns.Fqdn(query0.Name)
 	if !responseEqualASCIIName(resp0.Name, query0.Name) {
-		return dns.Question{}, ErrInvalidResponse
+		return dns.Question{}, newValidationError(ReasonNameMismatch, query0.Name, resp0.Name)
 	}
 	if resp0.Qclass != query0.Qclass {
-		return dns.Question{}, ErrInvalidResponse
+		return dns.Question{}, newValidationError(
+			ReasonClassMismatch, dns.Class(query0.Qclass), dns.Class(resp0.Qclass))
 	}
 	if resp0.Qtype != query0.Qtype {
-		return dns.Question{}, ErrInvalidResponse
+		return dns.Question{}, newValidationError(
+			ReasonTypeMismatch, dns.Type(query0.Qtype), dns.Type(resp0.Qtype))
+	}
+
+	// 5. make sure the response is not truncated
+	if resp.Truncated {
+		return dns.Question{}, ErrTruncatedResponse
 	}
 	return query0, nil
 }
 
+// ValidateResponse0x20 is like [ValidateResponseForQuery] but additionally
+// requires the response question name to have exactly the same case of the
+// query question name.
+//
+// Use this function along with [QueryFlag0x20Randomize] to detect spoofed
+// responses, which are unlikely to guess the randomized case.
+func ValidateResponse0x20(query, resp *dns.Msg) (dns.Question, error) {
+	q0, err := ValidateResponseForQuery(query, resp)
+	if err != nil {
+		return dns.Question{}, err
+	}
+	if dns.Fqdn(resp.Question[0].Name) != q0.Name {
+		return dns.Question{}, newValidationError(ReasonCaseMismatch, q0.Name, resp.Question[0].Name)
+	}
+	return q0, nil
+}
+
 // SPDX-License-Identifier: BSD-3-Clause
 //
-// Borrowed from Go src/net package.
+// Borrowed from Go src/net package and modified to ensure
+// both names are fully qualified before comparing them.
 func responseEqualASCIIName(x, y string) bool {
+	x, y = dns.Fqdn(x), dns.Fqdn(y)
 	if len(x) != len(y) {
 		return false
 	}
@@ -109,6 +269,17 @@ var (
 	ErrNoData = errors.New("no answer from DNS server")
 )
 
+// Errors emitted by [ResponseErrorFromRCODE] for extended RCODEs (RFC6891).
+var (
+	// ErrBadEDNSVersion indicates that the server response code is BADVERS,
+	// meaning that the server does not support the query EDNS version.
+	ErrBadEDNSVersion = errors.New("unsupported EDNS version")
+
+	// ErrBadCookie indicates that the server response code is BADCOOKIE,
+	// meaning that the client should retry using the server cookie (RFC7873).
+	ErrBadCookie = errors.New("bad DNS cookie")
+)
+
 // ResponseErrorFromRCODE maps an RCODE inside a valid DNS response
 // to an error string using a suffix compatible with the error strings
 // returned by [*net.Resolver].
@@ -116,34 +287,122 @@ var (
 // For example, if a domain does not exist, the error
 // will use the "no such host" suffix.
 //
-// If the RCODE is zero, this function returns nil.
+// If the RCODE is zero, this function returns nil, unless the response
+// looks like a lame referral (see [*Response.IsLameReferral]), in which
+// case it returns [ErrNoData]. Since authoritative servers usually do not
+// set the RA bit, use [WithReferrals] to have [ParseResponse] accept their
+// referrals rather than relying on this heuristic.
+//
+// When the response contains an OPT record, this function uses the
+// extended RCODE (RFC6891), maps BADVERS to [ErrBadEDNSVersion] and
+// BADCOOKIE to [ErrBadCookie], and maps any other extended RCODE
+// to [ErrServerMisbehaving].
+//
+// When the error derives from a nonzero RCODE, the returned error is
+// a [*RCODEError] wrapping the sentinel error, which allows to recover
+// the RCODE using [errors.As] while preserving [errors.Is] checks.
 //
 // Before invoking this function, make sure the response is valid
 // for the request by calling [ValidateResponseForQuery].
 func ResponseErrorFromRCODE(resp *dns.Msg) error {
+	rcode := responseFullRcode(resp)
+
 	// 1. handle NXDOMAIN case by mapping it to EAI_NONAME
-	if resp.Rcode == dns.RcodeNameError {
-		return ErrNoName
+	if rcode == dns.RcodeNameError {
+		return &RCODEError{Rcode: rcode, Err: ErrNoName}
 	}
 
 	// 2. handle the case of lame referral by mapping it to EAI_NODATA
-	if resp.Rcode == dns.RcodeSuccess &&
-		!resp.Authoritative &&
-		!resp.RecursionAvailable &&
-		len(resp.Answer) == 0 {
+	if responseIsLameReferral(resp) {
 		return ErrNoData
 	}
 
-	// 3. handle any other error by mapping to EAI_FAIL
-	if resp.Rcode != dns.RcodeSuccess {
-		if resp.Rcode == dns.RcodeServerFailure {
-			return ErrServerTemporarilyMisbehaving
+	// 3. handle the extended RCODEs having a specific meaning
+	switch rcode {
+	case dns.RcodeBadVers:
+		return &RCODEError{Rcode: rcode, Err: ErrBadEDNSVersion}
+	case dns.RcodeBadCookie:
+		return &RCODEError{Rcode: rcode, Err: ErrBadCookie}
+	}
+
+	// 4. handle any other error by mapping to EAI_FAIL
+	if rcode != dns.RcodeSuccess {
+		if rcode == dns.RcodeServerFailure {
+			return &RCODEError{Rcode: rcode, Err: ErrServerTemporarilyMisbehaving}
 		}
-		return ErrServerMisbehaving
+		return &RCODEError{Rcode: rcode, Err: ErrServerMisbehaving}
 	}
 	return nil
 }
 
+// responseIsLameReferral returns whether the response is a lame referral,
+// i.e., a NOERROR response without answers where neither the AA bit
+// nor the RA bit are set.
+func responseIsLameReferral(resp *dns.Msg) bool {
+	candidate, _ := responseClassifyReferral(resp, "")
+	return candidate && !resp.RecursionAvailable
+}
+
+// responseClassifyReferral implements the checks shared by all the
+// referral predicates, such that they cannot diverge.
+//
+// The candidate return value is true for NOERROR responses without the
+// AA bit and without answers, which may be referrals. The delegates
+// return value is true when the authority section contains NS records
+// and no SOA records. When qname is not empty, only the NS records
+// owned by qname or by one of its ancestors count.
+func responseClassifyReferral(resp *dns.Msg, qname string) (candidate, delegates bool) {
+	candidate = responseFullRcode(resp) == dns.RcodeSuccess && !resp.Authoritative && len(resp.Answer) == 0
+	var hasNS, hasSOA bool
+	for _, rr := range resp.Ns {
+		switch rr.(type) {
+		case *dns.NS:
+			if qname == "" || dns.IsSubDomain(rr.Header().Name, qname) {
+				hasNS = true
+			}
+		case *dns.SOA:
+			hasSOA = true
+		}
+	}
+	return candidate, hasNS && !hasSOA
+}
+
+// responseFullRcode returns the 12-bit RCODE obtained by combining the
+// 4 bits in the header with the 8 high bits in the OPT record (RFC6891).
+//
+// Note that [*dns.Msg.Unpack] already merges the high bits into the
+// header RCODE, so this function is idempotent for unpacked messages.
+func responseFullRcode(resp *dns.Msg) int {
+	rcode := resp.Rcode
+	if opt := resp.IsEdns0(); opt != nil {
+		rcode |= opt.ExtendedRcode()
+	}
+	return rcode
+}
+
+// RCODEError is the error returned by [ResponseErrorFromRCODE] when the
+// response contains a nonzero RCODE.
+type RCODEError struct {
+	// Rcode is the RCODE contained in the response.
+	Rcode int
+
+	// Err is the sentinel error corresponding to the RCODE.
+	Err error
+}
+
+// Error implements error.
+//
+// The error string is the one of the wrapped sentinel error, thus
+// preserving the suffixes compatible with [*net.Resolver].
+func (e *RCODEError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the wrapped sentinel error.
+func (e *RCODEError) Unwrap() error {
+	return e.Err
+}
+
 // ResponseExtractValidAnswers extracts valid RRs from the response considering
 // the DNS question that was asked. Before invoking this function, make sure
 // the response is valid using [ValidateResponseForQuery] and it does not contain
@@ -152,7 +411,135 @@ func ResponseErrorFromRCODE(resp *dns.Msg) error {
 // The list of valid RRs is returned in the same order as they appear
 // in the response message. If the response does not contain any valid
 // RRs, this function returns [ErrNoData].
+//
+// DNAME records (RFC6672) whose owner is an ancestor of a name in the
+// chain rewrite such a name and are included in the valid RRs.
+//
+// Because this function does not filter by type, for ANY queries (see
+// [NewQueryANY]) the valid RRs contain all the RRs owned by the names
+// in the chain, whatever their type.
+//
+// This function returns [ErrCNAMELoop] if the CNAME chain is cyclic and
+// [ErrCNAMEChainTooLong] if the CNAME chain is longer than
+// [DefaultMaxCNAMEChainLength] records.
 func ResponseExtractValidAnswers(q0 dns.Question, resp *dns.Msg) ([]dns.RR, error) {
+	valid, _, err := responseExtractValidAnswers(q0, resp, DefaultMaxCNAMEChainLength)
+	return valid, err
+}
+
+// DefaultMaxCNAMEChainLength is the default maximum number of CNAME
+// records that we follow when extracting the valid answers.
+const DefaultMaxCNAMEChainLength = 16
+
+// Errors emitted when following the CNAME chain.
+var (
+	// ErrCNAMELoop indicates that the CNAME chain is cyclic.
+	ErrCNAMELoop = errors.New("CNAME loop in DNS response")
+
+	// ErrCNAMEChainTooLong indicates that the CNAME chain is too long.
+	ErrCNAMEChainTooLong = errors.New("CNAME chain too long in DNS response")
+)
+
+// ErrTypeMismatch indicates that the response does not contain any
+// answer of the query type at the end of the CNAME chain.
+var ErrTypeMismatch = errors.New("no answer matching the query type")
+
+// ResponseExtractValidAnswersWithAdditional is like [ResponseExtractValidAnswers]
+// but also includes the pertinent RRs contained in the additional section.
+//
+// An additional RR is pertinent when its name is part of the CNAME chain or
+// is the target of a valid SRV, MX, NS, SVCB, or HTTPS answer, thus allowing
+// to obtain the glue A and AAAA records in a single round trip. Meta RRs,
+// including the OPT pseudo-record, are never included.
+//
+// The additional RRs follow the answer RRs and retain their order.
+func ResponseExtractValidAnswersWithAdditional(q0 dns.Question, resp *dns.Msg) ([]dns.RR, error) {
+	valid, chain, err := responseExtractValidAnswers(q0, resp, DefaultMaxCNAMEChainLength)
+	if err != nil {
+		return nil, err
+	}
+	return responseAppendAdditional(q0, resp, valid, chain), nil
+}
+
+// responseAppendAdditional appends to valid the pertinent additional RRs.
+func responseAppendAdditional(q0 dns.Question, resp *dns.Msg, valid []dns.RR, chain *responseCNAMEChain) []dns.RR {
+	// 1. collect the names whose RRs are pertinent
+	names := maps.Clone(chain.names)
+	for _, rr := range valid {
+		switch rr := rr.(type) {
+		case *dns.SRV:
+			names[responseCanonicalName(rr.Target)] = true
+		case *dns.MX:
+			names[responseCanonicalName(rr.Mx)] = true
+		case *dns.NS:
+			names[responseCanonicalName(rr.Ns)] = true
+		case *dns.SVCB:
+			names[responseSVCBTarget(rr.Hdr.Name, rr.Target)] = true
+		case *dns.HTTPS:
+			names[responseSVCBTarget(rr.Hdr.Name, rr.Target)] = true
+		}
+	}
+
+	// 2. append the pertinent additional RRs
+	for _, rr := range resp.Extra {
+		if IsMetaRR(rr) {
+			continue
+		}
+		header := rr.Header()
+		if header.Class != q0.Qclass || !names[responseCanonicalName(header.Name)] {
+			continue
+		}
+		valid = append(valid, rr)
+	}
+	return valid
+}
+
+// responseSVCBTarget returns the canonical SVCB target name, which is
+// the owner name when the target is "." as documented by RFC9460.
+func responseSVCBTarget(owner, target string) string {
+	if target == "." {
+		return responseCanonicalName(owner)
+	}
+	return responseCanonicalName(target)
+}
+
+// ResponseExtractValidAnswersStrict is like [ResponseExtractValidAnswers]
+// but additionally requires the response to contain at least one RR of
+// the query type at the name terminating the CNAME chain.
+//
+// [ResponseExtractValidAnswers] is lenient and returns all the RRs whose
+// name belongs to the CNAME chain, regardless of their type, thus accepting
+// responses containing only CNAME records. Conversely, this function
+// returns [ErrTypeMismatch] for such responses, e.g., when a resolver
+// returns a CNAME chain without the terminal A or AAAA records.
+//
+// When the query type is CNAME, any CNAME in the chain satisfies this
+// requirement. When the query type is ANY, any RR at the terminal
+// name satisfies this requirement.
+func ResponseExtractValidAnswersStrict(q0 dns.Question, resp *dns.Msg) ([]dns.RR, error) {
+	valid, chain, err := responseExtractValidAnswers(q0, resp, DefaultMaxCNAMEChainLength)
+	if err != nil {
+		return nil, err
+	}
+	for _, rr := range valid {
+		header := rr.Header()
+		if q0.Qtype == dns.TypeCNAME && header.Rrtype == dns.TypeCNAME {
+			return valid, nil
+		}
+		if responseCanonicalName(header.Name) != chain.terminal {
+			continue
+		}
+		if q0.Qtype == dns.TypeANY || header.Rrtype == q0.Qtype {
+			return valid, nil
+		}
+	}
+	return nil, ErrTypeMismatch
+}
+
+// responseExtractValidAnswers implements [ResponseExtractValidAnswers] and
+// also returns the CNAME chain used to select the valid RRs.
+func responseExtractValidAnswers(
+	q0 dns.Question, resp *dns.Msg, maxChainLength int) ([]dns.RR, *responseCNAMEChain, error) {
 	// 1. Build CNAME chain starting from the query name.
 	// RFC 1034 section 4.3.1 says that "the recursive response to a query
 	// will be... The answer to the query, possibly preface by one or more
@@ -161,20 +548,11 @@ func ResponseExtractValidAnswers(q0 dns.Question, resp *dns.Msg) ([]dns.RR, erro
 	// We need to validate that CNAMEs form a proper chain and track all
 	// valid names in that chain. We try to be careful and account for the
 	// names potentially being not canonicalized in the response.
-	validNames := make(map[string]bool)
-	validNames[responseCanonicalName(q0.Name)] = true
-
-	currentName := q0.Name
-	for _, answer := range resp.Answer {
-		if cname, ok := answer.(*dns.CNAME); ok {
-			header := cname.Header()
-			// CNAME must match the current name in the chain
-			if responseEqualASCIIName(currentName, header.Name) && header.Class == q0.Qclass {
-				currentName = responseCanonicalName(cname.Target)
-				validNames[currentName] = true
-			}
-		}
+	chain, err := responseFollowCNAMEChain(q0, resp.Answer, maxChainLength)
+	if err != nil {
+		return nil, nil, err
 	}
+	validNames := chain.names
 
 	// 2. Build list of valid answers: CNAMEs that are part of the chain,
 	// plus any other RRs that match a name in the chain.
@@ -182,8 +560,9 @@ func ResponseExtractValidAnswers(q0 dns.Question, resp *dns.Msg) ([]dns.RR, erro
 	for _, answer := range resp.Answer {
 		header := answer.Header()
 
-		// Check if this RR's name is part of the valid chain
-		if !validNames[responseCanonicalName(header.Name)] {
+		// Check if this RR's name is part of the valid chain or the RR
+		// is a DNAME that was used to rewrite a name in the chain
+		if !validNames[responseCanonicalName(header.Name)] && !chain.dnames[answer] {
 			continue
 		}
 
@@ -192,6 +571,11 @@ func ResponseExtractValidAnswers(q0 dns.Question, resp *dns.Msg) ([]dns.RR, erro
 			continue
 		}
 
+		// Skip transaction-specific pseudo-records
+		if IsMetaRR(answer) {
+			continue
+		}
+
 		// Note: there may be several RR types for a given query so we
 		// should not check for the type here
 		valid = append(valid, answer)
@@ -199,11 +583,117 @@ func ResponseExtractValidAnswers(q0 dns.Question, resp *dns.Msg) ([]dns.RR, erro
 
 	// 3. Handle the case of no valid answers
 	if len(valid) < 1 {
-		return nil, ErrNoData
+		return nil, nil, ErrNoData
 	}
 
 	// 4. Return the list.
-	return valid, nil
+	return valid, chain, nil
+}
+
+// IsMetaRR returns whether rr is a transaction-specific meta RR rather than data.
+//
+// Meta RRs are OPT, TSIG, TKEY, and SIG(0) records. They must be excluded
+// when comparing the content of responses, since they would otherwise
+// make responses carrying the same data differ.
+func IsMetaRR(rr dns.RR) bool {
+	switch rr.Header().Rrtype {
+	case dns.TypeOPT, dns.TypeTSIG, dns.TypeTKEY:
+		return true
+	case dns.TypeSIG:
+		sig, ok := rr.(*dns.SIG)
+		return ok && sig.TypeCovered == 0
+	default:
+		return false
+	}
+}
+
+// responseCNAMEChain is the result of following a CNAME chain.
+type responseCNAMEChain struct {
+	// dnames contains the DNAME records used to rewrite names in the chain.
+	dnames map[dns.RR]bool
+
+	// names contains the canonical names in the chain.
+	names map[string]bool
+
+	// terminal is the canonical name at the end of the chain.
+	terminal string
+}
+
+// responseFollowCNAMEChain follows the CNAME chain starting from the query
+// name considering the CNAME records in rrs in the order in which they appear.
+//
+// A DNAME record whose owner is an ancestor of the current name also
+// continues the chain by rewriting the current name as documented by
+// RFC6672 section 2.2. The synthesized CNAME that usually follows the
+// DNAME is accepted because its owner is already part of the chain.
+//
+// This function returns [ErrCNAMELoop] if a CNAME target is already part of
+// the chain and [ErrCNAMEChainTooLong] if the chain contains more than
+// maxLength CNAME or DNAME records.
+func responseFollowCNAMEChain(q0 dns.Question, rrs []dns.RR, maxLength int) (*responseCNAMEChain, error) {
+	chain := &responseCNAMEChain{
+		dnames:   map[dns.RR]bool{},
+		names:    map[string]bool{responseCanonicalName(q0.Name): true},
+		terminal: responseCanonicalName(q0.Name),
+	}
+	currentName := q0.Name
+	var length int
+	for _, rr := range rrs {
+		if rr.Header().Class != q0.Qclass {
+			continue
+		}
+		var nextName string
+		switch rr := rr.(type) {
+		case *dns.CNAME:
+			// CNAME must match the current name in the chain
+			if !responseEqualASCIIName(currentName, rr.Hdr.Name) {
+				continue
+			}
+			nextName = responseCanonicalName(rr.Target)
+		case *dns.DNAME:
+			// DNAME owner must be an ancestor of the current name
+			name, ok := responseSubstituteDNAME(currentName, rr)
+			if !ok {
+				continue
+			}
+			chain.dnames[rr] = true
+			nextName = name
+		default:
+			continue
+		}
+		currentName = nextName
+		if chain.names[currentName] {
+			return nil, ErrCNAMELoop
+		}
+		if length++; length > maxLength {
+			return nil, ErrCNAMEChainTooLong
+		}
+		chain.names[currentName] = true
+		chain.terminal = currentName
+	}
+	return chain, nil
+}
+
+// responseSubstituteDNAME rewrites name using the given DNAME record and
+// returns the canonical rewritten name and whether the DNAME applies.
+//
+// The DNAME applies when its owner is a proper ancestor of name and
+// the rewritten name does not exceed the maximum name length.
+func responseSubstituteDNAME(name string, dname *dns.DNAME) (string, bool) {
+	name = responseCanonicalName(name)
+	owner := responseCanonicalName(dname.Hdr.Name)
+	if name == owner || !dns.IsSubDomain(owner, name) {
+		return "", false
+	}
+	prefix := strings.TrimSuffix(name, owner)
+	if owner == "." {
+		prefix = name
+	}
+	rewritten := responseCanonicalName(prefix + dns.Fqdn(dname.Target))
+	if len(rewritten) > 255 {
+		return "", false
+	}
+	return rewritten, true
 }
 
 // Response is a DNS response.
@@ -218,74 +708,1621 @@ type Response struct {
 
 	// ValidRRs contains the valid RRs for the query.
 	ValidRRs []dns.RR
+
+	// IncludeAuthority OPTIONALLY makes [*Response.RecordsNS] and
+	// [*Response.RecordsSOA] also scan the authority section.
+	//
+	// This is useful because servers usually include the SOA in the
+	// authority section of negative responses and the NS records in the
+	// authority section of referrals. Authority RRs are not validated
+	// against the query name, since their owner is the zone name.
+	IncludeAuthority bool
+
+	// Raw contains the raw response bytes.
+	//
+	// This field is only set when the response was parsed from bytes
+	// using [ParseResponseBytes] or [*Query.ValidateAndParse]. Use
+	// [*Response.Bytes] to obtain the bytes in any case.
+	Raw []byte
+
+	// warnings contains the warnings collected when using [WithWarnings].
+	warnings []string
+}
+
+// ParseOption is an option for [ParseResponse].
+type ParseOption func(cfg *parseConfig)
+
+// parseConfig contains the [ParseResponse] configuration.
+type parseConfig struct {
+	additional          bool
+	allowNODATA         bool
+	maxCNAMEChainLength int
+	profile             QueryProfile
+	referrals           bool
+	warnings            bool
+}
+
+// ErrNotAuthoritative indicates that the response does not have the AA bit
+// set even though the [ProfileAuthoritativeProbe] profile requires it.
+var ErrNotAuthoritative = errors.New("non-authoritative DNS response")
+
+// WithAdditional makes [ParseResponse] also include the pertinent additional
+// RRs in the valid RRs. See [ResponseExtractValidAnswersWithAdditional].
+func WithAdditional() ParseOption {
+	return func(cfg *parseConfig) {
+		cfg.additional = true
+	}
+}
+
+// WithAllowNODATA makes [ParseResponse] return a [*Response] with empty
+// valid RRs, rather than [ErrNoData], for NODATA responses whose answer
+// section is empty. See [*Response.IsNODATA] for the NODATA definition.
+//
+// This is useful to distinguish a name that exists but has no RRs of the
+// queried type from responses that cannot be used.
+func WithAllowNODATA() ParseOption {
+	return func(cfg *parseConfig) {
+		cfg.allowNODATA = true
+	}
+}
+
+// WithMaxCNAMEChainLength makes [ParseResponse] fail with [ErrCNAMEChainTooLong]
+// when the CNAME chain contains more than the given number of CNAME records.
+// The default is [DefaultMaxCNAMEChainLength].
+func WithMaxCNAMEChainLength(value int) ParseOption {
+	return func(cfg *parseConfig) {
+		cfg.maxCNAMEChainLength = value
+	}
+}
+
+// WithProfile makes [ParseResponse] interpret the response according to
+// the given [QueryProfile]. The default profile is [ProfileStub].
+func WithProfile(profile QueryProfile) ParseOption {
+	return func(cfg *parseConfig) {
+		cfg.profile = profile
+	}
+}
+
+// WithReferrals makes [ParseResponse] accept referrals rather than
+// failing with [ErrNoData] because of the lame referral heuristic
+// documented in [ResponseErrorFromRCODE], which misfires when querying
+// authoritative servers, since they usually do not set the RA bit.
+//
+// A referral is a NOERROR response without the AA bit and without
+// answers whose authority section contains NS records owned by the
+// queried name or one of its ancestors and no SOA records.
+//
+// For a referral, the returned [*Response] has empty valid RRs and
+// [Response.IncludeAuthority] set, such that [*Response.RecordsNS]
+// returns the name servers of the delegated zone. This option is
+// implied by the [ProfileIterative] profile.
+func WithReferrals() ParseOption {
+	return func(cfg *parseConfig) {
+		cfg.referrals = true
+	}
+}
+
+// WithWarnings makes [ParseResponse] run soft conformance checks and
+// attach the collected warnings to the returned [*Response].
+//
+// The soft checks flag anomalies (e.g., opcode mismatch, multiple OPT
+// records, misplaced OPT records, answer RRs with a foreign class, or
+// a response not echoing the query RD bit) that do not cause
+// [ParseResponse] to fail. Use [*Response.Warnings]
+// to obtain the collected warnings.
+func WithWarnings() ParseOption {
+	return func(cfg *parseConfig) {
+		cfg.warnings = true
+	}
 }
 
 // ParseResponse returns a [*Response] given a query and response messages or an
 // error if the two response message is not valid for the query.
-func ParseResponse(query *dns.Msg, resp *dns.Msg) (*Response, error) {
+func ParseResponse(query *dns.Msg, resp *dns.Msg, options ...ParseOption) (*Response, error) {
+	cfg := &parseConfig{maxCNAMEChainLength: DefaultMaxCNAMEChainLength}
+	for _, option := range options {
+		option(cfg)
+	}
+
 	q0, err := ValidateResponseForQuery(query, resp)
 	if err != nil {
 		return nil, err
 	}
 
+	if cfg.profile == ProfileAuthoritativeProbe && !resp.Authoritative {
+		return nil, ErrNotAuthoritative
+	}
+
+	if (cfg.referrals || cfg.profile == ProfileIterative) && responseIsDelegation(q0, resp) {
+		rp := &Response{
+			Query:            query,
+			Response:         resp,
+			ValidRRs:         []dns.RR{},
+			IncludeAuthority: true,
+		}
+		if cfg.warnings {
+			rp.warnings = responseCollectWarnings(query, resp, q0)
+		}
+		return rp, nil
+	}
+
 	if err := ResponseErrorFromRCODE(resp); err != nil {
 		return nil, err
 	}
 
-	rrs, err := ResponseExtractValidAnswers(q0, resp)
-	if err != nil {
+	rrs, chain, err := responseExtractValidAnswers(q0, resp, cfg.maxCNAMEChainLength)
+	switch {
+	case err == nil:
+	case errors.Is(err, ErrNoData) && cfg.allowNODATA &&
+		len(resp.Answer) == 0 && responseIsNODATA(q0, resp, nil):
+		rrs = []dns.RR{}
+	default:
 		return nil, err
 	}
+	if cfg.additional && chain != nil {
+		rrs = responseAppendAdditional(q0, resp, rrs, chain)
+	}
 
 	rp := &Response{
 		Query:    query,
 		Response: resp,
 		ValidRRs: rrs,
 	}
+	if cfg.warnings {
+		rp.warnings = responseCollectWarnings(query, resp, q0)
+	}
 	return rp, nil
 }
 
-// RecordsA returns all the A records in the response.
-func (r *Response) RecordsA() ([]string, error) {
-	out := make([]string, 0, len(r.ValidRRs))
-	for _, rr := range r.ValidRRs {
-		switch rr := rr.(type) {
-		case *dns.A:
-			out = append(out, rr.A.String())
-		}
+// ParseResponseBytes is like [ParseResponse] but takes the raw response
+// bytes and unpacks them before validating the response. On success,
+// the returned [*Response] contains a copy of the raw bytes.
+//
+// This function returns [ErrCannotUnmarshalMessage] if the raw bytes
+// are empty, truncated, or otherwise cannot be unpacked.
+//
+// Because the raw bytes usually come from the network, this function also
+// recovers from any panic occurring while unpacking adversarial input and
+// converts it into an [ErrCannotUnmarshalMessage] error.
+func ParseResponseBytes(query *dns.Msg, raw []byte, options ...ParseOption) (*Response, error) {
+	resp := new(dns.Msg)
+	if err := responseRecoverPanic(func() error { return resp.Unpack(raw) }); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrCannotUnmarshalMessage, err.Error())
 	}
-	if len(out) < 1 {
-		return nil, ErrNoData
+	rp, err := ParseResponse(query, resp, options...)
+	if err != nil {
+		return nil, err
 	}
-	return out, nil
+	rp.Raw = slices.Clone(raw)
+	return rp, nil
 }
 
-// RecordsAAAA returns all the AAAA records in the response.
-func (r *Response) RecordsAAAA() ([]string, error) {
-	out := make([]string, 0, len(r.ValidRRs))
-	for _, rr := range r.ValidRRs {
-		switch rr := rr.(type) {
-		case *dns.AAAA:
-			out = append(out, rr.AAAA.String())
+// responseRecoverPanic invokes fx and converts any panic into an error.
+func responseRecoverPanic(fx func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("recovered from panic: %v", r)
 		}
+	}()
+	return fx()
+}
+
+// ValidateAndParse is like [ParseResponseBytes] but uses the [*Query]
+// to build the query message against which to validate the response.
+//
+// The query message is built using [*Query.NewMsg], hence the response
+// must match the [Query.ID] field. This method does not generate a new
+// ID, so it is safe to call it after sending [*Query.Pack] bytes.
+func (q *Query) ValidateAndParse(raw []byte, options ...ParseOption) (*Response, error) {
+	query, err := q.NewMsg()
+	if err != nil {
+		return nil, err
 	}
-	if len(out) < 1 {
-		return nil, ErrNoData
-	}
-	return out, nil
+	return ParseResponseBytes(query, raw, options...)
 }
 
-// RecordsCNAME returns all the CNAME records in the response.
-func (r *Response) RecordsCNAME() ([]string, error) {
-	out := make([]string, 0, len(r.ValidRRs))
-	for _, rr := range r.ValidRRs {
-		switch rr := rr.(type) {
-		case *dns.CNAME:
-			out = append(out, rr.Target)
+// responseCollectWarnings runs the soft conformance checks.
+func responseCollectWarnings(query, resp *dns.Msg, q0 dns.Question) []string {
+	warnings := []string{}
+
+	// 1. the response opcode should match the query opcode
+	if resp.Opcode != query.Opcode {
+		warnings = append(warnings, fmt.Sprintf(
+			"opcode mismatch: query %s, response %s",
+			dns.OpcodeToString[query.Opcode], dns.OpcodeToString[resp.Opcode],
+		))
+	}
+
+	// 2. the OPT record should only appear once in the additional section
+	var numOPT int
+	for _, rr := range resp.Extra {
+		if _, ok := rr.(*dns.OPT); ok {
+			numOPT++
 		}
 	}
-	if len(out) < 1 {
-		return nil, ErrNoData
+	if numOPT > 1 {
+		warnings = append(warnings, fmt.Sprintf(
+			"multiple OPT records in additional section: %d", numOPT,
+		))
 	}
-	return out, nil
+	for _, rr := range resp.Answer {
+		if _, ok := rr.(*dns.OPT); ok {
+			warnings = append(warnings, "OPT record in answer section")
+		}
+	}
+	for _, rr := range resp.Ns {
+		if _, ok := rr.(*dns.OPT); ok {
+			warnings = append(warnings, "OPT record in authority section")
+		}
+	}
+
+	// 3. answer RRs should have the same class of the question
+	for _, rr := range resp.Answer {
+		header := rr.Header()
+		if _, ok := rr.(*dns.OPT); ok || header.Class == q0.Qclass {
+			continue
+		}
+		warnings = append(warnings, fmt.Sprintf(
+			"answer RR for %s has class %s, expected %s",
+			header.Name, dns.ClassToString[header.Class], dns.ClassToString[q0.Qclass],
+		))
+	}
+
+	// 4. ANY queries may receive a minimal response (RFC8482 section 4.2)
+	if q0.Qtype == dns.TypeANY && len(resp.Answer) == 1 {
+		if hinfo, ok := resp.Answer[0].(*dns.HINFO); ok && hinfo.Cpu == "RFC8482" {
+			warnings = append(warnings, "minimal RFC8482 response to ANY query")
+		}
+	}
+
+	// 5. the response should echo the RD bit (RFC1035 section 4.1.1)
+	//
+	// Some spoofers do not copy the RD bit, therefore a mismatch is a
+	// useful signal, but we do not reject the response because also
+	// some broken servers and middleboxes do not copy it.
+	if resp.RecursionDesired != query.RecursionDesired {
+		warnings = append(warnings, fmt.Sprintf(
+			"RD bit not echoed: query %t, response %t",
+			query.RecursionDesired, resp.RecursionDesired,
+		))
+	}
+
+	return warnings
+}
+
+// Warnings returns the warnings collected by the soft conformance checks.
+//
+// This method returns an empty list unless [ParseResponse] was
+// invoked using the [WithWarnings] option.
+func (r *Response) Warnings() []string {
+	return r.warnings
+}
+
+// Bytes returns the raw response bytes.
+//
+// When [Response.Raw] is set, this method returns it, otherwise it packs
+// the response message. Note that packing may not reproduce the original
+// bytes (e.g., because of name compression or EDNS(0) options).
+func (r *Response) Bytes() ([]byte, error) {
+	if r.Raw != nil {
+		return r.Raw, nil
+	}
+	return r.Response.Pack()
+}
+
+// ResponseUnicodeName converts a name returned by a DNS server, which
+// uses punycode for internationalized labels (e.g., "xn--bcher-kva.example."),
+// to its Unicode form (e.g., "bücher.example.") suitable for display.
+//
+// Names that are already ASCII are returned unchanged. This function
+// returns an error when a punycode label cannot be decoded.
+func ResponseUnicodeName(name string) (string, error) {
+	unicodeName, err := idna.ToUnicode(name)
+	if err != nil {
+		return "", err
+	}
+	return unicodeName, nil
+}
+
+// ResponseStats contains statistics about a [*Response].
+//
+// Construct using [*Response.Stats].
+type ResponseStats struct {
+	// WireSize is the size of the response in octets or zero when unknown.
+	WireSize int
+
+	// AnswerCount is the number of RRs in the answer section.
+	AnswerCount int
+
+	// AuthorityCount is the number of RRs in the authority section.
+	AuthorityCount int
+
+	// AdditionalCount is the number of RRs in the additional section,
+	// including the OPT pseudo-RR, if any, as in the ARCOUNT header field.
+	AdditionalCount int
+
+	// ValidAnswerCount is the number of valid RRs.
+	ValidAnswerCount int
+}
+
+// Stats returns statistics about the response.
+//
+// The wire size is computed on a best-effort basis using [*Response.Bytes],
+// so it is exact only when [Response.Raw] is set. When the response message
+// is missing or cannot be packed, the wire size is zero.
+func (r *Response) Stats() ResponseStats {
+	stats := ResponseStats{ValidAnswerCount: len(r.ValidRRs)}
+	if r.Raw != nil || r.Response != nil {
+		if data, err := r.Bytes(); err == nil {
+			stats.WireSize = len(data)
+		}
+	}
+	if r.Response != nil {
+		stats.AnswerCount = len(r.Response.Answer)
+		stats.AuthorityCount = len(r.Response.Ns)
+		stats.AdditionalCount = len(r.Response.Extra)
+	}
+	return stats
+}
+
+// RecordsA returns all the A records in the response.
+func (r *Response) RecordsA() ([]string, error) {
+	out := make([]string, 0, len(r.ValidRRs))
+	for _, rr := range r.ValidRRs {
+		switch rr := rr.(type) {
+		case *dns.A:
+			out = append(out, rr.A.String())
+		}
+	}
+	if len(out) < 1 {
+		return nil, ErrNoData
+	}
+	return out, nil
+}
+
+// RecordFirstA returns the first A record in the response.
+//
+// The record is the first one that [*Response.RecordsA] would return.
+func (r *Response) RecordFirstA() (string, error) {
+	for _, rr := range r.ValidRRs {
+		switch rr := rr.(type) {
+		case *dns.A:
+			return rr.A.String(), nil
+		}
+	}
+	return "", ErrNoData
+}
+
+// RecordsAAAA returns all the AAAA records in the response.
+func (r *Response) RecordsAAAA() ([]string, error) {
+	out := make([]string, 0, len(r.ValidRRs))
+	for _, rr := range r.ValidRRs {
+		switch rr := rr.(type) {
+		case *dns.AAAA:
+			out = append(out, rr.AAAA.String())
+		}
+	}
+	if len(out) < 1 {
+		return nil, ErrNoData
+	}
+	return out, nil
+}
+
+// RecordFirstAAAA returns the first AAAA record in the response.
+//
+// The record is the first one that [*Response.RecordsAAAA] would return.
+func (r *Response) RecordFirstAAAA() (string, error) {
+	for _, rr := range r.ValidRRs {
+		switch rr := rr.(type) {
+		case *dns.AAAA:
+			return rr.AAAA.String(), nil
+		}
+	}
+	return "", ErrNoData
+}
+
+// RecordsCNAME returns all the CNAME records in the response.
+func (r *Response) RecordsCNAME() ([]string, error) {
+	out := make([]string, 0, len(r.ValidRRs))
+	for _, rr := range r.ValidRRs {
+		switch rr := rr.(type) {
+		case *dns.CNAME:
+			out = append(out, rr.Target)
+		}
+	}
+	if len(out) < 1 {
+		return nil, ErrNoData
+	}
+	return out, nil
+}
+
+// RecordFirstCNAME returns the first CNAME record in the response.
+//
+// The record is the first one that [*Response.RecordsCNAME] would return.
+func (r *Response) RecordFirstCNAME() (string, error) {
+	for _, rr := range r.ValidRRs {
+		switch rr := rr.(type) {
+		case *dns.CNAME:
+			return rr.Target, nil
+		}
+	}
+	return "", ErrNoData
+}
+
+// RecordsMX returns all the MX records in the response.
+//
+// The records are sorted by ascending preference. Records with equal
+// preference retain the order in which they appear in the response, which
+// allows callers to detect server-side randomization.
+func (r *Response) RecordsMX() ([]*dns.MX, error) {
+	out := make([]*dns.MX, 0, len(r.ValidRRs))
+	for _, rr := range r.ValidRRs {
+		switch rr := rr.(type) {
+		case *dns.MX:
+			out = append(out, rr)
+		}
+	}
+	if len(out) < 1 {
+		return nil, ErrNoData
+	}
+	slices.SortStableFunc(out, func(a, b *dns.MX) int {
+		return cmp.Compare(a.Preference, b.Preference)
+	})
+	return out, nil
+}
+
+// RecordsTXT returns all the TXT records in the response.
+//
+// Each record is returned as the list of character strings composing
+// it, which are at most 255 bytes each. Use [*Response.RecordsTXTJoined]
+// to obtain each record as a single string.
+func (r *Response) RecordsTXT() ([][]string, error) {
+	out := make([][]string, 0, len(r.ValidRRs))
+	for _, rr := range r.ValidRRs {
+		switch rr := rr.(type) {
+		case *dns.TXT:
+			out = append(out, rr.Txt)
+		}
+	}
+	if len(out) < 1 {
+		return nil, ErrNoData
+	}
+	return out, nil
+}
+
+// RecordsTXTJoined is like [*Response.RecordsTXT] but joins the character
+// strings composing each record without any separator, as required by
+// RFC 7208 for SPF records. A record without character strings becomes
+// an empty string.
+func (r *Response) RecordsTXTJoined() ([]string, error) {
+	records, err := r.RecordsTXT()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]string, 0, len(records))
+	for _, record := range records {
+		out = append(out, strings.Join(record, ""))
+	}
+	return out, nil
+}
+
+// RecordsSVCB returns all the SVCB records in the response.
+//
+// The records are sorted by ascending priority, so AliasMode records
+// (priority zero) come first. Records with equal priority retain the
+// order in which they appear in the response.
+func (r *Response) RecordsSVCB() ([]*dns.SVCB, error) {
+	out := []*dns.SVCB{}
+	for _, rr := range r.ValidRRs {
+		switch rr := rr.(type) {
+		case *dns.SVCB:
+			out = append(out, rr)
+		}
+	}
+	if len(out) < 1 {
+		return nil, ErrNoData
+	}
+	slices.SortStableFunc(out, func(a, b *dns.SVCB) int {
+		return cmp.Compare(a.Priority, b.Priority)
+	})
+	return out, nil
+}
+
+// RecordsHTTPS is like [*Response.RecordsSVCB] but for HTTPS records.
+func (r *Response) RecordsHTTPS() ([]*dns.HTTPS, error) {
+	out := []*dns.HTTPS{}
+	for _, rr := range r.ValidRRs {
+		switch rr := rr.(type) {
+		case *dns.HTTPS:
+			out = append(out, rr)
+		}
+	}
+	if len(out) < 1 {
+		return nil, ErrNoData
+	}
+	slices.SortStableFunc(out, func(a, b *dns.HTTPS) int {
+		return cmp.Compare(a.Priority, b.Priority)
+	})
+	return out, nil
+}
+
+// RecordsCAA returns all the CAA records in the response.
+//
+// The records retain their Flag field, so callers can honor the
+// critical flag semantics defined by RFC8659.
+func (r *Response) RecordsCAA() ([]*dns.CAA, error) {
+	out := []*dns.CAA{}
+	for _, rr := range r.ValidRRs {
+		switch rr := rr.(type) {
+		case *dns.CAA:
+			out = append(out, rr)
+		}
+	}
+	if len(out) < 1 {
+		return nil, ErrNoData
+	}
+	return out, nil
+}
+
+// CAAIssuers returns the issuer domain names of the CAA records
+// whose tag is "issue" (compared case-insensitively) in response order.
+//
+// Per RFC8659, the issuer domain name is the part of the value preceding
+// any parameter. An "issue" record with an empty issuer domain name forbids
+// issuance, so it does not contribute any issuer. This method returns
+// [ErrNoData] when there are no CAA records.
+func (r *Response) CAAIssuers() ([]string, error) {
+	records, err := r.RecordsCAA()
+	if err != nil {
+		return nil, err
+	}
+	out := []string{}
+	for _, record := range records {
+		if !strings.EqualFold(record.Tag, "issue") {
+			continue
+		}
+		issuer, _, _ := strings.Cut(record.Value, ";")
+		if issuer = strings.TrimSpace(issuer); issuer != "" {
+			out = append(out, issuer)
+		}
+	}
+	return out, nil
+}
+
+// RecordsPTR returns all the PTR records in the response.
+//
+// The names are returned in response order and are fully qualified.
+func (r *Response) RecordsPTR() ([]string, error) {
+	out := make([]string, 0, len(r.ValidRRs))
+	for _, rr := range r.ValidRRs {
+		switch rr := rr.(type) {
+		case *dns.PTR:
+			out = append(out, rr.Ptr)
+		}
+	}
+	if len(out) < 1 {
+		return nil, ErrNoData
+	}
+	return out, nil
+}
+
+// RecordsSRV returns all the SRV records in the response.
+//
+// The records are returned in response order. Use [*Response.RecordsSRVSorted]
+// to obtain the records in the order in which clients should contact them.
+func (r *Response) RecordsSRV() ([]*dns.SRV, error) {
+	out := make([]*dns.SRV, 0, len(r.ValidRRs))
+	for _, rr := range r.ValidRRs {
+		switch rr := rr.(type) {
+		case *dns.SRV:
+			out = append(out, rr)
+		}
+	}
+	if len(out) < 1 {
+		return nil, ErrNoData
+	}
+	return out, nil
+}
+
+// RecordsSRVSorted is like [*Response.RecordsSRV] but returns the records
+// in the order in which clients should contact them according to RFC2782.
+//
+// The records are sorted by ascending priority. Within each priority, the
+// records are ordered using the weighted random selection documented by
+// RFC2782, where records with zero weight have a small chance of being
+// selected before others. The rng argument is the source of randomness
+// and may be nil, in which case we use the [math/rand/v2] top-level
+// functions. Pass a seeded rng to obtain a deterministic order.
+func (r *Response) RecordsSRVSorted(rng *rand.Rand) ([]*dns.SRV, error) {
+	records, err := r.RecordsSRV()
+	if err != nil {
+		return nil, err
+	}
+	intN := rand.IntN
+	if rng != nil {
+		intN = rng.IntN
+	}
+	slices.SortStableFunc(records, func(a, b *dns.SRV) int {
+		return cmp.Compare(a.Priority, b.Priority)
+	})
+	out := make([]*dns.SRV, 0, len(records))
+	for len(records) > 0 {
+		end := 1
+		for end < len(records) && records[end].Priority == records[0].Priority {
+			end++
+		}
+		out = append(out, responseSRVWeightedOrder(records[:end], intN)...)
+		records = records[end:]
+	}
+	return out, nil
+}
+
+// responseSRVWeightedOrder orders records sharing the same priority
+// using the weighted random selection documented by RFC2782.
+func responseSRVWeightedOrder(records []*dns.SRV, intN func(n int) int) []*dns.SRV {
+	// Place the records with zero weight at the beginning of the list
+	pending := make([]*dns.SRV, 0, len(records))
+	for _, rr := range records {
+		if rr.Weight == 0 {
+			pending = append(pending, rr)
+		}
+	}
+	for _, rr := range records {
+		if rr.Weight != 0 {
+			pending = append(pending, rr)
+		}
+	}
+
+	out := make([]*dns.SRV, 0, len(pending))
+	for len(pending) > 0 {
+		var total int
+		for _, rr := range pending {
+			total += int(rr.Weight)
+		}
+		selector := intN(total + 1)
+		var sum, idx int
+		for idx = range pending {
+			sum += int(pending[idx].Weight)
+			if sum >= selector {
+				break
+			}
+		}
+		out = append(out, pending[idx])
+		pending = slices.Delete(pending, idx, idx+1)
+	}
+	return out
+}
+
+// RecordsTLSA returns all the TLSA (RFC6698) records in the response.
+func (r *Response) RecordsTLSA() ([]*dns.TLSA, error) {
+	out := make([]*dns.TLSA, 0, len(r.ValidRRs))
+	for _, rr := range r.ValidRRs {
+		switch rr := rr.(type) {
+		case *dns.TLSA:
+			out = append(out, rr)
+		}
+	}
+	if len(out) < 1 {
+		return nil, ErrNoData
+	}
+	return out, nil
+}
+
+// RecordsNAPTR returns all the NAPTR (RFC3403) records in the response.
+//
+// The records are sorted by ascending order and then by ascending
+// preference, which is the order in which RFC3403 section 4.1 requires
+// to process them. Records with equal order and preference retain the
+// order in which they appear in the response.
+func (r *Response) RecordsNAPTR() ([]*dns.NAPTR, error) {
+	out := make([]*dns.NAPTR, 0, len(r.ValidRRs))
+	for _, rr := range r.ValidRRs {
+		switch rr := rr.(type) {
+		case *dns.NAPTR:
+			out = append(out, rr)
+		}
+	}
+	if len(out) < 1 {
+		return nil, ErrNoData
+	}
+	slices.SortStableFunc(out, responseCompareNAPTR)
+	return out, nil
+}
+
+// responseCompareNAPTR compares NAPTR records by order and then by preference.
+func responseCompareNAPTR(a, b *dns.NAPTR) int {
+	return cmp.Or(cmp.Compare(a.Order, b.Order), cmp.Compare(a.Preference, b.Preference))
+}
+
+// RecordsNS returns the name servers of all the NS records in the response.
+//
+// Set [Response.IncludeAuthority] to also scan the authority section.
+func (r *Response) RecordsNS() ([]string, error) {
+	out := []string{}
+	for _, rr := range r.authorityAwareRRs() {
+		switch rr := rr.(type) {
+		case *dns.NS:
+			out = append(out, rr.Ns)
+		}
+	}
+	if len(out) < 1 {
+		return nil, ErrNoData
+	}
+	return out, nil
+}
+
+// RecordsSOA returns all the SOA records in the response.
+//
+// Set [Response.IncludeAuthority] to also scan the authority section.
+func (r *Response) RecordsSOA() ([]*dns.SOA, error) {
+	out := []*dns.SOA{}
+	for _, rr := range r.authorityAwareRRs() {
+		switch rr := rr.(type) {
+		case *dns.SOA:
+			out = append(out, rr)
+		}
+	}
+	if len(out) < 1 {
+		return nil, ErrNoData
+	}
+	return out, nil
+}
+
+// authorityAwareRRs returns the valid RRs followed by the authority
+// RRs when [Response.IncludeAuthority] is true.
+func (r *Response) authorityAwareRRs() []dns.RR {
+	if !r.IncludeAuthority || r.Response == nil {
+		return r.ValidRRs
+	}
+	out := slices.Clone(r.ValidRRs)
+	return append(out, r.Response.Ns...)
+}
+
+// RecordsUnknown returns all the RRs whose type is unknown to [github.com/miekg/dns],
+// which are represented using the RFC3597 generic format.
+//
+// Each record contains its type in the header Rrtype field and
+// the hex encoded raw RDATA in the Rdata field.
+func (r *Response) RecordsUnknown() ([]*dns.RFC3597, error) {
+	out := []*dns.RFC3597{}
+	for _, rr := range r.ValidRRs {
+		switch rr := rr.(type) {
+		case *dns.RFC3597:
+			out = append(out, rr)
+		}
+	}
+	if len(out) < 1 {
+		return nil, ErrNoData
+	}
+	return out, nil
+}
+
+// RecordsByType returns all the valid RRs whose type is qtype.
+//
+// The records are returned in response order. Unlike the type-specific
+// methods, this method returns an empty list rather than [ErrNoData]
+// when there are no such records, which allows handling types that
+// lack a dedicated method (e.g., SSHFP) without filtering the RRs.
+func (r *Response) RecordsByType(qtype uint16) []dns.RR {
+	out := []dns.RR{}
+	for _, rr := range r.ValidRRs {
+		if rr.Header().Rrtype == qtype {
+			out = append(out, rr)
+		}
+	}
+	return out
+}
+
+// Index returns the valid RRs indexed by their canonical owner name.
+//
+// Each list contains the RRs in response order. Build the index once
+// and reuse it when performing many lookups on the same response.
+func (r *Response) Index() map[string][]dns.RR {
+	out := make(map[string][]dns.RR)
+	for _, rr := range r.ValidRRs {
+		name := responseCanonicalName(rr.Header().Name)
+		out[name] = append(out[name], rr)
+	}
+	return out
+}
+
+// Lookup returns the valid RRs with the given owner name and type in
+// response order. The name comparison is case-insensitive and does not
+// depend on the trailing dot. Use [dns.TypeANY] to match any type.
+//
+// This method scans the valid RRs on each invocation, so prefer
+// [*Response.Index] when performing many lookups.
+func (r *Response) Lookup(name string, qtype uint16) []dns.RR {
+	name = responseCanonicalName(name)
+	out := []dns.RR{}
+	for _, rr := range r.ValidRRs {
+		header := rr.Header()
+		if qtype != dns.TypeANY && header.Rrtype != qtype {
+			continue
+		}
+		if responseCanonicalName(header.Name) == name {
+			out = append(out, rr)
+		}
+	}
+	return out
+}
+
+// TTLs returns the TTLs of all the valid RRs in the response order.
+//
+// The list includes the TTLs of the CNAME records in the chain, since
+// they also expire and bound how long the answer is valid.
+func (r *Response) TTLs() ([]uint32, error) {
+	out := make([]uint32, 0, len(r.ValidRRs))
+	for _, rr := range r.ValidRRs {
+		out = append(out, rr.Header().Ttl)
+	}
+	if len(out) < 1 {
+		return nil, ErrNoData
+	}
+	return out, nil
+}
+
+// MinTTL returns the minimum TTL among all the valid RRs.
+//
+// Like [*Response.TTLs], this method also considers the CNAME records.
+func (r *Response) MinTTL() (uint32, error) {
+	ttls, err := r.TTLs()
+	if err != nil {
+		return 0, err
+	}
+	return slices.Min(ttls), nil
+}
+
+// FilterMinTTL returns a shallow copy of the response whose valid RRs
+// only include the RRs having a TTL greater than or equal to minTTL.
+//
+// The original response is not modified. When no RR survives, the valid
+// RRs are empty and the Records* methods return [ErrNoData]. Note that
+// CNAME records are also filtered, so the copy may contain data RRs
+// whose CNAME chain is incomplete.
+func (r *Response) FilterMinTTL(minTTL uint32) *Response {
+	out := *r
+	out.ValidRRs = make([]dns.RR, 0, len(r.ValidRRs))
+	for _, rr := range r.ValidRRs {
+		if rr.Header().Ttl >= minTTL {
+			out.ValidRRs = append(out.ValidRRs, rr)
+		}
+	}
+	return &out
+}
+
+// RCODE returns the RCODE contained in the response, including the
+// extended RCODE bits contained in the OPT record, if any.
+func (r *Response) RCODE() int {
+	return responseFullRcode(r.Response)
+}
+
+// RCODEString returns the textual representation of the RCODE contained
+// in the response (e.g., "NOERROR") or the numeric value when unknown.
+//
+// Because BADSIG and BADVERS share the same value, this method returns
+// "BADVERS" when the response contains an OPT record.
+func (r *Response) RCODEString() string {
+	rcode := r.RCODE()
+	if rcode == dns.RcodeBadVers && r.Response.IsEdns0() != nil {
+		return "BADVERS"
+	}
+	if value, ok := dns.RcodeToString[rcode]; ok {
+		return value
+	}
+	return fmt.Sprintf("RCODE%d", rcode)
+}
+
+// EDNSVersion returns the EDNS version contained in the response OPT
+// record and whether the response contains an OPT record.
+func (r *Response) EDNSVersion() (uint8, bool) {
+	if r.Response == nil {
+		return 0, false
+	}
+	opt := r.Response.IsEdns0()
+	if opt == nil {
+		return 0, false
+	}
+	return opt.Version(), true
+}
+
+// IsAuthoritative returns whether the server set the AA bit in the response,
+// which means the answer comes from an authoritative server rather than
+// from a cache.
+func (r *Response) IsAuthoritative() bool {
+	return r.Response.Authoritative
+}
+
+// IsAuthenticatedData returns whether the server set the AD bit in the
+// response, which means the resolver claims to have validated the data
+// using DNSSEC. This method does NOT perform any DNSSEC validation, so
+// the claim is only trustworthy on a secure path to the resolver.
+func (r *Response) IsAuthenticatedData() bool {
+	return r.Response.AuthenticatedData
+}
+
+// IsLameReferral returns whether the response is a lame referral, i.e., a
+// NOERROR response without answers where neither the AA bit nor the RA bit
+// are set. [ResponseErrorFromRCODE] maps such responses to [ErrNoData].
+func (r *Response) IsLameReferral() bool {
+	return responseIsLameReferral(r.Response)
+}
+
+// IsNODATA returns whether the response is a NODATA response.
+//
+// Following RFC2308 section 2.2, a NODATA response has NOERROR RCODE,
+// no valid RRs of the queried type (possibly with a CNAME chain leading
+// to a name without RRs of such a type), and is not a referral, that is,
+// it has the AA bit set, or contains answers, or its authority section
+// either contains a SOA record or does not contain NS records owned by
+// the queried name or by one of its ancestors. Use [WithAllowNODATA] to make [ParseResponse] return NODATA
+// responses with an empty answer section rather than [ErrNoData].
+func (r *Response) IsNODATA() bool {
+	if r.Query == nil || len(r.Query.Question) != 1 || r.Response == nil {
+		return false
+	}
+	return responseIsNODATA(r.Query.Question[0], r.Response, r.ValidRRs)
+}
+
+// NegativeTTL returns how long a negative response (i.e., an NXDOMAIN or
+// NODATA response) may be cached and whether the response allows that.
+//
+// RFC2308 section 5 says that the TTL of a negative answer is the minimum
+// between the TTL of the SOA record in the authority section and its
+// MINIMUM field. Thus, this function uses the first SOA record in the
+// authority section and returns false when there is no such record, in
+// which case the negative answer SHOULD NOT be cached.
+//
+// Use this function when [ParseResponse] fails with [ErrNoName] or
+// [ErrNoData], since there is no [*Response] in such cases.
+func NegativeTTL(resp *dns.Msg) (uint32, bool) {
+	for _, rr := range resp.Ns {
+		if soa, ok := rr.(*dns.SOA); ok {
+			return min(soa.Hdr.Ttl, soa.Minttl), true
+		}
+	}
+	return 0, false
+}
+
+// responseIsNODATA implements [*Response.IsNODATA].
+func responseIsNODATA(q0 dns.Question, resp *dns.Msg, valid []dns.RR) bool {
+	if responseFullRcode(resp) != dns.RcodeSuccess {
+		return false
+	}
+	for _, rr := range valid {
+		if q0.Qtype == dns.TypeANY || rr.Header().Rrtype == q0.Qtype {
+			return false
+		}
+	}
+	candidate, delegates := responseClassifyReferral(resp, q0.Name)
+	return !(candidate && delegates)
+}
+
+// responseIsDelegation returns whether the response is a referral to the
+// name servers of a zone closer to the queried name, i.e., a NOERROR
+// response without the AA bit and without answers whose authority section
+// contains NS records owned by the queried name or one of its ancestors
+// and no SOA records. Unlike responseIsReferral, the RA bit is ignored.
+func responseIsDelegation(q0 dns.Question, resp *dns.Msg) bool {
+	candidate, delegates := responseClassifyReferral(resp, q0.Name)
+	return candidate && delegates
+}
+
+// RecursionAvailable returns whether the server set the RA bit in the response.
+func (r *Response) RecursionAvailable() bool {
+	return r.Response.RecursionAvailable
+}
+
+// RecursionDesiredEcho returns the RD bit echoed by the server.
+//
+// A conforming server copies the query RD bit into the response, therefore
+// a value differing from the query RD bit is a conformance issue.
+func (r *Response) RecursionDesiredEcho() bool {
+	return r.Response.RecursionDesired
+}
+
+// ExceededAdvertisedSize returns whether the response wire size exceeds
+// the advertised EDNS(0) size while the TC bit is not set.
+//
+// A conforming server truncates and sets the TC bit instead of sending a
+// response larger than the size advertised by the client, therefore a true
+// value indicates a server ignoring the EDNS(0) buffer size.
+//
+// The wire size is the length of [Response.Raw] when set. Otherwise,
+// we estimate it assuming name compression, which servers typically
+// use, because unpacked messages do not use compression by default.
+func (r *Response) ExceededAdvertisedSize(advertised uint16) bool {
+	return !r.Response.Truncated && r.wireSize() > int(advertised)
+}
+
+// wireSize returns the response wire size or an estimate of it.
+func (r *Response) wireSize() int {
+	if r.Raw != nil {
+		return len(r.Raw)
+	}
+	msg := *r.Response
+	msg.Compress = true
+	return msg.Len()
+}
+
+// ResponseStatus summarizes the status of a [*Response].
+type ResponseStatus int
+
+const (
+	// ResponseStatusMalformed means the message is missing or is not a response.
+	ResponseStatusMalformed = ResponseStatus(iota)
+
+	// ResponseStatusAnswered means the response contains valid answers.
+	ResponseStatusAnswered
+
+	// ResponseStatusNXDOMAIN means the RCODE is NXDOMAIN.
+	ResponseStatusNXDOMAIN
+
+	// ResponseStatusNODATA means the RCODE is NOERROR but there are no
+	// valid answers and the response is not a referral.
+	ResponseStatusNODATA
+
+	// ResponseStatusReferral means the RCODE is NOERROR, there are no
+	// valid answers, and the response is not authoritative.
+	ResponseStatusReferral
+
+	// ResponseStatusServerFailure means the RCODE is SERVFAIL or any
+	// other error RCODE not covered by other statuses.
+	ResponseStatusServerFailure
+
+	// ResponseStatusRefused means the RCODE is REFUSED.
+	ResponseStatusRefused
+
+	// ResponseStatusTruncated means the TC bit is set.
+	ResponseStatusTruncated
+)
+
+// String implements [fmt.Stringer].
+func (s ResponseStatus) String() string {
+	switch s {
+	case ResponseStatusMalformed:
+		return "Malformed"
+	case ResponseStatusAnswered:
+		return "Answered"
+	case ResponseStatusNXDOMAIN:
+		return "NXDOMAIN"
+	case ResponseStatusNODATA:
+		return "NODATA"
+	case ResponseStatusReferral:
+		return "Referral"
+	case ResponseStatusServerFailure:
+		return "ServerFailure"
+	case ResponseStatusRefused:
+		return "Refused"
+	case ResponseStatusTruncated:
+		return "Truncated"
+	default:
+		return fmt.Sprintf("ResponseStatus(%d)", int(s))
+	}
+}
+
+// Status classifies the response into a single [ResponseStatus].
+//
+// The classification considers, in order: whether the message is a response,
+// the TC bit, the RCODE, the presence of valid answers, and, for NOERROR
+// responses without valid answers, the AA and RA bits along with the content
+// of the authority section to tell referrals apart from NODATA.
+func (r *Response) Status() ResponseStatus {
+	// 1. make sure we actually have a response
+	resp := r.Response
+	if resp == nil || !resp.Response {
+		return ResponseStatusMalformed
+	}
+
+	// 2. a truncated response is a signal to retry using TCP
+	if resp.Truncated {
+		return ResponseStatusTruncated
+	}
+
+	// 3. map the error RCODEs
+	switch responseFullRcode(resp) {
+	case dns.RcodeSuccess:
+		// nothing
+	case dns.RcodeNameError:
+		return ResponseStatusNXDOMAIN
+	case dns.RcodeRefused:
+		return ResponseStatusRefused
+	default:
+		return ResponseStatusServerFailure
+	}
+
+	// 4. distinguish between answers, referrals, and NODATA
+	if len(r.ValidRRs) > 0 {
+		return ResponseStatusAnswered
+	}
+	var qname string
+	if r.Query != nil && len(r.Query.Question) == 1 {
+		qname = r.Query.Question[0].Name
+	}
+	if responseIsReferral(resp, qname) {
+		return ResponseStatusReferral
+	}
+	return ResponseStatusNODATA
+}
+
+// responseIsReferral returns whether a NOERROR response without answers
+// is a referral, i.e., it is not authoritative and either carries NS records
+// (owned by qname or by one of its ancestors, unless qname is empty) and no
+// SOA in the authority section, or is a lame referral lacking the RA bit.
+func responseIsReferral(resp *dns.Msg, qname string) bool {
+	candidate, delegates := responseClassifyReferral(resp, qname)
+	return candidate && (delegates || !resp.RecursionAvailable)
+}
+
+// CNAMETargetsMatchData returns whether every valid data RR is owned by the
+// terminal name of the CNAME chain rather than by an intermediate name.
+//
+// [ResponseExtractValidAnswers] accepts data RRs owned by any name in
+// the chain, so this method allows detecting subtly malformed responses
+// where data is attached to a mid-chain name. DNAME records and RRSIG
+// records covering CNAME or DNAME records are considered part of the chain.
+// This method returns false when the query does not contain exactly one question.
+func (r *Response) CNAMETargetsMatchData() bool {
+	if r.Query == nil || len(r.Query.Question) != 1 {
+		return false
+	}
+	chain, err := responseFollowCNAMEChain(r.Query.Question[0], r.ValidRRs, len(r.ValidRRs))
+	if err != nil {
+		return false
+	}
+	for _, rr := range r.ValidRRs {
+		switch rr := rr.(type) {
+		case *dns.CNAME, *dns.DNAME:
+			continue
+		case *dns.RRSIG:
+			if rr.TypeCovered == dns.TypeCNAME || rr.TypeCovered == dns.TypeDNAME {
+				continue
+			}
+		}
+		if responseCanonicalName(rr.Header().Name) != chain.terminal {
+			return false
+		}
+	}
+	return true
+}
+
+// CanonicalName returns the name at the end of the CNAME chain, i.e., the
+// name owning the data RRs, or the query name if there are no CNAMEs.
+//
+// The chain is followed as documented by [ResponseExtractValidAnswers],
+// including DNAME rewriting, and the returned name is fully qualified and
+// lowercase. This method returns [ErrNoData] when there are no valid RRs
+// and [ErrInvalidQuery] when the query does not contain exactly one question.
+func (r *Response) CanonicalName() (string, error) {
+	if r.Query == nil || len(r.Query.Question) != 1 {
+		return "", ErrInvalidQuery
+	}
+	if len(r.ValidRRs) < 1 {
+		return "", ErrNoData
+	}
+	chain, err := responseFollowCNAMEChain(r.Query.Question[0], r.ValidRRs, len(r.ValidRRs))
+	if err != nil {
+		return "", err
+	}
+	return chain.terminal, nil
+}
+
+// ServerCookie returns the DNS cookie (RFC7873) included in the response
+// OPT record and whether such a cookie was present.
+//
+// The returned bytes are the full cookie, i.e., the 8-byte client cookie
+// echoed by the server followed by the server cookie.
+func (r *Response) ServerCookie() ([]byte, bool) {
+	option, ok := r.ednsOption(dns.EDNS0COOKIE).(*dns.EDNS0_COOKIE)
+	if !ok {
+		return nil, false
+	}
+	cookie, err := hex.DecodeString(option.Cookie)
+	if err != nil {
+		return nil, false
+	}
+	return cookie, true
+}
+
+// NSID returns the name server identifier (RFC5001) included in the
+// response OPT record and whether such an identifier was present.
+//
+// Use [QueryFlagRequestNSID] to request the identifier.
+func (r *Response) NSID() (string, bool) {
+	option, ok := r.ednsOption(dns.EDNS0NSID).(*dns.EDNS0_NSID)
+	if !ok {
+		return "", false
+	}
+	nsid, err := hex.DecodeString(option.Nsid)
+	if err != nil {
+		return "", false
+	}
+	return string(nsid), true
+}
+
+// KeepaliveTimeout returns the idle timeout advertised by the server
+// using the EDNS(0) TCP keepalive option (RFC7828) included in the
+// response OPT record and whether such an option was present.
+//
+// The server advertises the timeout in units of 100 milliseconds. A zero
+// timeout means that the server would like the client to close the
+// connection. Use [QueryFlagRequestKeepalive] to request the option.
+func (r *Response) KeepaliveTimeout() (time.Duration, bool) {
+	option, ok := r.ednsOption(dns.EDNS0TCPKEEPALIVE).(*dns.EDNS0_TCP_KEEPALIVE)
+	if !ok {
+		return 0, false
+	}
+	return time.Duration(option.Timeout) * 100 * time.Millisecond, true
+}
+
+// ednsOption returns the first EDNS(0) option with the given code
+// included in the response OPT record or nil if there is none.
+func (r *Response) ednsOption(code uint16) dns.EDNS0 {
+	if r.Response == nil {
+		return nil
+	}
+	opt := r.Response.IsEdns0()
+	if opt == nil {
+		return nil
+	}
+	for _, option := range opt.Option {
+		if option.Option() == code {
+			return option
+		}
+	}
+	return nil
+}
+
+// AddrsA returns the addresses of all the A records in the response.
+//
+// The addresses are returned in response order. This method returns
+// [ErrNoData] when there are no A records.
+func (r *Response) AddrsA() ([]net.IP, error) {
+	out := make([]net.IP, 0, len(r.ValidRRs))
+	for _, rr := range r.ValidRRs {
+		switch rr := rr.(type) {
+		case *dns.A:
+			out = append(out, rr.A)
+		}
+	}
+	if len(out) < 1 {
+		return nil, ErrNoData
+	}
+	return out, nil
+}
+
+// AddrsAAAA returns the addresses of all the AAAA records in the response.
+//
+// The addresses are returned in response order. This method returns
+// [ErrNoData] when there are no AAAA records.
+func (r *Response) AddrsAAAA() ([]net.IP, error) {
+	out := make([]net.IP, 0, len(r.ValidRRs))
+	for _, rr := range r.ValidRRs {
+		switch rr := rr.(type) {
+		case *dns.AAAA:
+			out = append(out, rr.AAAA)
+		}
+	}
+	if len(out) < 1 {
+		return nil, ErrNoData
+	}
+	return out, nil
+}
+
+// Addrs returns the addresses of all the A and AAAA records in the response.
+//
+// The addresses of both families are returned in response order. This
+// method returns [ErrNoData] when there are no A or AAAA records.
+func (r *Response) Addrs() ([]net.IP, error) {
+	out := r.addrs()
+	if len(out) < 1 {
+		return nil, ErrNoData
+	}
+	return out, nil
+}
+
+// AddrsNetip is like [*Response.Addrs] but returns [netip.Addr] values.
+//
+// The addresses are unmapped, therefore IPv4 addresses are always returned
+// as 4-byte addresses, even when stored in IPv4-mapped IPv6 form. Records
+// containing malformed addresses are skipped. This method returns
+// [ErrNoData] when there are no A or AAAA records.
+func (r *Response) AddrsNetip() ([]netip.Addr, error) {
+	out := make([]netip.Addr, 0, len(r.ValidRRs))
+	for _, ip := range r.addrs() {
+		addr, ok := netip.AddrFromSlice(ip)
+		if !ok {
+			continue
+		}
+		out = append(out, addr.Unmap())
+	}
+	if len(out) < 1 {
+		return nil, ErrNoData
+	}
+	return out, nil
+}
+
+// AddrsInterleaved is like [*Response.AddrsNetip] but interleaves the
+// address families as recommended by RFC8305 (Happy Eyeballs).
+//
+// The returned list alternates between IPv6 and IPv4 addresses, starting
+// with IPv6, and each family retains its response order. When a family
+// is exhausted, the remaining addresses of the other family follow.
+// This method returns [ErrNoData] when there are no A or AAAA records.
+func (r *Response) AddrsInterleaved() ([]netip.Addr, error) {
+	addrs, err := r.AddrsNetip()
+	if err != nil {
+		return nil, err
+	}
+	var addrs4, addrs6 []netip.Addr
+	for _, addr := range addrs {
+		if addr.Is4() {
+			addrs4 = append(addrs4, addr)
+			continue
+		}
+		addrs6 = append(addrs6, addr)
+	}
+	out := make([]netip.Addr, 0, len(addrs))
+	for idx := 0; idx < len(addrs4) || idx < len(addrs6); idx++ {
+		if idx < len(addrs6) {
+			out = append(out, addrs6[idx])
+		}
+		if idx < len(addrs4) {
+			out = append(out, addrs4[idx])
+		}
+	}
+	return out, nil
+}
+
+// DiffAddrs compares the A and AAAA addresses of two responses.
+//
+// It returns the addresses only included in a, the addresses only included
+// in b, and the addresses included in both. The addresses are unmapped as
+// documented by [*Response.AddrsNetip] before comparing, and each returned
+// list is deduplicated and sorted. A nil response or a response without
+// addresses is treated as an empty set of addresses.
+func DiffAddrs(a, b *Response) (onlyA, onlyB, common []netip.Addr) {
+	setA, setB := diffAddrsSet(a), diffAddrsSet(b)
+	for addr := range setA {
+		if setB[addr] {
+			common = append(common, addr)
+			continue
+		}
+		onlyA = append(onlyA, addr)
+	}
+	for addr := range setB {
+		if !setA[addr] {
+			onlyB = append(onlyB, addr)
+		}
+	}
+	slices.SortFunc(onlyA, netip.Addr.Compare)
+	slices.SortFunc(onlyB, netip.Addr.Compare)
+	slices.SortFunc(common, netip.Addr.Compare)
+	return
+}
+
+// diffAddrsSet returns the set of the unmapped addresses of the response.
+func diffAddrsSet(r *Response) map[netip.Addr]bool {
+	out := make(map[netip.Addr]bool)
+	if r == nil {
+		return out
+	}
+	addrs, _ := r.AddrsNetip()
+	for _, addr := range addrs {
+		out[addr] = true
+	}
+	return out
+}
+
+// BogonPrefixes contains the address ranges that [*Response.ContainsBogon]
+// considers bogons, i.e., private, loopback, link-local, documentation,
+// multicast, or otherwise reserved ranges (RFC6890) that should never be
+// returned for public domain names. Censors commonly inject them.
+//
+// Callers MAY append to this list to extend the checks, but they MUST NOT
+// modify it concurrently with calls to [*Response.ContainsBogon].
+var BogonPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("10.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("127.0.0.0/8"),
+	netip.MustParsePrefix("169.254.0.0/16"),
+	netip.MustParsePrefix("172.16.0.0/12"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("192.0.2.0/24"),
+	netip.MustParsePrefix("192.168.0.0/16"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("198.51.100.0/24"),
+	netip.MustParsePrefix("203.0.113.0/24"),
+	netip.MustParsePrefix("224.0.0.0/4"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("::/128"),
+	netip.MustParsePrefix("::1/128"),
+	netip.MustParsePrefix("100::/64"),
+	netip.MustParsePrefix("2001:db8::/32"),
+	netip.MustParsePrefix("fc00::/7"),
+	netip.MustParsePrefix("fe80::/10"),
+	netip.MustParsePrefix("fec0::/10"),
+	netip.MustParsePrefix("ff00::/8"),
+}
+
+// ContainsBogon returns whether any A or AAAA address in the response
+// falls within one of the [BogonPrefixes].
+//
+// The addresses are unmapped as documented by [*Response.AddrsNetip]
+// before checking, so IPv4-mapped IPv6 addresses are checked against
+// the IPv4 prefixes. This is a heuristic: a bogon answer is a strong
+// signal of DNS-based blocking only for public domain names.
+func (r *Response) ContainsBogon() bool {
+	addrs, _ := r.AddrsNetip()
+	for _, addr := range addrs {
+		for _, prefix := range BogonPrefixes {
+			if prefix.Contains(addr) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ContainsAddr returns whether any A or AAAA address in the response
+// is equal to the given address (e.g., a known blockpage address).
+//
+// Both the response addresses and the given address are unmapped
+// before comparing, as documented by [*Response.AddrsNetip].
+func (r *Response) ContainsAddr(ip netip.Addr) bool {
+	addrs, _ := r.AddrsNetip()
+	return slices.Contains(addrs, ip.Unmap())
+}
+
+// ReachableAddrs returns the A and AAAA addresses in the response that are
+// reachable using at least one of the given interface addresses.
+//
+// An address is reachable from an interface address of the same family when:
+//
+//  1. the address is a loopback address; or
+//
+//  2. both addresses are link-local unicast addresses; or
+//
+//  3. the address is neither loopback nor link-local unicast and the
+//     interface address is neither loopback nor link-local unicast.
+//
+// The addresses are returned in response order. This method returns
+// [ErrNoData] when no address is reachable.
+func (r *Response) ReachableAddrs(ifaceAddrs []net.IP) ([]net.IP, error) {
+	out := []net.IP{}
+	for _, addr := range r.addrs() {
+		for _, ifaceAddr := range ifaceAddrs {
+			if responseAddrReachable(addr, ifaceAddr) {
+				out = append(out, addr)
+				break
+			}
+		}
+	}
+	if len(out) < 1 {
+		return nil, ErrNoData
+	}
+	return out, nil
+}
+
+// responseAddrReachable implements the rules documented by [*Response.ReachableAddrs].
+func responseAddrReachable(addr, ifaceAddr net.IP) bool {
+	if (addr.To4() != nil) != (ifaceAddr.To4() != nil) {
+		return false
+	}
+	switch {
+	case addr.IsLoopback():
+		return true
+	case addr.IsLinkLocalUnicast():
+		return ifaceAddr.IsLinkLocalUnicast()
+	default:
+		return !ifaceAddr.IsLoopback() && !ifaceAddr.IsLinkLocalUnicast()
+	}
+}
+
+// addrs returns the addresses of the A and AAAA records in response order.
+func (r *Response) addrs() []net.IP {
+	out := make([]net.IP, 0, len(r.ValidRRs))
+	for _, rr := range r.ValidRRs {
+		switch rr := rr.(type) {
+		case *dns.A:
+			out = append(out, rr.A)
+		case *dns.AAAA:
+			out = append(out, rr.AAAA)
+		}
+	}
+	return out
+}
+
+// UnsolicitedRRSIGs returns whether the valid RRs include RRSIG records
+// even though the query did not set the EDNS(0) DO bit.
+//
+// A server should not include RRSIG records when the client does not
+// request DNSSEC, so a true value is a signal about the server behavior.
+func (r *Response) UnsolicitedRRSIGs() bool {
+	if r.Query == nil {
+		return false
+	}
+	if opt := r.Query.IsEdns0(); opt != nil && opt.Do() {
+		return false
+	}
+	return responseHasRRSIG(r.ValidRRs)
+}
+
+// TrustLevel is the RFC2181 trust level of the data in a [*Response].
+//
+// Higher values mean more trustworthy data, so a cache could use the
+// trust level to decide whether new data can replace cached data.
+type TrustLevel int
+
+const (
+	// TrustLevelNone means the response does not contain any data.
+	TrustLevelNone = TrustLevel(iota)
+
+	// TrustLevelAdditional means the data comes from the additional section.
+	TrustLevelAdditional
+
+	// TrustLevelNonauthAuthority means the data comes from the
+	// authority section of a non-authoritative response.
+	TrustLevelNonauthAuthority
+
+	// TrustLevelNonauthAnswer means the data comes from the
+	// answer section of a non-authoritative response.
+	TrustLevelNonauthAnswer
+
+	// TrustLevelAuthAuthority means the data comes from the
+	// authority section of an authoritative response.
+	TrustLevelAuthAuthority
+
+	// TrustLevelAuthAnswer means the data comes from the
+	// answer section of an authoritative response.
+	TrustLevelAuthAnswer
+)
+
+// String implements [fmt.Stringer].
+func (tl TrustLevel) String() string {
+	switch tl {
+	case TrustLevelNone:
+		return "None"
+	case TrustLevelAdditional:
+		return "Additional"
+	case TrustLevelNonauthAuthority:
+		return "NonauthAuthority"
+	case TrustLevelNonauthAnswer:
+		return "NonauthAnswer"
+	case TrustLevelAuthAuthority:
+		return "AuthAuthority"
+	case TrustLevelAuthAnswer:
+		return "AuthAnswer"
+	default:
+		return fmt.Sprintf("TrustLevel(%d)", int(tl))
+	}
+}
+
+// TrustLevel returns the RFC2181 trust level of the response data.
+//
+// The data is the valid answers, when present, otherwise the authority
+// section, otherwise the additional section excluding the OPT record.
+// The AA bit determines whether the data is authoritative.
+func (r *Response) TrustLevel() TrustLevel {
+	resp := r.Response
+	if resp == nil {
+		return TrustLevelNone
+	}
+	switch {
+	case len(r.ValidRRs) > 0 && resp.Authoritative:
+		return TrustLevelAuthAnswer
+	case len(r.ValidRRs) > 0:
+		return TrustLevelNonauthAnswer
+	case len(resp.Ns) > 0 && resp.Authoritative:
+		return TrustLevelAuthAuthority
+	case len(resp.Ns) > 0:
+		return TrustLevelNonauthAuthority
+	}
+	for _, rr := range resp.Extra {
+		if _, ok := rr.(*dns.OPT); !ok {
+			return TrustLevelAdditional
+		}
+	}
+	return TrustLevelNone
 }
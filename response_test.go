@@ -7,9 +7,18 @@
 package dnscodec
 
 import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/rand/v2"
 	"net"
+	"net/netip"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/bassosimone/runtimex"
 	"github.com/miekg/dns"
 	"github.com/stretchr/testify/require"
 )
@@ -52,6 +61,14 @@ func TestValidateResponseForQuery(t *testing.T) {
 			expected: ErrInvalidQuery,
 		},
 
+		{
+			name: "InvalidQueryMultipleQuestions",
+			modify: func(query, resp *dns.Msg) {
+				query.Question = append(query.Question, query.Question[0])
+			},
+			expected: ErrMultipleQuestions,
+		},
+
 		{
 			name: "InvalidResponseNoQuestion",
 			modify: func(query, resp *dns.Msg) {
@@ -83,6 +100,39 @@ func TestValidateResponseForQuery(t *testing.T) {
 			},
 			expected: ErrInvalidResponse,
 		},
+
+		{
+			name: "TruncatedResponse",
+			modify: func(query, resp *dns.Msg) {
+				resp.Truncated = true
+			},
+			expected: ErrTruncatedResponse,
+		},
+
+		{
+			name: "TruncatedResponseInvalidID",
+			modify: func(query, resp *dns.Msg) {
+				resp.Truncated = true
+				resp.Id = query.Id + 1
+			},
+			expected: ErrInvalidResponse,
+		},
+
+		{
+			name: "QueryWithoutTrailingDot",
+			modify: func(query, resp *dns.Msg) {
+				query.Question[0].Name = "example.com"
+			},
+			expected: nil,
+		},
+
+		{
+			name: "ResponseWithoutTrailingDot",
+			modify: func(query, resp *dns.Msg) {
+				resp.Question[0].Name = "EXAMPLE.com"
+			},
+			expected: nil,
+		},
 	}
 
 	for _, tt := range tests {
@@ -96,6 +146,188 @@ func TestValidateResponseForQuery(t *testing.T) {
 			tt.modify(query, resp)
 
 			q0, err := ValidateResponseForQuery(query, resp)
+			if tt.expected != nil {
+				require.ErrorIs(t, err, tt.expected)
+				if tt.expected == ErrTruncatedResponse {
+					require.NotErrorIs(t, err, ErrInvalidResponse)
+				}
+				return
+			}
+			require.NoError(t, err)
+			expected := query.Question[0]
+			expected.Name = dns.Fqdn(expected.Name)
+			require.Equal(t, expected, q0)
+		})
+	}
+}
+
+func TestValidateResponseForQueryValidationError(t *testing.T) {
+	tests := []struct {
+		name             string
+		modify           func(*dns.Msg)
+		expectedReason   ValidationReason
+		expectedExpected string
+		expectedActual   string
+	}{
+		{
+			name:             "NotAResponse",
+			modify:           func(resp *dns.Msg) { resp.Response = false },
+			expectedReason:   ReasonNotAResponse,
+			expectedExpected: "true",
+			expectedActual:   "false",
+		},
+
+		{
+			name:             "IDMismatch",
+			modify:           func(resp *dns.Msg) { resp.Id = 4321 },
+			expectedReason:   ReasonIDMismatch,
+			expectedExpected: "1234",
+			expectedActual:   "4321",
+		},
+
+		{
+			name:             "QuestionCount",
+			modify:           func(resp *dns.Msg) { resp.Question = nil },
+			expectedReason:   ReasonQuestionCount,
+			expectedExpected: "1",
+			expectedActual:   "0",
+		},
+
+		{
+			name: "ExtraQuestions",
+			modify: func(resp *dns.Msg) {
+				resp.Question = append(resp.Question, dns.Question{
+					Name:   "example.org.",
+					Qtype:  dns.TypeA,
+					Qclass: dns.ClassINET,
+				})
+			},
+			expectedReason:   ReasonExtraQuestions,
+			expectedExpected: "1",
+			expectedActual:   "2",
+		},
+
+		{
+			name:             "NameMismatch",
+			modify:           func(resp *dns.Msg) { resp.Question[0].Name = "example.org." },
+			expectedReason:   ReasonNameMismatch,
+			expectedExpected: "example.com.",
+			expectedActual:   "example.org.",
+		},
+
+		{
+			name:             "ClassMismatch",
+			modify:           func(resp *dns.Msg) { resp.Question[0].Qclass = dns.ClassCHAOS },
+			expectedReason:   ReasonClassMismatch,
+			expectedExpected: "IN",
+			expectedActual:   "CH",
+		},
+
+		{
+			name:             "TypeMismatch",
+			modify:           func(resp *dns.Msg) { resp.Question[0].Qtype = dns.TypeAAAA },
+			expectedReason:   ReasonTypeMismatch,
+			expectedExpected: "A",
+			expectedActual:   "AAAA",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := new(dns.Msg)
+			query.SetQuestion("example.com.", dns.TypeA)
+			query.Id = 1234
+
+			resp := new(dns.Msg)
+			resp.SetReply(query)
+			tt.modify(resp)
+
+			_, err := ValidateResponseForQuery(query, resp)
+			require.ErrorIs(t, err, ErrInvalidResponse)
+
+			var verr *ValidationError
+			require.ErrorAs(t, err, &verr)
+			require.Equal(t, tt.expectedReason, verr.Reason)
+			require.Equal(t, tt.expectedExpected, verr.Expected)
+			require.Equal(t, tt.expectedActual, verr.Actual)
+			require.Contains(t, err.Error(), ErrInvalidResponse.Error())
+			require.Contains(t, err.Error(), tt.expectedReason.String())
+		})
+	}
+}
+
+func TestValidationReasonString(t *testing.T) {
+	tests := []struct {
+		reason   ValidationReason
+		expected string
+	}{
+		{ReasonNotAResponse, "NotAResponse"},
+		{ReasonIDMismatch, "IDMismatch"},
+		{ReasonQuestionCount, "QuestionCount"},
+		{ReasonNameMismatch, "NameMismatch"},
+		{ReasonClassMismatch, "ClassMismatch"},
+		{ReasonTypeMismatch, "TypeMismatch"},
+		{ReasonCaseMismatch, "CaseMismatch"},
+		{ReasonExtraQuestions, "ExtraQuestions"},
+		{ValidationReason(100), "ValidationReason(100)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expected, func(t *testing.T) {
+			require.Equal(t, tt.expected, tt.reason.String())
+		})
+	}
+}
+
+func TestValidateResponse0x20(t *testing.T) {
+	tests := []struct {
+		name     string
+		respName string
+		modify   func(resp *dns.Msg)
+		expected error
+	}{
+		{
+			name:     "SameCase",
+			respName: "wWw.ExAmple.cOm.",
+			modify:   func(resp *dns.Msg) {},
+			expected: nil,
+		},
+
+		{
+			name:     "SameCaseWithoutTrailingDot",
+			respName: "wWw.ExAmple.cOm",
+			modify:   func(resp *dns.Msg) {},
+			expected: nil,
+		},
+
+		{
+			name:     "NormalizedCase",
+			respName: "www.example.com.",
+			modify:   func(resp *dns.Msg) {},
+			expected: ErrInvalidResponse,
+		},
+
+		{
+			name:     "InvalidResponseID",
+			respName: "wWw.ExAmple.cOm.",
+			modify: func(resp *dns.Msg) {
+				resp.Id++
+			},
+			expected: ErrInvalidResponse,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := new(dns.Msg)
+			query.SetQuestion("wWw.ExAmple.cOm.", dns.TypeA)
+
+			resp := new(dns.Msg)
+			resp.SetReply(query)
+			resp.Question[0].Name = tt.respName
+			tt.modify(resp)
+
+			q0, err := ValidateResponse0x20(query, resp)
 			if tt.expected != nil {
 				require.ErrorIs(t, err, tt.expected)
 				return
@@ -106,6 +338,22 @@ func TestValidateResponseForQuery(t *testing.T) {
 	}
 }
 
+func TestValidateResponse0x20ValidationError(t *testing.T) {
+	query := new(dns.Msg)
+	query.SetQuestion("wWw.ExAmple.cOm.", dns.TypeA)
+
+	resp := new(dns.Msg)
+	resp.SetReply(query)
+	resp.Question[0].Name = "www.example.com."
+
+	_, err := ValidateResponse0x20(query, resp)
+	var verr *ValidationError
+	require.ErrorAs(t, err, &verr)
+	require.Equal(t, ReasonCaseMismatch, verr.Reason)
+	require.Equal(t, "wWw.ExAmple.cOm.", verr.Expected)
+	require.Equal(t, "www.example.com.", verr.Actual)
+}
+
 func TestResponseEqualASCIIName(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -120,6 +368,9 @@ func TestResponseEqualASCIIName(t *testing.T) {
 		{"OnlyPrefixMatch", "example.co.", "example.co.uk.", false},
 		{"EmptyStrings", "", "", true},
 		{"OneEmptyString", "example.com.", "", false},
+		{"MissingTrailingDot", "Example.com", "example.COM.", true},
+		{"BothMissingTrailingDot", "example.com", "example.com", true},
+		{"RootAndEmpty", ".", "", true},
 	}
 
 	for _, tt := range tests {
@@ -170,6 +421,14 @@ func TestResponseErrorFromRCODE(t *testing.T) {
 			err := ResponseErrorFromRCODE(resp)
 			if tt.expected != nil {
 				require.ErrorIs(t, err, tt.expected)
+				require.Equal(t, tt.expected.Error(), err.Error())
+				var rcodeErr *RCODEError
+				if tt.rcode != dns.RcodeSuccess {
+					require.ErrorAs(t, err, &rcodeErr)
+					require.Equal(t, tt.rcode, rcodeErr.Rcode)
+				} else {
+					require.False(t, errors.As(err, &rcodeErr))
+				}
 				return
 			}
 			require.NoError(t, err)
@@ -177,6 +436,241 @@ func TestResponseErrorFromRCODE(t *testing.T) {
 	}
 }
 
+func TestResponseErrorFromRCODEBadEDNSVersion(t *testing.T) {
+	query := new(dns.Msg)
+	query.SetQuestion("example.com.", dns.TypeA)
+	query.SetEdns0(QueryMaxResponseSizeUDP, false)
+
+	newResponse := func() *dns.Msg {
+		resp := new(dns.Msg)
+		resp.SetReply(query)
+		resp.RecursionAvailable = true
+		resp.SetEdns0(QueryMaxResponseSizeUDP, false)
+		return resp
+	}
+
+	t.Run("OnlyOPTHighBits", func(t *testing.T) {
+		// The header bits alone would report NOERROR
+		resp := newResponse()
+		resp.IsEdns0().SetExtendedRcode(dns.RcodeBadVers)
+		require.Equal(t, dns.RcodeSuccess, resp.Rcode)
+
+		err := ResponseErrorFromRCODE(resp)
+		require.ErrorIs(t, err, ErrBadEDNSVersion)
+		var rcodeErr *RCODEError
+		require.ErrorAs(t, err, &rcodeErr)
+		require.Equal(t, dns.RcodeBadVers, rcodeErr.Rcode)
+	})
+
+	t.Run("FromWire", func(t *testing.T) {
+		resp := newResponse()
+		resp.Rcode = dns.RcodeBadVers
+		raw := runtimex.PanicOnError1(resp.Pack())
+
+		parsed, err := ParseResponseBytes(query, raw)
+		require.ErrorIs(t, err, ErrBadEDNSVersion)
+		require.Nil(t, parsed)
+	})
+}
+
+func TestResponseExtendedRCODE(t *testing.T) {
+	tests := []struct {
+		name           string
+		rcode          int
+		expectedErr    error
+		expectedString string
+		expectedStatus ResponseStatus
+	}{
+		{
+			name:           "BADVERS",
+			rcode:          dns.RcodeBadVers,
+			expectedErr:    ErrBadEDNSVersion,
+			expectedString: "BADVERS",
+			expectedStatus: ResponseStatusServerFailure,
+		},
+
+		{
+			name:           "BADCOOKIE",
+			rcode:          dns.RcodeBadCookie,
+			expectedErr:    ErrBadCookie,
+			expectedString: "BADCOOKIE",
+			expectedStatus: ResponseStatusServerFailure,
+		},
+
+		{
+			name:           "BADTRUNC",
+			rcode:          dns.RcodeBadTrunc,
+			expectedErr:    ErrServerMisbehaving,
+			expectedString: "BADTRUNC",
+			expectedStatus: ResponseStatusServerFailure,
+		},
+
+		{
+			// 0x30 has all the header bits cleared, so the header alone
+			// would report NOERROR, but the full RCODE is unassigned.
+			name:           "Unassigned",
+			rcode:          0x30,
+			expectedErr:    ErrServerMisbehaving,
+			expectedString: "RCODE48",
+			expectedStatus: ResponseStatusServerFailure,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := new(dns.Msg)
+			msg.SetQuestion("example.com.", dns.TypeA)
+			msg.Response = true
+			msg.RecursionAvailable = true
+			msg.SetEdns0(QueryMaxResponseSizeUDP, false)
+			msg.IsEdns0().SetExtendedRcode(uint16(tt.rcode))
+			msg.Rcode = tt.rcode & 0x0f
+
+			err := ResponseErrorFromRCODE(msg)
+			require.ErrorIs(t, err, tt.expectedErr)
+			var rcodeErr *RCODEError
+			require.ErrorAs(t, err, &rcodeErr)
+			require.Equal(t, tt.rcode, rcodeErr.Rcode)
+
+			resp := &Response{Response: msg}
+			require.Equal(t, tt.rcode, resp.RCODE())
+			require.Equal(t, tt.expectedString, resp.RCODEString())
+			require.Equal(t, tt.expectedStatus, resp.Status())
+		})
+	}
+}
+
+func TestResponseEDNSVersion(t *testing.T) {
+	t.Run("Present", func(t *testing.T) {
+		msg := new(dns.Msg)
+		msg.SetEdns0(QueryMaxResponseSizeUDP, false)
+		msg.IsEdns0().SetVersion(1)
+		resp := &Response{Response: msg}
+		version, ok := resp.EDNSVersion()
+		require.True(t, ok)
+		require.Equal(t, uint8(1), version)
+	})
+
+	t.Run("AbsentOPT", func(t *testing.T) {
+		resp := &Response{Response: new(dns.Msg)}
+		version, ok := resp.EDNSVersion()
+		require.False(t, ok)
+		require.Zero(t, version)
+	})
+}
+
+func TestResponseIsAuthenticatedData(t *testing.T) {
+	for _, ad := range []bool{false, true} {
+		t.Run(fmt.Sprint(ad), func(t *testing.T) {
+			msg := new(dns.Msg)
+			msg.Response = true
+			msg.AuthenticatedData = ad
+			resp := &Response{Response: msg}
+			require.Equal(t, ad, resp.IsAuthenticatedData())
+		})
+	}
+}
+
+func TestResponseIsAuthoritativeAndIsLameReferral(t *testing.T) {
+	answer := &dns.A{
+		Hdr: dns.RR_Header{
+			Name:   "example.com.",
+			Rrtype: dns.TypeA,
+			Class:  dns.ClassINET,
+		},
+		A: net.IPv4(127, 0, 0, 1),
+	}
+
+	tests := []struct {
+		name                  string
+		rcode                 int
+		authoritative         bool
+		recursionAvailable    bool
+		answers               []dns.RR
+		expectedAuthoritative bool
+		expectedLameReferral  bool
+	}{
+		{
+			name:                  "AuthoritativeAnswer",
+			rcode:                 dns.RcodeSuccess,
+			authoritative:         true,
+			answers:               []dns.RR{answer},
+			expectedAuthoritative: true,
+		},
+
+		{
+			name:               "CachedAnswer",
+			rcode:              dns.RcodeSuccess,
+			recursionAvailable: true,
+			answers:            []dns.RR{answer},
+		},
+
+		{
+			name:                 "LameReferral",
+			rcode:                dns.RcodeSuccess,
+			expectedLameReferral: true,
+		},
+
+		{
+			name:               "NODATAFromResolver",
+			rcode:              dns.RcodeSuccess,
+			recursionAvailable: true,
+		},
+
+		{
+			name:                  "NODATAFromAuthoritative",
+			rcode:                 dns.RcodeSuccess,
+			authoritative:         true,
+			expectedAuthoritative: true,
+		},
+
+		{
+			name:  "NXDOMAINWithoutFlags",
+			rcode: dns.RcodeNameError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := new(dns.Msg)
+			msg.Response = true
+			msg.Rcode = tt.rcode
+			msg.Authoritative = tt.authoritative
+			msg.RecursionAvailable = tt.recursionAvailable
+			msg.Answer = tt.answers
+
+			resp := &Response{Response: msg}
+			require.Equal(t, tt.expectedAuthoritative, resp.IsAuthoritative())
+			require.Equal(t, tt.expectedLameReferral, resp.IsLameReferral())
+
+			// Make sure the classification matches ResponseErrorFromRCODE
+			err := ResponseErrorFromRCODE(msg)
+			require.Equal(t, tt.expectedLameReferral, err == ErrNoData)
+		})
+	}
+}
+
+func TestResponseRCODE(t *testing.T) {
+	tests := []struct {
+		name           string
+		rcode          int
+		expectedString string
+	}{
+		{"Success", dns.RcodeSuccess, "NOERROR"},
+		{"NameError", dns.RcodeNameError, "NXDOMAIN"},
+		{"Refused", dns.RcodeRefused, "REFUSED"},
+		{"Unknown", 4000, "RCODE4000"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &Response{Response: &dns.Msg{MsgHdr: dns.MsgHdr{Rcode: tt.rcode}}}
+			require.Equal(t, tt.rcode, resp.RCODE())
+			require.Equal(t, tt.expectedString, resp.RCODEString())
+		})
+	}
+}
+
 func TestResponseExtractValidAnswers(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -367,100 +861,3325 @@ func TestResponseExtractValidAnswers(t *testing.T) {
 	}
 }
 
-func TestParseResponse(t *testing.T) {
-	makeQuery := func(name string, qtype uint16) *dns.Msg {
-		msg := new(dns.Msg)
-		msg.SetQuestion(name, qtype)
-		return msg
-	}
-
+func TestIsMetaRR(t *testing.T) {
 	tests := []struct {
 		name     string
-		query    *dns.Msg
-		makeResp func(*dns.Msg) *dns.Msg
-		expected error
+		rr       dns.RR
+		expected bool
 	}{
 		{
-			name:  "ValidResponse",
-			query: makeQuery("example.com.", dns.TypeA),
-			makeResp: func(query *dns.Msg) *dns.Msg {
-				resp := new(dns.Msg)
-				resp.SetReply(query)
-				resp.Answer = []dns.RR{&dns.A{
-					Hdr: dns.RR_Header{
-						Name:   "example.com.",
-						Rrtype: dns.TypeA,
-						Class:  dns.ClassINET,
-					},
-					A: net.IPv4(127, 0, 0, 1),
-				}}
-				return resp
+			name: "OPT",
+			rr: &dns.OPT{
+				Hdr: dns.RR_Header{Name: ".", Rrtype: dns.TypeOPT},
 			},
-			expected: nil,
+			expected: true,
 		},
 
 		{
-			name:  "InvalidResponseID",
-			query: makeQuery("example.com.", dns.TypeA),
-			makeResp: func(query *dns.Msg) *dns.Msg {
-				resp := new(dns.Msg)
-				resp.SetReply(query)
-				resp.Id++
-				return resp
+			name: "TSIG",
+			rr: &dns.TSIG{
+				Hdr: dns.RR_Header{Name: "key.", Rrtype: dns.TypeTSIG, Class: dns.ClassANY},
 			},
-			expected: ErrInvalidResponse,
+			expected: true,
 		},
 
 		{
-			name:  "ServerMisbehaving",
-			query: makeQuery("example.com.", dns.TypeA),
-			makeResp: func(query *dns.Msg) *dns.Msg {
-				resp := new(dns.Msg)
-				resp.SetReply(query)
-				resp.Rcode = dns.RcodeRefused
-				return resp
+			name: "TKEY",
+			rr: &dns.TKEY{
+				Hdr: dns.RR_Header{Name: "key.", Rrtype: dns.TypeTKEY, Class: dns.ClassANY},
 			},
-			expected: ErrServerMisbehaving,
+			expected: true,
 		},
 
 		{
-			name:  "NoData",
-			query: makeQuery("example.com.", dns.TypeA),
-			makeResp: func(query *dns.Msg) *dns.Msg {
-				resp := new(dns.Msg)
-				resp.SetReply(query)
-				resp.Authoritative = true
-				resp.RecursionAvailable = true
-				resp.Answer = nil
-				return resp
-			},
-			expected: ErrNoData,
+			name: "SIG0",
+			rr: &dns.SIG{RRSIG: dns.RRSIG{
+				Hdr:         dns.RR_Header{Name: ".", Rrtype: dns.TypeSIG, Class: dns.ClassANY},
+				TypeCovered: 0,
+			}},
+			expected: true,
 		},
-	}
 
-	for _, tt := range tests {
+		{
+			name: "SIGCoveringA",
+			rr: &dns.SIG{RRSIG: dns.RRSIG{
+				Hdr:         dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeSIG, Class: dns.ClassINET},
+				TypeCovered: dns.TypeA,
+			}},
+			expected: false,
+		},
+
+		{
+			name: "RRSIG",
+			rr: &dns.RRSIG{
+				Hdr:         dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeRRSIG, Class: dns.ClassINET},
+				TypeCovered: dns.TypeA,
+			},
+			expected: false,
+		},
+
+		{
+			name: "A",
+			rr: &dns.A{
+				Hdr: dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeA, Class: dns.ClassINET},
+				A:   net.IPv4(127, 0, 0, 1),
+			},
+			expected: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.expected, IsMetaRR(tt.rr))
+		})
+	}
+}
+
+func TestResponseExtractValidAnswersSkipsMetaRRs(t *testing.T) {
+	query := new(dns.Msg)
+	query.SetQuestion("example.com.", dns.TypeA)
+
+	resp := new(dns.Msg)
+	resp.SetReply(query)
+	answer := &dns.A{
+		Hdr: dns.RR_Header{
+			Name:   "example.com.",
+			Rrtype: dns.TypeA,
+			Class:  dns.ClassINET,
+		},
+		A: net.IPv4(127, 0, 0, 1),
+	}
+	resp.Answer = []dns.RR{
+		answer,
+		&dns.SIG{RRSIG: dns.RRSIG{
+			Hdr: dns.RR_Header{
+				Name:   "example.com.",
+				Rrtype: dns.TypeSIG,
+				Class:  dns.ClassINET,
+			},
+			TypeCovered: 0,
+		}},
+	}
+
+	answers, err := ResponseExtractValidAnswers(query.Question[0], resp)
+	require.NoError(t, err)
+	require.Equal(t, []dns.RR{answer}, answers)
+}
+
+func TestResponseExtractValidAnswersWithAdditional(t *testing.T) {
+	srv := &dns.SRV{
+		Hdr: dns.RR_Header{
+			Name:   "_xmpp._tcp.example.com.",
+			Rrtype: dns.TypeSRV,
+			Class:  dns.ClassINET,
+		},
+		Priority: 10,
+		Weight:   5,
+		Port:     5222,
+		Target:   "XMPP.example.com.",
+	}
+	glueA := &dns.A{
+		Hdr: dns.RR_Header{
+			Name:   "xmpp.example.com.",
+			Rrtype: dns.TypeA,
+			Class:  dns.ClassINET,
+		},
+		A: net.IPv4(10, 0, 0, 1),
+	}
+	glueAAAA := &dns.AAAA{
+		Hdr: dns.RR_Header{
+			Name:   "xmpp.EXAMPLE.com.",
+			Rrtype: dns.TypeAAAA,
+			Class:  dns.ClassINET,
+		},
+		AAAA: net.ParseIP("2001:db8::1"),
+	}
+	unrelated := &dns.A{
+		Hdr: dns.RR_Header{
+			Name:   "www.example.com.",
+			Rrtype: dns.TypeA,
+			Class:  dns.ClassINET,
+		},
+		A: net.IPv4(10, 0, 0, 2),
+	}
+	foreignClass := &dns.A{
+		Hdr: dns.RR_Header{
+			Name:   "xmpp.example.com.",
+			Rrtype: dns.TypeA,
+			Class:  dns.ClassCHAOS,
+		},
+		A: net.IPv4(10, 0, 0, 3),
+	}
+
+	query := new(dns.Msg)
+	query.SetQuestion("_xmpp._tcp.example.com.", dns.TypeSRV)
+	query.SetEdns0(QueryMaxResponseSizeUDP, false)
+	resp := new(dns.Msg)
+	resp.SetReply(query)
+	resp.Answer = []dns.RR{srv}
+	resp.Extra = []dns.RR{glueA, unrelated, foreignClass, glueAAAA}
+	resp.SetEdns0(QueryMaxResponseSizeUDP, false)
+
+	t.Run("Function", func(t *testing.T) {
+		valid, err := ResponseExtractValidAnswersWithAdditional(query.Question[0], resp)
+		require.NoError(t, err)
+		require.Equal(t, []dns.RR{srv, glueA, glueAAAA}, valid)
+		for _, rr := range valid {
+			require.False(t, IsMetaRR(rr))
+		}
+	})
+
+	t.Run("ParseResponse", func(t *testing.T) {
+		parsed, err := ParseResponse(query, resp)
+		require.NoError(t, err)
+		require.Equal(t, []dns.RR{srv}, parsed.ValidRRs)
+
+		parsed, err = ParseResponse(query, resp, WithAdditional())
+		require.NoError(t, err)
+		require.Equal(t, []dns.RR{srv, glueA, glueAAAA}, parsed.ValidRRs)
+	})
+
+	t.Run("NoAnswers", func(t *testing.T) {
+		resp := resp.Copy()
+		resp.Answer = nil
+		valid, err := ResponseExtractValidAnswersWithAdditional(query.Question[0], resp)
+		require.ErrorIs(t, err, ErrNoData)
+		require.Nil(t, valid)
+	})
+}
+
+func TestResponseExtractValidAnswersWithAdditionalSVCB(t *testing.T) {
+	https := &dns.HTTPS{SVCB: dns.SVCB{
+		Hdr: dns.RR_Header{
+			Name:   "example.com.",
+			Rrtype: dns.TypeHTTPS,
+			Class:  dns.ClassINET,
+		},
+		Priority: 1,
+		Target:   ".",
+	}}
+	svcb := &dns.SVCB{
+		Hdr: dns.RR_Header{
+			Name:   "example.com.",
+			Rrtype: dns.TypeSVCB,
+			Class:  dns.ClassINET,
+		},
+		Priority: 1,
+		Target:   "svc.example.net.",
+	}
+	ownerA := &dns.A{
+		Hdr: dns.RR_Header{
+			Name:   "example.com.",
+			Rrtype: dns.TypeA,
+			Class:  dns.ClassINET,
+		},
+		A: net.IPv4(10, 0, 0, 1),
+	}
+	targetA := &dns.A{
+		Hdr: dns.RR_Header{
+			Name:   "svc.example.net.",
+			Rrtype: dns.TypeA,
+			Class:  dns.ClassINET,
+		},
+		A: net.IPv4(10, 0, 0, 2),
+	}
+
+	tests := []struct {
+		name     string
+		qtype    uint16
+		answer   dns.RR
+		expected []dns.RR
+	}{
+		{
+			name:     "HTTPSWithOwnerTarget",
+			qtype:    dns.TypeHTTPS,
+			answer:   https,
+			expected: []dns.RR{https, ownerA},
+		},
+
+		{
+			name:     "SVCBWithExplicitTarget",
+			qtype:    dns.TypeSVCB,
+			answer:   svcb,
+			expected: []dns.RR{svcb, ownerA, targetA},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := new(dns.Msg)
+			query.SetQuestion("example.com.", tt.qtype)
+			resp := new(dns.Msg)
+			resp.SetReply(query)
+			resp.Answer = []dns.RR{tt.answer}
+			resp.Extra = []dns.RR{ownerA, targetA}
+
+			valid, err := ResponseExtractValidAnswersWithAdditional(query.Question[0], resp)
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, valid)
+		})
+	}
+}
+
+func TestResponseExtractValidAnswersStrict(t *testing.T) {
+	newCNAME := func(name, target string) dns.RR {
+		return &dns.CNAME{
+			Hdr: dns.RR_Header{
+				Name:   name,
+				Rrtype: dns.TypeCNAME,
+				Class:  dns.ClassINET,
+			},
+			Target: target,
+		}
+	}
+	newA := func(name string) dns.RR {
+		return &dns.A{
+			Hdr: dns.RR_Header{
+				Name:   name,
+				Rrtype: dns.TypeA,
+				Class:  dns.ClassINET,
+			},
+			A: net.IPv4(127, 0, 0, 1),
+		}
+	}
+	newAAAA := func(name string) dns.RR {
+		return &dns.AAAA{
+			Hdr: dns.RR_Header{
+				Name:   name,
+				Rrtype: dns.TypeAAAA,
+				Class:  dns.ClassINET,
+			},
+			AAAA: net.ParseIP("::1"),
+		}
+	}
+
+	tests := []struct {
+		name     string
+		qtype    uint16
+		answers  []dns.RR
+		expected int
+		err      error
+	}{
+		{
+			name:     "MatchingTypeWithoutCNAME",
+			qtype:    dns.TypeA,
+			answers:  []dns.RR{newA("www.example.com.")},
+			expected: 1,
+		},
+
+		{
+			name:  "MatchingTypeAtChainEnd",
+			qtype: dns.TypeA,
+			answers: []dns.RR{
+				newCNAME("www.example.com.", "example.com."),
+				newA("EXAMPLE.com."),
+			},
+			expected: 2,
+		},
+
+		{
+			name:    "OnlyCNAME",
+			qtype:   dns.TypeA,
+			answers: []dns.RR{newCNAME("www.example.com.", "example.com.")},
+			err:     ErrTypeMismatch,
+		},
+
+		{
+			name:  "WrongTypeAtChainEnd",
+			qtype: dns.TypeA,
+			answers: []dns.RR{
+				newCNAME("www.example.com.", "example.com."),
+				newAAAA("example.com."),
+			},
+			err: ErrTypeMismatch,
+		},
+
+		{
+			name:  "MatchingTypeNotAtChainEnd",
+			qtype: dns.TypeA,
+			answers: []dns.RR{
+				newA("www.example.com."),
+				newCNAME("www.example.com.", "example.com."),
+			},
+			err: ErrTypeMismatch,
+		},
+
+		{
+			name:     "CNAMEQuery",
+			qtype:    dns.TypeCNAME,
+			answers:  []dns.RR{newCNAME("www.example.com.", "example.com.")},
+			expected: 1,
+		},
+
+		{
+			name:     "ANYQuery",
+			qtype:    dns.TypeANY,
+			answers:  []dns.RR{newAAAA("www.example.com.")},
+			expected: 1,
+		},
+
+		{
+			name:    "NoAnswers",
+			qtype:   dns.TypeA,
+			answers: []dns.RR{newA("www.example.org.")},
+			err:     ErrNoData,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := new(dns.Msg)
+			query.SetQuestion("www.example.com.", tt.qtype)
+			resp := new(dns.Msg)
+			resp.SetReply(query)
+			resp.Answer = tt.answers
+
+			valid, err := ResponseExtractValidAnswersStrict(query.Question[0], resp)
+			if tt.err != nil {
+				require.ErrorIs(t, err, tt.err)
+				require.Nil(t, valid)
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, valid, tt.expected)
+		})
+	}
+}
+
+func TestResponseExtractValidAnswersCNAMEChain(t *testing.T) {
+	newCNAME := func(name, target string) dns.RR {
+		return &dns.CNAME{
+			Hdr: dns.RR_Header{
+				Name:   name,
+				Rrtype: dns.TypeCNAME,
+				Class:  dns.ClassINET,
+			},
+			Target: target,
+		}
+	}
+	newChain := func(length int) []dns.RR {
+		var rrs []dns.RR
+		name := "www.example.com."
+		for idx := range length {
+			target := fmt.Sprintf("c%d.example.com.", idx)
+			rrs = append(rrs, newCNAME(name, target))
+			name = target
+		}
+		return rrs
+	}
+
+	tests := []struct {
+		name     string
+		answers  []dns.RR
+		expected int
+		err      error
+	}{
+		{
+			name: "TwoRecordLoop",
+			answers: []dns.RR{
+				newCNAME("www.example.com.", "example.com."),
+				newCNAME("example.com.", "WWW.example.com."),
+			},
+			err: ErrCNAMELoop,
+		},
+
+		{
+			name:    "SelfLoop",
+			answers: []dns.RR{newCNAME("www.example.com.", "www.example.com.")},
+			err:     ErrCNAMELoop,
+		},
+
+		{
+			name:     "MaximumLengthChain",
+			answers:  newChain(DefaultMaxCNAMEChainLength),
+			expected: DefaultMaxCNAMEChainLength,
+		},
+
+		{
+			name:    "TwentyDeepChain",
+			answers: newChain(20),
+			err:     ErrCNAMEChainTooLong,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := new(dns.Msg)
+			query.SetQuestion("www.example.com.", dns.TypeA)
+			resp := new(dns.Msg)
+			resp.SetReply(query)
+			resp.Answer = tt.answers
+
+			valid, err := ResponseExtractValidAnswers(query.Question[0], resp)
+			if tt.err != nil {
+				require.ErrorIs(t, err, tt.err)
+				require.Nil(t, valid)
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, valid, tt.expected)
+		})
+	}
+}
+
+func TestResponseExtractValidAnswersDNAME(t *testing.T) {
+	dname := &dns.DNAME{
+		Hdr: dns.RR_Header{
+			Name:   "Example.com.",
+			Rrtype: dns.TypeDNAME,
+			Class:  dns.ClassINET,
+		},
+		Target: "example.net.",
+	}
+	cname := &dns.CNAME{
+		Hdr: dns.RR_Header{
+			Name:   "www.example.com.",
+			Rrtype: dns.TypeCNAME,
+			Class:  dns.ClassINET,
+		},
+		Target: "www.example.net.",
+	}
+	terminal := &dns.A{
+		Hdr: dns.RR_Header{
+			Name:   "www.example.net.",
+			Rrtype: dns.TypeA,
+			Class:  dns.ClassINET,
+		},
+		A: net.IPv4(127, 0, 0, 1),
+	}
+	unrelated := &dns.DNAME{
+		Hdr: dns.RR_Header{
+			Name:   "example.org.",
+			Rrtype: dns.TypeDNAME,
+			Class:  dns.ClassINET,
+		},
+		Target: "example.net.",
+	}
+	rootDNAME := &dns.DNAME{
+		Hdr: dns.RR_Header{
+			Name:   ".",
+			Rrtype: dns.TypeDNAME,
+			Class:  dns.ClassINET,
+		},
+		Target: "example.net.",
+	}
+	rootTerminal := &dns.A{
+		Hdr: dns.RR_Header{
+			Name:   "www.example.com.example.net.",
+			Rrtype: dns.TypeA,
+			Class:  dns.ClassINET,
+		},
+		A: net.IPv4(127, 0, 0, 1),
+	}
+
+	tests := []struct {
+		name     string
+		answers  []dns.RR
+		expected []dns.RR
+		err      error
+	}{
+		{
+			name:     "DNAMEWithSynthesizedCNAME",
+			answers:  []dns.RR{dname, cname, terminal},
+			expected: []dns.RR{dname, cname, terminal},
+		},
+
+		{
+			name:     "DNAMEWithoutSynthesizedCNAME",
+			answers:  []dns.RR{dname, terminal},
+			expected: []dns.RR{dname, terminal},
+		},
+
+		{
+			name:     "UnrelatedDNAME",
+			answers:  []dns.RR{unrelated, cname, terminal},
+			expected: []dns.RR{cname, terminal},
+		},
+
+		{
+			name:     "RootDNAME",
+			answers:  []dns.RR{rootDNAME, rootTerminal},
+			expected: []dns.RR{rootDNAME, rootTerminal},
+		},
+
+		{
+			name: "DNAMELoop",
+			answers: []dns.RR{
+				dname,
+				&dns.DNAME{
+					Hdr: dns.RR_Header{
+						Name:   "example.net.",
+						Rrtype: dns.TypeDNAME,
+						Class:  dns.ClassINET,
+					},
+					Target: "example.com.",
+				},
+			},
+			err: ErrCNAMELoop,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := new(dns.Msg)
+			query.SetQuestion("www.example.com.", dns.TypeA)
+			resp := new(dns.Msg)
+			resp.SetReply(query)
+			resp.Answer = tt.answers
+
+			valid, err := ResponseExtractValidAnswersStrict(query.Question[0], resp)
+			if tt.err != nil {
+				require.ErrorIs(t, err, tt.err)
+				require.Nil(t, valid)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, valid)
+
+			parsed := &Response{Query: query, Response: resp, ValidRRs: valid}
+			require.True(t, parsed.CNAMETargetsMatchData())
+		})
+	}
+}
+
+func TestParseResponseWithMaxCNAMEChainLength(t *testing.T) {
+	query := new(dns.Msg)
+	query.SetQuestion("www.example.com.", dns.TypeA)
+	resp := new(dns.Msg)
+	resp.SetReply(query)
+	resp.Answer = []dns.RR{
+		&dns.CNAME{
+			Hdr:    dns.RR_Header{Name: "www.example.com.", Rrtype: dns.TypeCNAME, Class: dns.ClassINET},
+			Target: "a.example.com.",
+		},
+		&dns.CNAME{
+			Hdr:    dns.RR_Header{Name: "a.example.com.", Rrtype: dns.TypeCNAME, Class: dns.ClassINET},
+			Target: "b.example.com.",
+		},
+		&dns.A{
+			Hdr: dns.RR_Header{Name: "b.example.com.", Rrtype: dns.TypeA, Class: dns.ClassINET},
+			A:   net.IPv4(127, 0, 0, 1),
+		},
+	}
+
+	parsed, err := ParseResponse(query, resp)
+	require.NoError(t, err)
+	require.Len(t, parsed.ValidRRs, 3)
+
+	parsed, err = ParseResponse(query, resp, WithMaxCNAMEChainLength(2))
+	require.NoError(t, err)
+	require.Len(t, parsed.ValidRRs, 3)
+
+	parsed, err = ParseResponse(query, resp, WithMaxCNAMEChainLength(1))
+	require.ErrorIs(t, err, ErrCNAMEChainTooLong)
+	require.Nil(t, parsed)
+}
+
+func TestParseResponseQueryWithoutTrailingDot(t *testing.T) {
+	query := new(dns.Msg)
+	query.SetQuestion("www.example.com", dns.TypeA)
+
+	resp := new(dns.Msg)
+	resp.SetReply(query)
+	resp.RecursionAvailable = true
+	resp.Question[0].Name = "www.example.com."
+	resp.Answer = []dns.RR{
+		&dns.CNAME{
+			Hdr:    dns.RR_Header{Name: "www.example.com.", Rrtype: dns.TypeCNAME, Class: dns.ClassINET},
+			Target: "example.com.",
+		},
+		&dns.A{
+			Hdr: dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeA, Class: dns.ClassINET},
+			A:   net.IPv4(127, 0, 0, 1),
+		},
+	}
+
+	rp, err := ParseResponse(query, resp)
+	require.NoError(t, err)
+	require.Equal(t, resp.Answer, rp.ValidRRs)
+}
+
+func TestParseResponse(t *testing.T) {
+	makeQuery := func(name string, qtype uint16) *dns.Msg {
+		msg := new(dns.Msg)
+		msg.SetQuestion(name, qtype)
+		return msg
+	}
+
+	tests := []struct {
+		name     string
+		query    *dns.Msg
+		makeResp func(*dns.Msg) *dns.Msg
+		expected error
+	}{
+		{
+			name:  "ValidResponse",
+			query: makeQuery("example.com.", dns.TypeA),
+			makeResp: func(query *dns.Msg) *dns.Msg {
+				resp := new(dns.Msg)
+				resp.SetReply(query)
+				resp.Answer = []dns.RR{&dns.A{
+					Hdr: dns.RR_Header{
+						Name:   "example.com.",
+						Rrtype: dns.TypeA,
+						Class:  dns.ClassINET,
+					},
+					A: net.IPv4(127, 0, 0, 1),
+				}}
+				return resp
+			},
+			expected: nil,
+		},
+
+		{
+			name:  "InvalidResponseID",
+			query: makeQuery("example.com.", dns.TypeA),
+			makeResp: func(query *dns.Msg) *dns.Msg {
+				resp := new(dns.Msg)
+				resp.SetReply(query)
+				resp.Id++
+				return resp
+			},
+			expected: ErrInvalidResponse,
+		},
+
+		{
+			name:  "TruncatedResponse",
+			query: makeQuery("example.com.", dns.TypeA),
+			makeResp: func(query *dns.Msg) *dns.Msg {
+				resp := new(dns.Msg)
+				resp.SetReply(query)
+				resp.Truncated = true
+				return resp
+			},
+			expected: ErrTruncatedResponse,
+		},
+
+		{
+			name:  "ServerMisbehaving",
+			query: makeQuery("example.com.", dns.TypeA),
+			makeResp: func(query *dns.Msg) *dns.Msg {
+				resp := new(dns.Msg)
+				resp.SetReply(query)
+				resp.Rcode = dns.RcodeRefused
+				return resp
+			},
+			expected: ErrServerMisbehaving,
+		},
+
+		{
+			name:  "NoData",
+			query: makeQuery("example.com.", dns.TypeA),
+			makeResp: func(query *dns.Msg) *dns.Msg {
+				resp := new(dns.Msg)
+				resp.SetReply(query)
+				resp.Authoritative = true
+				resp.RecursionAvailable = true
+				resp.Answer = nil
+				return resp
+			},
+			expected: ErrNoData,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := tt.makeResp(tt.query)
+			_, err := ParseResponse(tt.query, resp)
+			if tt.expected != nil {
+				require.ErrorIs(t, err, tt.expected)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestQueryValidateAndParse(t *testing.T) {
+	query := NewQuery("www.example.com", dns.TypeA, WithID(1234))
+
+	newRawResponse := func(id uint16, name string) []byte {
+		resp := new(dns.Msg)
+		resp.Id = id
+		resp.Response = true
+		resp.RecursionDesired = true
+		resp.Question = []dns.Question{{Name: name, Qtype: dns.TypeA, Qclass: dns.ClassINET}}
+		resp.Answer = []dns.RR{&dns.A{
+			Hdr: dns.RR_Header{
+				Name:   name,
+				Rrtype: dns.TypeA,
+				Class:  dns.ClassINET,
+			},
+			A: net.IPv4(127, 0, 0, 1),
+		}}
+		return runtimex.PanicOnError1(resp.Pack())
+	}
+
+	tests := []struct {
+		name     string
+		raw      []byte
+		expected error
+	}{
+		{
+			name:     "ValidResponse",
+			raw:      newRawResponse(1234, "www.example.com."),
+			expected: nil,
+		},
+
+		{
+			name:     "IDMismatch",
+			raw:      newRawResponse(4321, "www.example.com."),
+			expected: ErrInvalidResponse,
+		},
+
+		{
+			name:     "QuestionMismatch",
+			raw:      newRawResponse(1234, "www.example.org."),
+			expected: ErrInvalidResponse,
+		},
+
+		{
+			name:     "MalformedResponse",
+			raw:      []byte{0x04, 0xd2},
+			expected: ErrCannotUnmarshalMessage,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed, err := query.ValidateAndParse(tt.raw)
+			if tt.expected != nil {
+				require.ErrorIs(t, err, tt.expected)
+				require.Nil(t, parsed)
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, parsed.ValidRRs, 1)
+		})
+	}
+
+	t.Run("InvalidQuery", func(t *testing.T) {
+		query := NewQuery("bad name.example", dns.TypeA)
+		parsed, err := query.ValidateAndParse(newRawResponse(query.ID, "bad name.example."))
+		require.Error(t, err)
+		require.Nil(t, parsed)
+	})
+}
+
+func TestParseResponseBytes(t *testing.T) {
+	query := new(dns.Msg)
+	query.SetQuestion("example.com.", dns.TypeA)
+
+	resp := new(dns.Msg)
+	resp.SetReply(query)
+	resp.Answer = []dns.RR{&dns.A{
+		Hdr: dns.RR_Header{
+			Name:   "example.com.",
+			Rrtype: dns.TypeA,
+			Class:  dns.ClassINET,
+		},
+		A: net.IPv4(127, 0, 0, 1),
+	}}
+	raw := runtimex.PanicOnError1(resp.Pack())
+
+	tests := []struct {
+		name     string
+		raw      []byte
+		expected error
+	}{
+		{
+			name:     "ValidResponse",
+			raw:      raw,
+			expected: nil,
+		},
+
+		{
+			name:     "EmptyBuffer",
+			raw:      []byte{},
+			expected: ErrCannotUnmarshalMessage,
+		},
+
+		{
+			name:     "TruncatedHeader",
+			raw:      raw[:7],
+			expected: ErrCannotUnmarshalMessage,
+		},
+
+		{
+			name:     "TruncatedBody",
+			raw:      raw[:len(raw)-2],
+			expected: ErrCannotUnmarshalMessage,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed, err := ParseResponseBytes(query, tt.raw)
+			if tt.expected != nil {
+				require.ErrorIs(t, err, tt.expected)
+				require.Nil(t, parsed)
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, parsed.ValidRRs, 1)
+			require.Equal(t, tt.raw, parsed.Raw)
+		})
+	}
+}
+
+func TestResponseRecoverPanic(t *testing.T) {
+	t.Run("Panic", func(t *testing.T) {
+		err := responseRecoverPanic(func() error {
+			panic("mascetti")
+		})
+		require.ErrorContains(t, err, "recovered from panic: mascetti")
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		expected := errors.New("mocked error")
+		err := responseRecoverPanic(func() error {
+			return expected
+		})
+		require.ErrorIs(t, err, expected)
+	})
+
+	t.Run("Success", func(t *testing.T) {
+		err := responseRecoverPanic(func() error {
+			return nil
+		})
+		require.NoError(t, err)
+	})
+}
+
+func FuzzParseResponseBytes(f *testing.F) {
+	query := new(dns.Msg)
+	query.SetQuestion("www.example.com.", dns.TypeA)
+
+	// Seed the corpus with a few valid responses
+	resp := new(dns.Msg)
+	resp.SetReply(query)
+	resp.Answer = []dns.RR{
+		&dns.CNAME{
+			Hdr:    dns.RR_Header{Name: "www.example.com.", Rrtype: dns.TypeCNAME, Class: dns.ClassINET},
+			Target: "example.com.",
+		},
+		&dns.A{
+			Hdr: dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeA, Class: dns.ClassINET},
+			A:   net.IPv4(127, 0, 0, 1),
+		},
+	}
+	f.Add(runtimex.PanicOnError1(resp.Pack()))
+	resp.Ns = []dns.RR{&dns.SOA{
+		Hdr:  dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeSOA, Class: dns.ClassINET},
+		Ns:   "ns.example.com.",
+		Mbox: "admin.example.com.",
+	}}
+	resp.SetEdns0(QueryMaxResponseSizeUDP, true)
+	f.Add(runtimex.PanicOnError1(resp.Pack()))
+	nxdomain := new(dns.Msg)
+	nxdomain.SetRcode(query, dns.RcodeNameError)
+	f.Add(runtimex.PanicOnError1(nxdomain.Pack()))
+	f.Add([]byte{})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		parsed, err := ParseResponseBytes(query, data, WithAdditional(), WithWarnings())
+		if err != nil {
+			require.Nil(t, parsed)
+			return
+		}
+		require.Equal(t, data, parsed.Raw)
+	})
+}
+
+func TestResponseBytes(t *testing.T) {
+	query := new(dns.Msg)
+	query.SetQuestion("example.com.", dns.TypeA)
+
+	resp := new(dns.Msg)
+	resp.SetReply(query)
+	resp.Answer = []dns.RR{&dns.A{
+		Hdr: dns.RR_Header{
+			Name:   "example.com.",
+			Rrtype: dns.TypeA,
+			Class:  dns.ClassINET,
+		},
+		A: net.IPv4(127, 0, 0, 1),
+	}}
+	raw := runtimex.PanicOnError1(resp.Pack())
+
+	t.Run("FromBytes", func(t *testing.T) {
+		buffer := slices.Clone(raw)
+		parsed := runtimex.PanicOnError1(ParseResponseBytes(query, buffer))
+
+		// Make sure the response does not alias the caller buffer
+		buffer[0] ^= 0xff
+		data, err := parsed.Bytes()
+		require.NoError(t, err)
+		require.Equal(t, raw, data)
+	})
+
+	t.Run("FromMsg", func(t *testing.T) {
+		parsed := runtimex.PanicOnError1(ParseResponse(query, resp))
+		require.Nil(t, parsed.Raw)
+		data, err := parsed.Bytes()
+		require.NoError(t, err)
+		require.Equal(t, raw, data)
+	})
+}
+
+func TestResponseUnicodeName(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+		wantErr  bool
+	}{
+		{"Punycode", "xn--bcher-kva.example.", "bücher.example.", false},
+		{"ASCII", "WWW.Example.COM.", "WWW.Example.COM.", false},
+		{"Underscore", "_443._tcp.example.com.", "_443._tcp.example.com.", false},
+		{"Root", ".", ".", false},
+		{"InvalidPunycode", "xn--zz.example.", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name, err := ResponseUnicodeName(tt.input)
+			if tt.wantErr {
+				require.Error(t, err)
+				require.Empty(t, name)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, name)
+		})
+	}
+
+	t.Run("RoundTrip", func(t *testing.T) {
+		query := NewQuery("bücher.example", dns.TypeA)
+		ascii := runtimex.PanicOnError1(query.ASCIIName())
+		require.Equal(t, "xn--bcher-kva.example.", ascii)
+		name, err := ResponseUnicodeName(ascii)
+		require.NoError(t, err)
+		require.Equal(t, "bücher.example.", name)
+	})
+}
+
+func TestResponseStats(t *testing.T) {
+	newA := func(name string) dns.RR {
+		return &dns.A{
+			Hdr: dns.RR_Header{
+				Name:   name,
+				Rrtype: dns.TypeA,
+				Class:  dns.ClassINET,
+			},
+			A: net.IPv4(127, 0, 0, 1),
+		}
+	}
+	query := new(dns.Msg)
+	query.SetQuestion("example.com.", dns.TypeA)
+
+	resp := new(dns.Msg)
+	resp.SetReply(query)
+	resp.Answer = []dns.RR{newA("example.com."), newA("example.com."), newA("example.org.")}
+	resp.Ns = []dns.RR{&dns.NS{
+		Hdr: dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeNS, Class: dns.ClassINET},
+		Ns:  "ns.example.com.",
+	}}
+	resp.Extra = []dns.RR{newA("ns.example.com.")}
+	resp.SetEdns0(QueryMaxResponseSizeUDP, false)
+	raw := runtimex.PanicOnError1(resp.Pack())
+
+	expected := ResponseStats{
+		WireSize:         len(raw),
+		AnswerCount:      3,
+		AuthorityCount:   1,
+		AdditionalCount:  2,
+		ValidAnswerCount: 2,
+	}
+
+	t.Run("FromBytes", func(t *testing.T) {
+		parsed := runtimex.PanicOnError1(ParseResponseBytes(query, raw))
+		require.Equal(t, expected, parsed.Stats())
+	})
+
+	t.Run("FromMsg", func(t *testing.T) {
+		parsed := runtimex.PanicOnError1(ParseResponse(query, resp))
+		require.Equal(t, expected, parsed.Stats())
+	})
+
+	t.Run("CannotPack", func(t *testing.T) {
+		invalid := resp.Copy()
+		invalid.Answer = append(invalid.Answer, &dns.A{
+			Hdr: dns.RR_Header{Name: "example..com.", Rrtype: dns.TypeA, Class: dns.ClassINET},
+			A:   net.IPv4(127, 0, 0, 1),
+		})
+		parsed := &Response{Response: invalid}
+		stats := parsed.Stats()
+		require.Zero(t, stats.WireSize)
+		require.Equal(t, 4, stats.AnswerCount)
+	})
+
+	t.Run("NilResponse", func(t *testing.T) {
+		require.Equal(t, ResponseStats{}, (&Response{}).Stats())
+	})
+}
+
+func TestParseResponseWithWarnings(t *testing.T) {
+	newAnswer := func(class uint16) dns.RR {
+		return &dns.A{
+			Hdr: dns.RR_Header{
+				Name:   "example.com.",
+				Rrtype: dns.TypeA,
+				Class:  class,
+			},
+			A: net.IPv4(127, 0, 0, 1),
+		}
+	}
+
+	tests := []struct {
+		name     string
+		modify   func(resp *dns.Msg)
+		expected []string
+	}{
+		{
+			name:     "NoWarnings",
+			modify:   func(resp *dns.Msg) {},
+			expected: []string{},
+		},
+
+		{
+			name: "OpcodeMismatch",
+			modify: func(resp *dns.Msg) {
+				resp.Opcode = dns.OpcodeStatus
+			},
+			expected: []string{"opcode mismatch: query QUERY, response STATUS"},
+		},
+
+		{
+			name: "MultipleOPT",
+			modify: func(resp *dns.Msg) {
+				resp.SetEdns0(1232, false)
+				resp.Extra = append(resp.Extra, resp.Extra[0])
+			},
+			expected: []string{"multiple OPT records in additional section: 2"},
+		},
+
+		{
+			name: "MisplacedOPT",
+			modify: func(resp *dns.Msg) {
+				opt := new(dns.OPT)
+				opt.Hdr.Name = "."
+				opt.Hdr.Rrtype = dns.TypeOPT
+				resp.Ns = append(resp.Ns, opt)
+			},
+			expected: []string{"OPT record in authority section"},
+		},
+
+		{
+			name: "ForeignClass",
+			modify: func(resp *dns.Msg) {
+				resp.Answer = append(resp.Answer, newAnswer(dns.ClassCHAOS))
+			},
+			expected: []string{"answer RR for example.com. has class CH, expected IN"},
+		},
+
+		{
+			name: "RDNotEchoed",
+			modify: func(resp *dns.Msg) {
+				resp.RecursionDesired = false
+			},
+			expected: []string{"RD bit not echoed: query true, response false"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := new(dns.Msg)
+			query.SetQuestion("example.com.", dns.TypeA)
+
+			resp := new(dns.Msg)
+			resp.SetReply(query)
+			resp.RecursionAvailable = true
+			resp.Answer = []dns.RR{newAnswer(dns.ClassINET)}
+			tt.modify(resp)
+
+			rp, err := ParseResponse(query, resp, WithWarnings())
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, rp.Warnings())
+
+			rp, err = ParseResponse(query, resp)
+			require.NoError(t, err)
+			require.Empty(t, rp.Warnings())
+		})
+	}
+
+	t.Run("RDSetWithoutRecursion", func(t *testing.T) {
+		query := new(dns.Msg)
+		query.SetQuestion("example.com.", dns.TypeA)
+		query.RecursionDesired = false
+
+		resp := new(dns.Msg)
+		resp.SetReply(query)
+		resp.Authoritative = true
+		resp.RecursionDesired = true
+		resp.Answer = []dns.RR{newAnswer(dns.ClassINET)}
+
+		rp, err := ParseResponse(query, resp, WithWarnings())
+		require.NoError(t, err)
+		require.Equal(t, []string{"RD bit not echoed: query false, response true"}, rp.Warnings())
+	})
+}
+
+func TestParseResponseANY(t *testing.T) {
+	header := func(name string, rrtype uint16) dns.RR_Header {
+		return dns.RR_Header{Name: name, Rrtype: rrtype, Class: dns.ClassINET}
+	}
+	query := runtimex.PanicOnError1(NewQueryANY("example.com").NewMsg())
+
+	t.Run("MultiType", func(t *testing.T) {
+		resp := new(dns.Msg)
+		resp.SetReply(query)
+		resp.RecursionAvailable = true
+		resp.Answer = []dns.RR{
+			&dns.A{Hdr: header("example.com.", dns.TypeA), A: net.IPv4(127, 0, 0, 1)},
+			&dns.AAAA{Hdr: header("example.com.", dns.TypeAAAA), AAAA: net.ParseIP("::1")},
+			&dns.MX{Hdr: header("example.com.", dns.TypeMX), Mx: "mx.example.com."},
+			&dns.TXT{Hdr: header("example.com.", dns.TypeTXT), Txt: []string{"v=spf1 -all"}},
+			&dns.A{Hdr: header("example.org.", dns.TypeA), A: net.IPv4(127, 0, 0, 2)},
+		}
+
+		rp, err := ParseResponse(query, resp, WithWarnings())
+		require.NoError(t, err)
+		require.Equal(t, resp.Answer[:4], rp.ValidRRs)
+		require.Empty(t, rp.Warnings())
+	})
+
+	t.Run("MinimalRFC8482", func(t *testing.T) {
+		resp := new(dns.Msg)
+		resp.SetReply(query)
+		resp.RecursionAvailable = true
+		resp.Answer = []dns.RR{
+			&dns.HINFO{Hdr: header("example.com.", dns.TypeHINFO), Cpu: "RFC8482"},
+		}
+
+		rp, err := ParseResponse(query, resp, WithWarnings())
+		require.NoError(t, err)
+		require.Len(t, rp.ValidRRs, 1)
+		require.Equal(t, []string{"minimal RFC8482 response to ANY query"}, rp.Warnings())
+	})
+}
+
+func TestParseResponseWithProfile(t *testing.T) {
+	tests := []struct {
+		name          string
+		profile       QueryProfile
+		authoritative bool
+		expected      error
+	}{
+		{"StubNonAuthoritative", ProfileStub, false, nil},
+		{"IterativeNonAuthoritative", ProfileIterative, false, nil},
+		{"AuthoritativeProbeNonAuthoritative", ProfileAuthoritativeProbe, false, ErrNotAuthoritative},
+		{"AuthoritativeProbeAuthoritative", ProfileAuthoritativeProbe, true, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := new(dns.Msg)
+			query.SetQuestion("example.com.", dns.TypeA)
+			resp := new(dns.Msg)
+			resp.SetReply(query)
+			resp.Authoritative = tt.authoritative
+			resp.Answer = []dns.RR{&dns.A{
+				Hdr: dns.RR_Header{
+					Name:   "example.com.",
+					Rrtype: dns.TypeA,
+					Class:  dns.ClassINET,
+				},
+				A: net.IPv4(127, 0, 0, 1),
+			}}
+
+			rp, err := ParseResponse(query, resp, WithProfile(tt.profile))
+			if tt.expected != nil {
+				require.ErrorIs(t, err, tt.expected)
+				require.Nil(t, rp)
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, rp.ValidRRs, 1)
+		})
+	}
+}
+
+func TestParseResponseWithAllowNODATA(t *testing.T) {
+	soa := &dns.SOA{
+		Hdr:  dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeSOA, Class: dns.ClassINET},
+		Ns:   "ns.example.com.",
+		Mbox: "admin.example.com.",
+	}
+	ns := &dns.NS{
+		Hdr: dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeNS, Class: dns.ClassINET},
+		Ns:  "ns.example.com.",
+	}
+	unrelated := &dns.A{
+		Hdr: dns.RR_Header{Name: "example.org.", Rrtype: dns.TypeA, Class: dns.ClassINET},
+		A:   net.IPv4(127, 0, 0, 1),
+	}
+
+	tests := []struct {
+		name          string
+		rcode         int
+		authoritative bool
+		answer        []dns.RR
+		authority     []dns.RR
+		expected      error
+	}{
+		{"WithSOA", dns.RcodeSuccess, true, nil, []dns.RR{soa}, nil},
+		{"WithSOAAndNS", dns.RcodeSuccess, true, nil, []dns.RR{soa, ns}, nil},
+		{"EmptyAuthority", dns.RcodeSuccess, true, nil, nil, nil},
+		{"Referral", dns.RcodeSuccess, false, nil, []dns.RR{ns}, ErrNoData},
+		{"UnrelatedAnswer", dns.RcodeSuccess, true, []dns.RR{unrelated}, []dns.RR{soa}, ErrNoData},
+		{"NXDOMAIN", dns.RcodeNameError, true, nil, []dns.RR{soa}, ErrNoName},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := new(dns.Msg)
+			query.SetQuestion("example.com.", dns.TypeAAAA)
+			resp := new(dns.Msg)
+			resp.SetRcode(query, tt.rcode)
+			resp.Authoritative = tt.authoritative
+			resp.Answer = tt.answer
+			resp.Ns = tt.authority
+
+			// without the option we always fail
+			rp, err := ParseResponse(query, resp)
+			require.Error(t, err)
+			require.Nil(t, rp)
+
+			rp, err = ParseResponse(query, resp, WithAllowNODATA(), WithAdditional())
+			if tt.expected != nil {
+				require.ErrorIs(t, err, tt.expected)
+				require.Nil(t, rp)
+				return
+			}
+			require.NoError(t, err)
+			require.NotNil(t, rp.ValidRRs)
+			require.Empty(t, rp.ValidRRs)
+			require.True(t, rp.IsNODATA())
+		})
+	}
+}
+
+func TestResponseIsNODATAAgreesWithStatus(t *testing.T) {
+	newNS := func(owner string) *dns.NS {
+		return &dns.NS{
+			Hdr: dns.RR_Header{Name: owner, Rrtype: dns.TypeNS, Class: dns.ClassINET},
+			Ns:  "ns.example.com.",
+		}
+	}
+
+	tests := []struct {
+		name          string
+		authoritative bool
+		authority     []dns.RR
+	}{
+		{"AuthoritativeWithNSAndNoSOA", true, []dns.RR{newNS("example.com.")}},
+		{"NSForUnrelatedZone", false, []dns.RR{newNS("example.org.")}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := new(dns.Msg)
+			query.SetQuestion("www.example.com.", dns.TypeAAAA)
+			resp := new(dns.Msg)
+			resp.SetReply(query)
+			resp.Authoritative = tt.authoritative
+			resp.RecursionAvailable = true
+			resp.Ns = tt.authority
+
+			rp, err := ParseResponse(query, resp, WithAllowNODATA())
+			require.NoError(t, err)
+			require.Empty(t, rp.ValidRRs)
+			require.True(t, rp.IsNODATA())
+			require.Equal(t, ResponseStatusNODATA, rp.Status())
+		})
+	}
+}
+
+func TestNegativeTTL(t *testing.T) {
+	newSOA := func(ttl, minttl uint32) *dns.SOA {
+		return &dns.SOA{
+			Hdr: dns.RR_Header{
+				Name:   "example.com.",
+				Rrtype: dns.TypeSOA,
+				Class:  dns.ClassINET,
+				Ttl:    ttl,
+			},
+			Ns:     "ns.example.com.",
+			Mbox:   "admin.example.com.",
+			Minttl: minttl,
+		}
+	}
+	ns := &dns.NS{
+		Hdr: dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeNS, Class: dns.ClassINET},
+		Ns:  "ns.example.com.",
+	}
+
+	tests := []struct {
+		name      string
+		authority []dns.RR
+		expected  uint32
+		expectOK  bool
+	}{
+		{"MinimumBelowTTL", []dns.RR{newSOA(3600, 300)}, 300, true},
+		{"TTLBelowMinimum", []dns.RR{newSOA(60, 300)}, 60, true},
+		{"SOAAfterNS", []dns.RR{ns, newSOA(900, 900)}, 900, true},
+		{"NoSOA", []dns.RR{ns}, 0, false},
+		{"EmptyAuthority", nil, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := new(dns.Msg)
+			query.SetQuestion("nonexistent.example.com.", dns.TypeA)
+			resp := new(dns.Msg)
+			resp.SetRcode(query, dns.RcodeNameError)
+			resp.Ns = tt.authority
+
+			// Make sure this is the case where NegativeTTL is useful
+			_, err := ParseResponse(query, resp)
+			require.ErrorIs(t, err, ErrNoName)
+
+			ttl, ok := NegativeTTL(resp)
+			require.Equal(t, tt.expectOK, ok)
+			require.Equal(t, tt.expected, ttl)
+		})
+	}
+}
+
+func TestResponseIsNODATA(t *testing.T) {
+	query := new(dns.Msg)
+	query.SetQuestion("www.example.com.", dns.TypeAAAA)
+	cname := &dns.CNAME{
+		Hdr:    dns.RR_Header{Name: "www.example.com.", Rrtype: dns.TypeCNAME, Class: dns.ClassINET},
+		Target: "example.com.",
+	}
+	aaaa := &dns.AAAA{
+		Hdr:  dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeAAAA, Class: dns.ClassINET},
+		AAAA: net.ParseIP("2001:db8::1"),
+	}
+
+	tests := []struct {
+		name     string
+		resp     *Response
+		expected bool
+	}{
+		{
+			name: "CNAMEToNameWithoutData",
+			resp: &Response{
+				Query:    query,
+				Response: &dns.Msg{Answer: []dns.RR{cname}},
+				ValidRRs: []dns.RR{cname},
+			},
+			expected: true,
+		},
+
+		{
+			name: "WithData",
+			resp: &Response{
+				Query:    query,
+				Response: &dns.Msg{Answer: []dns.RR{cname, aaaa}},
+				ValidRRs: []dns.RR{cname, aaaa},
+			},
+			expected: false,
+		},
+
+		{
+			name: "NonzeroRcode",
+			resp: &Response{
+				Query:    query,
+				Response: &dns.Msg{MsgHdr: dns.MsgHdr{Rcode: dns.RcodeNameError}},
+				ValidRRs: []dns.RR{},
+			},
+			expected: false,
+		},
+
+		{
+			name: "NilQuery",
+			resp: &Response{
+				Response: &dns.Msg{},
+				ValidRRs: []dns.RR{},
+			},
+			expected: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.expected, tt.resp.IsNODATA())
+		})
+	}
+}
+
+func TestParseResponseWithReferrals(t *testing.T) {
+	newNS := func(owner string) *dns.NS {
+		return &dns.NS{
+			Hdr: dns.RR_Header{Name: owner, Rrtype: dns.TypeNS, Class: dns.ClassINET},
+			Ns:  "ns1." + owner,
+		}
+	}
+	soa := &dns.SOA{
+		Hdr:  dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeSOA, Class: dns.ClassINET},
+		Ns:   "ns.example.com.",
+		Mbox: "admin.example.com.",
+	}
+
+	tests := []struct {
+		name          string
+		options       []ParseOption
+		authoritative bool
+		authority     []dns.RR
+		expectNS      []string
+		expectErr     error
+	}{
+		{
+			name:      "DefaultRejectsReferral",
+			options:   nil,
+			authority: []dns.RR{newNS("example.com.")},
+			expectErr: ErrNoData,
+		},
+
+		{
+			name:      "WithReferrals",
+			options:   []ParseOption{WithReferrals()},
+			authority: []dns.RR{newNS("example.com.")},
+			expectNS:  []string{"ns1.example.com."},
+		},
+
+		{
+			name:      "ProfileIterative",
+			options:   []ParseOption{WithProfile(ProfileIterative)},
+			authority: []dns.RR{newNS("com.")},
+			expectNS:  []string{"ns1.com."},
+		},
+
+		{
+			name:      "UnrelatedZone",
+			options:   []ParseOption{WithReferrals()},
+			authority: []dns.RR{newNS("example.org.")},
+			expectErr: ErrNoData,
+		},
+
+		{
+			name:      "WithSOA",
+			options:   []ParseOption{WithReferrals()},
+			authority: []dns.RR{newNS("example.com."), soa},
+			expectErr: ErrNoData,
+		},
+
+		{
+			name:          "Authoritative",
+			options:       []ParseOption{WithReferrals()},
+			authoritative: true,
+			authority:     []dns.RR{newNS("example.com.")},
+			expectErr:     ErrNoData,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := new(dns.Msg)
+			query.SetQuestion("www.example.com.", dns.TypeA)
+			query.RecursionDesired = false
+			resp := new(dns.Msg)
+			resp.SetReply(query)
+			resp.Authoritative = tt.authoritative
+			resp.Ns = tt.authority
+
+			rp, err := ParseResponse(query, resp, tt.options...)
+			if tt.expectErr != nil {
+				require.ErrorIs(t, err, tt.expectErr)
+				require.Nil(t, rp)
+				return
+			}
+			require.NoError(t, err)
+			require.Empty(t, rp.ValidRRs)
+			require.Equal(t, ResponseStatusReferral, rp.Status())
+			ns, err := rp.RecordsNS()
+			require.NoError(t, err)
+			require.Equal(t, tt.expectNS, ns)
+		})
+	}
+}
+
+func TestResponseRecordsA(t *testing.T) {
+	resp := &Response{
+		ValidRRs: []dns.RR{
+			&dns.A{
+				Hdr: dns.RR_Header{
+					Name:   "example.com.",
+					Rrtype: dns.TypeA,
+					Class:  dns.ClassINET,
+				},
+				A: net.IPv4(127, 0, 0, 1),
+			},
+			&dns.A{
+				Hdr: dns.RR_Header{
+					Name:   "example.com.",
+					Rrtype: dns.TypeA,
+					Class:  dns.ClassINET,
+				},
+				A: net.IPv4(8, 8, 8, 8),
+			},
+			&dns.AAAA{
+				Hdr: dns.RR_Header{
+					Name:   "example.com.",
+					Rrtype: dns.TypeAAAA,
+					Class:  dns.ClassINET,
+				},
+				AAAA: net.ParseIP("2001:db8::1"),
+			},
+		},
+	}
+
+	addrs, err := resp.RecordsA()
+	require.NoError(t, err)
+	require.Equal(t, []string{"127.0.0.1", "8.8.8.8"}, addrs)
+}
+
+func TestResponseRecordsANoData(t *testing.T) {
+	resp := &Response{ValidRRs: []dns.RR{}}
+	addrs, err := resp.RecordsA()
+	require.ErrorIs(t, err, ErrNoData)
+	require.Nil(t, addrs)
+}
+
+func TestResponseRecordsAAAA(t *testing.T) {
+	resp := &Response{
+		ValidRRs: []dns.RR{
+			&dns.AAAA{
+				Hdr: dns.RR_Header{
+					Name:   "example.com.",
+					Rrtype: dns.TypeAAAA,
+					Class:  dns.ClassINET,
+				},
+				AAAA: net.ParseIP("2001:db8::1"),
+			},
+			&dns.A{
+				Hdr: dns.RR_Header{
+					Name:   "example.com.",
+					Rrtype: dns.TypeA,
+					Class:  dns.ClassINET,
+				},
+				A: net.IPv4(127, 0, 0, 1),
+			},
+		},
+	}
+
+	addrs, err := resp.RecordsAAAA()
+	require.NoError(t, err)
+	require.Equal(t, []string{"2001:db8::1"}, addrs)
+}
+
+func TestResponseRecordsAAAANoData(t *testing.T) {
+	resp := &Response{ValidRRs: []dns.RR{}}
+	addrs, err := resp.RecordsAAAA()
+	require.ErrorIs(t, err, ErrNoData)
+	require.Nil(t, addrs)
+}
+
+func TestResponseRecordsCNAME(t *testing.T) {
+	resp := &Response{
+		ValidRRs: []dns.RR{
+			&dns.CNAME{
+				Hdr: dns.RR_Header{
+					Name:   "www.example.com.",
+					Rrtype: dns.TypeCNAME,
+					Class:  dns.ClassINET,
+				},
+				Target: "example.com.",
+			},
+			&dns.CNAME{
+				Hdr: dns.RR_Header{
+					Name:   "example.com.",
+					Rrtype: dns.TypeCNAME,
+					Class:  dns.ClassINET,
+				},
+				Target: "example.net.",
+			},
+			&dns.A{
+				Hdr: dns.RR_Header{
+					Name:   "example.net.",
+					Rrtype: dns.TypeA,
+					Class:  dns.ClassINET,
+				},
+				A: net.IPv4(127, 0, 0, 1),
+			},
+		},
+	}
+
+	cnames, err := resp.RecordsCNAME()
+	require.NoError(t, err)
+	require.Equal(t, []string{"example.com.", "example.net."}, cnames)
+}
+
+func TestResponseRecordsCNAMENoData(t *testing.T) {
+	resp := &Response{ValidRRs: []dns.RR{}}
+	cnames, err := resp.RecordsCNAME()
+	require.ErrorIs(t, err, ErrNoData)
+	require.Nil(t, cnames)
+}
+
+func TestResponseRecordFirst(t *testing.T) {
+	resp := &Response{
+		ValidRRs: []dns.RR{
+			&dns.CNAME{
+				Hdr: dns.RR_Header{
+					Name:   "www.example.com.",
+					Rrtype: dns.TypeCNAME,
+					Class:  dns.ClassINET,
+				},
+				Target: "example.com.",
+			},
+			&dns.AAAA{
+				Hdr: dns.RR_Header{
+					Name:   "example.com.",
+					Rrtype: dns.TypeAAAA,
+					Class:  dns.ClassINET,
+				},
+				AAAA: net.ParseIP("2001:db8::2"),
+			},
+			&dns.A{
+				Hdr: dns.RR_Header{
+					Name:   "example.com.",
+					Rrtype: dns.TypeA,
+					Class:  dns.ClassINET,
+				},
+				A: net.IPv4(8, 8, 8, 8),
+			},
+			&dns.A{
+				Hdr: dns.RR_Header{
+					Name:   "example.com.",
+					Rrtype: dns.TypeA,
+					Class:  dns.ClassINET,
+				},
+				A: net.IPv4(127, 0, 0, 1),
+			},
+			&dns.AAAA{
+				Hdr: dns.RR_Header{
+					Name:   "example.com.",
+					Rrtype: dns.TypeAAAA,
+					Class:  dns.ClassINET,
+				},
+				AAAA: net.ParseIP("2001:db8::1"),
+			},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		first   func() (string, error)
+		records func() ([]string, error)
+		expect  string
+	}{
+		{name: "A", first: resp.RecordFirstA, records: resp.RecordsA, expect: "8.8.8.8"},
+		{name: "AAAA", first: resp.RecordFirstAAAA, records: resp.RecordsAAAA, expect: "2001:db8::2"},
+		{name: "CNAME", first: resp.RecordFirstCNAME, records: resp.RecordsCNAME, expect: "example.com."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, err := tt.first()
+			require.NoError(t, err)
+			require.Equal(t, tt.expect, value)
+
+			// Make sure "first" is consistent with the full list
+			values := runtimex.PanicOnError1(tt.records())
+			require.Equal(t, values[0], value)
+		})
+	}
+}
+
+func TestResponseRecordFirstNoData(t *testing.T) {
+	resp := &Response{ValidRRs: []dns.RR{}}
+	for _, first := range []func() (string, error){
+		resp.RecordFirstA,
+		resp.RecordFirstAAAA,
+		resp.RecordFirstCNAME,
+	} {
+		value, err := first()
+		require.ErrorIs(t, err, ErrNoData)
+		require.Empty(t, value)
+	}
+}
+
+func TestResponseRecordsMX(t *testing.T) {
+	newMX := func(pref uint16, mx string) *dns.MX {
+		return &dns.MX{
+			Hdr: dns.RR_Header{
+				Name:   "example.com.",
+				Rrtype: dns.TypeMX,
+				Class:  dns.ClassINET,
+			},
+			Preference: pref,
+			Mx:         mx,
+		}
+	}
+	resp := &Response{
+		ValidRRs: []dns.RR{
+			newMX(20, "mx3.example.com."),
+			&dns.A{
+				Hdr: dns.RR_Header{
+					Name:   "example.com.",
+					Rrtype: dns.TypeA,
+					Class:  dns.ClassINET,
+				},
+				A: net.IPv4(127, 0, 0, 1),
+			},
+			newMX(10, "mx2.example.com."),
+			newMX(10, "mx1.example.com."),
+		},
+	}
+
+	records, err := resp.RecordsMX()
+	require.NoError(t, err)
+	require.Len(t, records, 3)
+	require.Equal(t, "mx2.example.com.", records[0].Mx)
+	require.Equal(t, "mx1.example.com.", records[1].Mx)
+	require.Equal(t, "mx3.example.com.", records[2].Mx)
+}
+
+func TestResponseRecordsMXNoData(t *testing.T) {
+	resp := &Response{
+		ValidRRs: []dns.RR{
+			&dns.A{
+				Hdr: dns.RR_Header{
+					Name:   "example.com.",
+					Rrtype: dns.TypeA,
+					Class:  dns.ClassINET,
+				},
+				A: net.IPv4(127, 0, 0, 1),
+			},
+		},
+	}
+	records, err := resp.RecordsMX()
+	require.ErrorIs(t, err, ErrNoData)
+	require.Nil(t, records)
+}
+
+func TestResponseRecordsNAPTR(t *testing.T) {
+	newNAPTR := func(order, pref uint16, replacement string) *dns.NAPTR {
+		return &dns.NAPTR{
+			Hdr: dns.RR_Header{
+				Name:   "4.3.2.1.5.5.5.0.0.8.1.e164.arpa.",
+				Rrtype: dns.TypeNAPTR,
+				Class:  dns.ClassINET,
+			},
+			Order:       order,
+			Preference:  pref,
+			Flags:       "u",
+			Service:     "E2U+sip",
+			Regexp:      "!^.*$!sip:info@example.com!",
+			Replacement: replacement,
+		}
+	}
+	resp := &Response{
+		ValidRRs: []dns.RR{
+			newNAPTR(200, 10, "c."),
+			newNAPTR(100, 20, "b."),
+			&dns.A{
+				Hdr: dns.RR_Header{
+					Name:   "example.com.",
+					Rrtype: dns.TypeA,
+					Class:  dns.ClassINET,
+				},
+				A: net.IPv4(127, 0, 0, 1),
+			},
+			newNAPTR(100, 10, "a1."),
+			newNAPTR(100, 10, "a2."),
+		},
+	}
+
+	records, err := resp.RecordsNAPTR()
+	require.NoError(t, err)
+	require.Len(t, records, 4)
+	require.Equal(t, "a1.", records[0].Replacement)
+	require.Equal(t, "a2.", records[1].Replacement)
+	require.Equal(t, "b.", records[2].Replacement)
+	require.Equal(t, "c.", records[3].Replacement)
+	require.Equal(t, "u", records[0].Flags)
+	require.Equal(t, "E2U+sip", records[0].Service)
+	require.Equal(t, "!^.*$!sip:info@example.com!", records[0].Regexp)
+}
+
+func TestResponseRecordsNAPTRNoData(t *testing.T) {
+	resp := &Response{ValidRRs: []dns.RR{}}
+	records, err := resp.RecordsNAPTR()
+	require.ErrorIs(t, err, ErrNoData)
+	require.Nil(t, records)
+}
+
+func TestResponseRecordsTXT(t *testing.T) {
+	newTXT := func(txt ...string) *dns.TXT {
+		return &dns.TXT{
+			Hdr: dns.RR_Header{
+				Name:   "example.com.",
+				Rrtype: dns.TypeTXT,
+				Class:  dns.ClassINET,
+			},
+			Txt: txt,
+		}
+	}
+	resp := &Response{
+		ValidRRs: []dns.RR{
+			newTXT("v=spf1 ", "include:example.net ", "-all"),
+			&dns.A{
+				Hdr: dns.RR_Header{
+					Name:   "example.com.",
+					Rrtype: dns.TypeA,
+					Class:  dns.ClassINET,
+				},
+				A: net.IPv4(127, 0, 0, 1),
+			},
+			newTXT(),
+			newTXT("hello"),
+		},
+	}
+
+	records, err := resp.RecordsTXT()
+	require.NoError(t, err)
+	require.Equal(t, [][]string{
+		{"v=spf1 ", "include:example.net ", "-all"},
+		nil,
+		{"hello"},
+	}, records)
+
+	joined, err := resp.RecordsTXTJoined()
+	require.NoError(t, err)
+	require.Equal(t, []string{"v=spf1 include:example.net -all", "", "hello"}, joined)
+}
+
+func TestResponseRecordsTXTNoData(t *testing.T) {
+	resp := &Response{ValidRRs: []dns.RR{}}
+
+	records, err := resp.RecordsTXT()
+	require.ErrorIs(t, err, ErrNoData)
+	require.Nil(t, records)
+
+	joined, err := resp.RecordsTXTJoined()
+	require.ErrorIs(t, err, ErrNoData)
+	require.Nil(t, joined)
+}
+
+func TestResponseRecordsSVCB(t *testing.T) {
+	newSVCB := func(priority uint16, target string) *dns.SVCB {
+		return &dns.SVCB{
+			Hdr: dns.RR_Header{
+				Name:   "_dns.example.com.",
+				Rrtype: dns.TypeSVCB,
+				Class:  dns.ClassINET,
+			},
+			Priority: priority,
+			Target:   target,
+		}
+	}
+	resp := &Response{
+		ValidRRs: []dns.RR{
+			newSVCB(2, "b.example.com."),
+			newSVCB(1, "c.example.com."),
+			newSVCB(2, "a.example.com."),
+			newSVCB(0, "alias.example.com."),
+		},
+	}
+
+	records, err := resp.RecordsSVCB()
+	require.NoError(t, err)
+	var targets []string
+	for _, record := range records {
+		targets = append(targets, record.Target)
+	}
+	require.Equal(t, []string{
+		"alias.example.com.",
+		"c.example.com.",
+		"b.example.com.",
+		"a.example.com.",
+	}, targets)
+
+	https, err := resp.RecordsHTTPS()
+	require.ErrorIs(t, err, ErrNoData)
+	require.Nil(t, https)
+}
+
+func TestResponseRecordsHTTPS(t *testing.T) {
+	// Parse the records from their presentation format to make
+	// sure we also preserve the SvcParams used by callers.
+	rrs := []dns.RR{}
+	for _, line := range []string{
+		`example.com. 300 IN HTTPS 1 . alpn="h3,h2" ipv4hint="192.0.2.1"`,
+		`example.com. 300 IN HTTPS 0 svc.example.net.`,
+		`example.com. 300 IN A 192.0.2.1`,
+	} {
+		rr, err := dns.NewRR(line)
+		require.NoError(t, err)
+		rrs = append(rrs, rr)
+	}
+	resp := &Response{ValidRRs: rrs}
+
+	records, err := resp.RecordsHTTPS()
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	require.Equal(t, uint16(0), records[0].Priority)
+	require.Equal(t, "svc.example.net.", records[0].Target)
+	require.Equal(t, uint16(1), records[1].Priority)
+	require.Len(t, records[1].Value, 2)
+	require.Equal(t, "h3,h2", records[1].Value[0].String())
+	require.Equal(t, "192.0.2.1", records[1].Value[1].String())
+
+	svcb, err := resp.RecordsSVCB()
+	require.ErrorIs(t, err, ErrNoData)
+	require.Nil(t, svcb)
+}
+
+func TestResponseRecordsCAA(t *testing.T) {
+	newCAA := func(flag uint8, tag, value string) *dns.CAA {
+		return &dns.CAA{
+			Hdr: dns.RR_Header{
+				Name:   "example.com.",
+				Rrtype: dns.TypeCAA,
+				Class:  dns.ClassINET,
+			},
+			Flag:  flag,
+			Tag:   tag,
+			Value: value,
+		}
+	}
+	resp := &Response{
+		ValidRRs: []dns.RR{
+			newCAA(0, "issue", "letsencrypt.org"),
+			newCAA(0, "issuewild", "wild.example.net"),
+			newCAA(128, "tbs", "unknown"),
+			newCAA(0, "ISSUE", "ca.example.net; account=230123"),
+			newCAA(0, "issue", ";"),
+			newCAA(0, "iodef", "mailto:security@example.com"),
+		},
+	}
+
+	records, err := resp.RecordsCAA()
+	require.NoError(t, err)
+	require.Len(t, records, 6)
+	require.Equal(t, uint8(128), records[2].Flag)
+
+	issuers, err := resp.CAAIssuers()
+	require.NoError(t, err)
+	require.Equal(t, []string{"letsencrypt.org", "ca.example.net"}, issuers)
+	require.Contains(t, issuers, "letsencrypt.org")
+}
+
+func TestResponseRecordsCAANoData(t *testing.T) {
+	resp := &Response{ValidRRs: []dns.RR{}}
+
+	records, err := resp.RecordsCAA()
+	require.ErrorIs(t, err, ErrNoData)
+	require.Nil(t, records)
+
+	issuers, err := resp.CAAIssuers()
+	require.ErrorIs(t, err, ErrNoData)
+	require.Nil(t, issuers)
+}
+
+func TestResponseRecordsPTR(t *testing.T) {
+	newPTR := func(ptr string) dns.RR {
+		return &dns.PTR{
+			Hdr: dns.RR_Header{
+				Name:   "1.0.0.127.in-addr.arpa.",
+				Rrtype: dns.TypePTR,
+				Class:  dns.ClassINET,
+			},
+			Ptr: ptr,
+		}
+	}
+	resp := &Response{ValidRRs: []dns.RR{
+		newPTR("localhost."),
+		newPTR("localhost.localdomain."),
+	}}
+
+	names, err := resp.RecordsPTR()
+	require.NoError(t, err)
+	require.Equal(t, []string{"localhost.", "localhost.localdomain."}, names)
+}
+
+func TestResponseRecordsPTRNoData(t *testing.T) {
+	resp := &Response{ValidRRs: []dns.RR{}}
+	names, err := resp.RecordsPTR()
+	require.ErrorIs(t, err, ErrNoData)
+	require.Nil(t, names)
+}
+
+func TestResponseRecordsSRV(t *testing.T) {
+	newSRV := func(target string, priority, weight uint16) *dns.SRV {
+		return &dns.SRV{
+			Hdr: dns.RR_Header{
+				Name:   "_xmpp._tcp.example.com.",
+				Rrtype: dns.TypeSRV,
+				Class:  dns.ClassINET,
+			},
+			Priority: priority,
+			Weight:   weight,
+			Port:     5222,
+			Target:   target,
+		}
+	}
+
+	t.Run("ResponseOrder", func(t *testing.T) {
+		srv1 := newSRV("b.example.com.", 20, 0)
+		srv2 := newSRV("a.example.com.", 10, 0)
+		resp := &Response{ValidRRs: []dns.RR{srv1, srv2}}
+		records, err := resp.RecordsSRV()
+		require.NoError(t, err)
+		require.Equal(t, []*dns.SRV{srv1, srv2}, records)
+	})
+
+	t.Run("NoData", func(t *testing.T) {
+		resp := &Response{ValidRRs: []dns.RR{}}
+		records, err := resp.RecordsSRV()
+		require.ErrorIs(t, err, ErrNoData)
+		require.Nil(t, records)
+
+		records, err = resp.RecordsSRVSorted(nil)
+		require.ErrorIs(t, err, ErrNoData)
+		require.Nil(t, records)
+	})
+
+	t.Run("SortedByPriority", func(t *testing.T) {
+		resp := &Response{ValidRRs: []dns.RR{
+			newSRV("c.example.com.", 30, 10),
+			newSRV("a1.example.com.", 10, 50),
+			newSRV("b.example.com.", 20, 0),
+			newSRV("a2.example.com.", 10, 50),
+		}}
+		records, err := resp.RecordsSRVSorted(rand.New(rand.NewPCG(1, 2)))
+		require.NoError(t, err)
+		require.Len(t, records, 4)
+		require.Equal(t, uint16(10), records[0].Priority)
+		require.Equal(t, uint16(10), records[1].Priority)
+		require.ElementsMatch(t, []string{"a1.example.com.", "a2.example.com."},
+			[]string{records[0].Target, records[1].Target})
+		require.Equal(t, "b.example.com.", records[2].Target)
+		require.Equal(t, "c.example.com.", records[3].Target)
+	})
+
+	t.Run("Deterministic", func(t *testing.T) {
+		resp := &Response{ValidRRs: []dns.RR{
+			newSRV("a.example.com.", 10, 10),
+			newSRV("b.example.com.", 10, 20),
+			newSRV("c.example.com.", 10, 30),
+			newSRV("d.example.com.", 10, 40),
+		}}
+		first := runtimex.PanicOnError1(resp.RecordsSRVSorted(rand.New(rand.NewPCG(1, 2))))
+		second := runtimex.PanicOnError1(resp.RecordsSRVSorted(rand.New(rand.NewPCG(1, 2))))
+		require.Equal(t, first, second)
+	})
+
+	t.Run("ZeroWeightsKeepResponseOrder", func(t *testing.T) {
+		srv1 := newSRV("a.example.com.", 10, 0)
+		srv2 := newSRV("b.example.com.", 10, 0)
+		srv3 := newSRV("c.example.com.", 10, 0)
+		resp := &Response{ValidRRs: []dns.RR{srv1, srv2, srv3}}
+		records, err := resp.RecordsSRVSorted(nil)
+		require.NoError(t, err)
+		require.Equal(t, []*dns.SRV{srv1, srv2, srv3}, records)
+	})
+
+	t.Run("WeightedSelection", func(t *testing.T) {
+		// The weight-100 record comes after the weight-0 record in the
+		// response, yet it should be selected first most of the times, while
+		// the weight-0 record is selected first only when the random number
+		// is zero, since it is placed at the beginning of the list.
+		zero := newSRV("zero.example.com.", 10, 0)
+		heavy := newSRV("heavy.example.com.", 10, 100)
+		resp := &Response{ValidRRs: []dns.RR{heavy, zero}}
+		rng := rand.New(rand.NewPCG(1, 2))
+		var zeroFirst int
+		for range 1000 {
+			records := runtimex.PanicOnError1(resp.RecordsSRVSorted(rng))
+			require.Len(t, records, 2)
+			if records[0] == zero {
+				zeroFirst++
+			}
+		}
+		require.Greater(t, zeroFirst, 0)
+		require.Less(t, zeroFirst, 50)
+	})
+}
+
+func TestResponseRecordsTLSA(t *testing.T) {
+	tlsa := &dns.TLSA{
+		Hdr: dns.RR_Header{
+			Name:   "_443._tcp.example.com.",
+			Rrtype: dns.TypeTLSA,
+			Class:  dns.ClassINET,
+		},
+		Usage:        3,
+		Selector:     1,
+		MatchingType: 1,
+		Certificate:  "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
+	}
+	resp := &Response{
+		ValidRRs: []dns.RR{
+			&dns.CNAME{
+				Hdr: dns.RR_Header{
+					Name:   "_443._tcp.www.example.com.",
+					Rrtype: dns.TypeCNAME,
+					Class:  dns.ClassINET,
+				},
+				Target: "_443._tcp.example.com.",
+			},
+			tlsa,
+		},
+	}
+
+	records, err := resp.RecordsTLSA()
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	require.Same(t, tlsa, records[0])
+	require.Equal(t, uint8(3), records[0].Usage)
+	require.Equal(t, uint8(1), records[0].Selector)
+	require.Equal(t, uint8(1), records[0].MatchingType)
+	require.Equal(t, tlsa.Certificate, records[0].Certificate)
+}
+
+func TestResponseRecordsTLSANoData(t *testing.T) {
+	resp := &Response{ValidRRs: []dns.RR{}}
+	records, err := resp.RecordsTLSA()
+	require.ErrorIs(t, err, ErrNoData)
+	require.Nil(t, records)
+}
+
+func TestResponseRecordsNS(t *testing.T) {
+	newNS := func(ns string) *dns.NS {
+		return &dns.NS{
+			Hdr: dns.RR_Header{
+				Name:   "example.com.",
+				Rrtype: dns.TypeNS,
+				Class:  dns.ClassINET,
+			},
+			Ns: ns,
+		}
+	}
+
+	t.Run("Answer", func(t *testing.T) {
+		resp := &Response{
+			Response: &dns.Msg{Ns: []dns.RR{newNS("ns3.example.com.")}},
+			ValidRRs: []dns.RR{newNS("ns1.example.com."), newNS("ns2.example.com.")},
+		}
+		records, err := resp.RecordsNS()
+		require.NoError(t, err)
+		require.Equal(t, []string{"ns1.example.com.", "ns2.example.com."}, records)
+	})
+
+	t.Run("Referral", func(t *testing.T) {
+		resp := &Response{
+			Response:         &dns.Msg{Ns: []dns.RR{newNS("ns3.example.com.")}},
+			ValidRRs:         []dns.RR{},
+			IncludeAuthority: false,
+		}
+		records, err := resp.RecordsNS()
+		require.ErrorIs(t, err, ErrNoData)
+		require.Nil(t, records)
+
+		resp.IncludeAuthority = true
+		records, err = resp.RecordsNS()
+		require.NoError(t, err)
+		require.Equal(t, []string{"ns3.example.com."}, records)
+	})
+}
+
+func TestResponseRecordsSOA(t *testing.T) {
+	query := new(dns.Msg)
+	query.SetQuestion("nonexistent.example.com.", dns.TypeA)
+
+	msg := new(dns.Msg)
+	msg.SetRcode(query, dns.RcodeNameError)
+	soa := &dns.SOA{
+		Hdr: dns.RR_Header{
+			Name:   "example.com.",
+			Rrtype: dns.TypeSOA,
+			Class:  dns.ClassINET,
+			Ttl:    3600,
+		},
+		Ns:      "ns.example.com.",
+		Mbox:    "hostmaster.example.com.",
+		Serial:  2024010101,
+		Refresh: 7200,
+		Retry:   3600,
+		Expire:  1209600,
+		Minttl:  300,
+	}
+	msg.Ns = []dns.RR{soa}
+
+	_, err := ParseResponse(query, msg)
+	require.ErrorIs(t, err, ErrNoName)
+
+	resp := &Response{Query: query, Response: msg, ValidRRs: []dns.RR{}}
+	records, err := resp.RecordsSOA()
+	require.ErrorIs(t, err, ErrNoData)
+	require.Nil(t, records)
+
+	resp.IncludeAuthority = true
+	records, err = resp.RecordsSOA()
+	require.NoError(t, err)
+	require.Equal(t, []*dns.SOA{soa}, records)
+}
+
+func TestResponseRecordsUnknown(t *testing.T) {
+	// Build a response containing an unknown type and parse it from
+	// the wire to obtain the RFC3597 record as the library decodes it.
+	query := new(dns.Msg)
+	query.SetQuestion("example.com.", 65280)
+	msg := new(dns.Msg)
+	msg.SetReply(query)
+	unknown, err := dns.NewRR(`example.com. 3600 IN TYPE65280 \# 4 0a0b0c0d`)
+	require.NoError(t, err)
+	msg.Answer = []dns.RR{unknown, &dns.A{
+		Hdr: dns.RR_Header{
+			Name:   "example.com.",
+			Rrtype: dns.TypeA,
+			Class:  dns.ClassINET,
+		},
+		A: net.IPv4(127, 0, 0, 1),
+	}}
+	rawMsg, err := msg.Pack()
+	require.NoError(t, err)
+	parsed := new(dns.Msg)
+	require.NoError(t, parsed.Unpack(rawMsg))
+
+	resp, err := ParseResponse(query, parsed)
+	require.NoError(t, err)
+
+	records, err := resp.RecordsUnknown()
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	require.Equal(t, uint16(65280), records[0].Hdr.Rrtype)
+	require.Equal(t, "0a0b0c0d", records[0].Rdata)
+}
+
+func TestResponseRecordsUnknownNoData(t *testing.T) {
+	resp := &Response{ValidRRs: []dns.RR{}}
+	records, err := resp.RecordsUnknown()
+	require.ErrorIs(t, err, ErrNoData)
+	require.Nil(t, records)
+}
+
+func TestResponseRecordsByType(t *testing.T) {
+	sshfp1 := &dns.SSHFP{
+		Hdr: dns.RR_Header{
+			Name:   "example.com.",
+			Rrtype: dns.TypeSSHFP,
+			Class:  dns.ClassINET,
+		},
+		Algorithm:   4,
+		Type:        2,
+		FingerPrint: "0123456789abcdef",
+	}
+	sshfp2 := &dns.SSHFP{
+		Hdr: dns.RR_Header{
+			Name:   "example.com.",
+			Rrtype: dns.TypeSSHFP,
+			Class:  dns.ClassINET,
+		},
+		Algorithm:   1,
+		Type:        1,
+		FingerPrint: "fedcba9876543210",
+	}
+	a := &dns.A{
+		Hdr: dns.RR_Header{
+			Name:   "example.com.",
+			Rrtype: dns.TypeA,
+			Class:  dns.ClassINET,
+		},
+		A: net.IPv4(127, 0, 0, 1),
+	}
+	resp := &Response{ValidRRs: []dns.RR{sshfp1, a, sshfp2}}
+
+	require.Equal(t, []dns.RR{sshfp1, sshfp2}, resp.RecordsByType(dns.TypeSSHFP))
+	require.Equal(t, []dns.RR{a}, resp.RecordsByType(dns.TypeA))
+	require.Empty(t, resp.RecordsByType(dns.TypeTLSA))
+	require.NotNil(t, resp.RecordsByType(dns.TypeTLSA))
+}
+
+func TestResponseIndexAndLookup(t *testing.T) {
+	cname := &dns.CNAME{
+		Hdr: dns.RR_Header{
+			Name:   "WWW.Example.com.",
+			Rrtype: dns.TypeCNAME,
+			Class:  dns.ClassINET,
+		},
+		Target: "example.com.",
+	}
+	a1 := &dns.A{
+		Hdr: dns.RR_Header{
+			Name:   "example.com.",
+			Rrtype: dns.TypeA,
+			Class:  dns.ClassINET,
+		},
+		A: net.IPv4(127, 0, 0, 1),
+	}
+	a2 := &dns.A{
+		Hdr: dns.RR_Header{
+			Name:   "EXAMPLE.COM.",
+			Rrtype: dns.TypeA,
+			Class:  dns.ClassINET,
+		},
+		A: net.IPv4(127, 0, 0, 2),
+	}
+	aaaa := &dns.AAAA{
+		Hdr: dns.RR_Header{
+			Name:   "example.com.",
+			Rrtype: dns.TypeAAAA,
+			Class:  dns.ClassINET,
+		},
+		AAAA: net.ParseIP("::1"),
+	}
+	resp := &Response{ValidRRs: []dns.RR{cname, a1, aaaa, a2}}
+
+	t.Run("Index", func(t *testing.T) {
+		require.Equal(t, map[string][]dns.RR{
+			"www.example.com.": {cname},
+			"example.com.":     {a1, aaaa, a2},
+		}, resp.Index())
+	})
+
+	t.Run("Lookup", func(t *testing.T) {
+		require.Equal(t, []dns.RR{a1, a2}, resp.Lookup("Example.com", dns.TypeA))
+		require.Equal(t, []dns.RR{aaaa}, resp.Lookup("example.com.", dns.TypeAAAA))
+		require.Equal(t, []dns.RR{a1, aaaa, a2}, resp.Lookup("example.com.", dns.TypeANY))
+		require.Equal(t, []dns.RR{cname}, resp.Lookup("www.example.com.", dns.TypeCNAME))
+		require.Empty(t, resp.Lookup("www.example.com.", dns.TypeA))
+		require.Empty(t, resp.Lookup("example.org.", dns.TypeA))
+	})
+}
+
+func TestResponseTTLs(t *testing.T) {
+	resp := &Response{
+		ValidRRs: []dns.RR{
+			&dns.CNAME{
+				Hdr: dns.RR_Header{
+					Name:   "www.example.com.",
+					Rrtype: dns.TypeCNAME,
+					Class:  dns.ClassINET,
+					Ttl:    30,
+				},
+				Target: "example.com.",
+			},
+			&dns.A{
+				Hdr: dns.RR_Header{
+					Name:   "example.com.",
+					Rrtype: dns.TypeA,
+					Class:  dns.ClassINET,
+					Ttl:    300,
+				},
+				A: net.IPv4(127, 0, 0, 1),
+			},
+			&dns.A{
+				Hdr: dns.RR_Header{
+					Name:   "example.com.",
+					Rrtype: dns.TypeA,
+					Class:  dns.ClassINET,
+					Ttl:    60,
+				},
+				A: net.IPv4(127, 0, 0, 2),
+			},
+		},
+	}
+
+	ttls, err := resp.TTLs()
+	require.NoError(t, err)
+	require.Equal(t, []uint32{30, 300, 60}, ttls)
+
+	minTTL, err := resp.MinTTL()
+	require.NoError(t, err)
+	require.Equal(t, uint32(30), minTTL)
+}
+
+func TestResponseTTLsNoData(t *testing.T) {
+	resp := &Response{ValidRRs: []dns.RR{}}
+
+	ttls, err := resp.TTLs()
+	require.ErrorIs(t, err, ErrNoData)
+	require.Nil(t, ttls)
+
+	minTTL, err := resp.MinTTL()
+	require.ErrorIs(t, err, ErrNoData)
+	require.Zero(t, minTTL)
+}
+
+func TestResponseFilterMinTTL(t *testing.T) {
+	newA := func(ttl uint32, addr string) dns.RR {
+		return &dns.A{
+			Hdr: dns.RR_Header{
+				Name:   "example.com.",
+				Rrtype: dns.TypeA,
+				Class:  dns.ClassINET,
+				Ttl:    ttl,
+			},
+			A: net.ParseIP(addr),
+		}
+	}
+	rrs := []dns.RR{newA(300, "10.0.0.1"), newA(5, "10.0.0.2"), newA(60, "10.0.0.3")}
+	resp := &Response{
+		Query:            new(dns.Msg),
+		Response:         new(dns.Msg),
+		ValidRRs:         rrs,
+		IncludeAuthority: true,
+	}
+
+	t.Run("Filtered", func(t *testing.T) {
+		filtered := resp.FilterMinTTL(60)
+		require.NotSame(t, resp, filtered)
+		require.Same(t, resp.Query, filtered.Query)
+		require.Same(t, resp.Response, filtered.Response)
+		require.True(t, filtered.IncludeAuthority)
+		addrs, err := filtered.RecordsA()
+		require.NoError(t, err)
+		require.Equal(t, []string{"10.0.0.1", "10.0.0.3"}, addrs)
+
+		// Make sure the original response is unchanged
+		require.Len(t, resp.ValidRRs, 3)
+		require.Equal(t, rrs, resp.ValidRRs)
+	})
+
+	t.Run("AllPruned", func(t *testing.T) {
+		filtered := resp.FilterMinTTL(301)
+		require.NotNil(t, filtered.ValidRRs)
+		require.Empty(t, filtered.ValidRRs)
+		addrs, err := filtered.RecordsA()
+		require.ErrorIs(t, err, ErrNoData)
+		require.Nil(t, addrs)
+		require.Len(t, resp.ValidRRs, 3)
+	})
+}
+
+func TestResponseRecursionBits(t *testing.T) {
+	tests := []struct {
+		name string
+		ra   bool
+		rd   bool
+	}{
+		{"NeitherSet", false, false},
+		{"OnlyRA", true, false},
+		{"OnlyRD", false, true},
+		{"BothSet", true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := new(dns.Msg)
+			msg.RecursionAvailable = tt.ra
+			msg.RecursionDesired = tt.rd
+			resp := &Response{Response: msg}
+			require.Equal(t, tt.ra, resp.RecursionAvailable())
+			require.Equal(t, tt.rd, resp.RecursionDesiredEcho())
+		})
+	}
+}
+
+func TestResponseExceededAdvertisedSize(t *testing.T) {
+	newMsg := func(numAnswers int, truncated bool) *dns.Msg {
+		query := new(dns.Msg)
+		query.SetQuestion("example.com.", dns.TypeA)
+		msg := new(dns.Msg)
+		msg.SetReply(query)
+		msg.Truncated = truncated
+		for idx := 0; idx < numAnswers; idx++ {
+			msg.Answer = append(msg.Answer, &dns.A{
+				Hdr: dns.RR_Header{
+					Name:   "example.com.",
+					Rrtype: dns.TypeA,
+					Class:  dns.ClassINET,
+				},
+				A: net.IPv4(10, 0, 0, byte(idx)),
+			})
+		}
+		return msg
+	}
+
+	tests := []struct {
+		name       string
+		msg        *dns.Msg
+		advertised uint16
+		expected   bool
+	}{
+		{"SmallResponse", newMsg(1, false), 512, false},
+		{"LargeResponse", newMsg(100, false), 512, true},
+		{"LargeTruncatedResponse", newMsg(100, true), 512, false},
+		{"LargeResponseWithinSize", newMsg(100, false), QueryMaxResponseSizeTCP, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &Response{Response: tt.msg}
+			require.Equal(t, tt.expected, resp.ExceededAdvertisedSize(tt.advertised))
+		})
+	}
+
+	t.Run("CompressedWireBytes", func(t *testing.T) {
+		const name = "a-rather-long-label-to-benefit-from-compression.example.com."
+		query := new(dns.Msg)
+		query.SetQuestion(name, dns.TypeA)
+		msg := new(dns.Msg)
+		msg.SetReply(query)
+		msg.Compress = true
+		for idx := 0; idx < 50; idx++ {
+			msg.Answer = append(msg.Answer, &dns.A{
+				Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeA, Class: dns.ClassINET},
+				A:   net.IPv4(10, 0, 0, byte(idx)),
+			})
+		}
+		raw := runtimex.PanicOnError1(msg.Pack())
+
+		// Make sure the test is meaningful: the compressed message fits
+		// while the uncompressed message exceeds the advertised size.
+		require.LessOrEqual(t, len(raw), QueryMaxResponseSizeUDP)
+		parsed := new(dns.Msg)
+		require.NoError(t, parsed.Unpack(raw))
+		require.Greater(t, parsed.Len(), QueryMaxResponseSizeUDP)
+
+		resp, err := ParseResponseBytes(query, raw)
+		require.NoError(t, err)
+		require.False(t, resp.ExceededAdvertisedSize(QueryMaxResponseSizeUDP))
+
+		resp.Raw = nil
+		require.False(t, resp.ExceededAdvertisedSize(QueryMaxResponseSizeUDP))
+	})
+}
+
+func TestResponseClassifyReferral(t *testing.T) {
+	newNS := func(owner string) dns.RR {
+		return &dns.NS{
+			Hdr: dns.RR_Header{Name: owner, Rrtype: dns.TypeNS, Class: dns.ClassINET},
+			Ns:  "ns.example.com.",
+		}
+	}
+	newSOA := func() dns.RR {
+		return &dns.SOA{
+			Hdr: dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeSOA, Class: dns.ClassINET},
+			Ns:  "ns.example.com.",
+		}
+	}
+
+	tests := []struct {
+		name             string
+		modify           func(resp *dns.Msg)
+		qname            string
+		expectCandidate  bool
+		expectDelegates  bool
+		expectLame       bool
+		expectReferral   bool
+		expectDelegation bool
+	}{
+		{
+			name: "Delegation",
+			modify: func(resp *dns.Msg) {
+				resp.Ns = []dns.RR{newNS("example.com.")}
+			},
+			qname:            "www.example.com.",
+			expectCandidate:  true,
+			expectDelegates:  true,
+			expectLame:       true,
+			expectReferral:   true,
+			expectDelegation: true,
+		},
+
+		{
+			name: "DelegationWithRA",
+			modify: func(resp *dns.Msg) {
+				resp.RecursionAvailable = true
+				resp.Ns = []dns.RR{newNS("example.com.")}
+			},
+			qname:            "www.example.com.",
+			expectCandidate:  true,
+			expectDelegates:  true,
+			expectReferral:   true,
+			expectDelegation: true,
+		},
+
+		{
+			name: "UnrelatedNS",
+			modify: func(resp *dns.Msg) {
+				resp.RecursionAvailable = true
+				resp.Ns = []dns.RR{newNS("example.org.")}
+			},
+			qname:           "www.example.com.",
+			expectCandidate: true,
+		},
+
+		{
+			name: "UnrelatedNSWithoutQueryName",
+			modify: func(resp *dns.Msg) {
+				resp.RecursionAvailable = true
+				resp.Ns = []dns.RR{newNS("example.org.")}
+			},
+			qname:           "",
+			expectCandidate: true,
+			expectDelegates: true,
+			expectReferral:  true,
+		},
+
+		{
+			name: "NODATA",
+			modify: func(resp *dns.Msg) {
+				resp.RecursionAvailable = true
+				resp.Ns = []dns.RR{newNS("example.com."), newSOA()}
+			},
+			qname:           "www.example.com.",
+			expectCandidate: true,
+		},
+
+		{
+			name: "Authoritative",
+			modify: func(resp *dns.Msg) {
+				resp.Authoritative = true
+				resp.Ns = []dns.RR{newNS("example.com.")}
+			},
+			qname:           "www.example.com.",
+			expectDelegates: true,
+		},
+
+		{
+			name: "NXDOMAIN",
+			modify: func(resp *dns.Msg) {
+				resp.Rcode = dns.RcodeNameError
+			},
+			qname: "www.example.com.",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := new(dns.Msg)
+			query.SetQuestion("www.example.com.", dns.TypeA)
+			resp := new(dns.Msg)
+			resp.SetReply(query)
+			tt.modify(resp)
+
+			candidate, delegates := responseClassifyReferral(resp, tt.qname)
+			require.Equal(t, tt.expectCandidate, candidate)
+			require.Equal(t, tt.expectDelegates, delegates)
+			require.Equal(t, tt.expectLame, responseIsLameReferral(resp))
+			require.Equal(t, tt.expectReferral, responseIsReferral(resp, tt.qname))
+			if tt.qname != "" {
+				q0 := dns.Question{Name: tt.qname, Qtype: dns.TypeA, Qclass: dns.ClassINET}
+				require.Equal(t, tt.expectDelegation, responseIsDelegation(q0, resp))
+			}
+		})
+	}
+}
+
+func TestResponseStatus(t *testing.T) {
+	newAnswer := func() dns.RR {
+		return &dns.A{
+			Hdr: dns.RR_Header{
+				Name:   "example.com.",
+				Rrtype: dns.TypeA,
+				Class:  dns.ClassINET,
+			},
+			A: net.IPv4(127, 0, 0, 1),
+		}
+	}
+
+	tests := []struct {
+		name     string
+		modify   func(resp *Response)
+		expected ResponseStatus
+	}{
+		{
+			name: "Answered",
+			modify: func(resp *Response) {
+				resp.Response.Answer = []dns.RR{newAnswer()}
+				resp.ValidRRs = []dns.RR{newAnswer()}
+			},
+			expected: ResponseStatusAnswered,
+		},
+
+		{
+			name: "MissingMessage",
+			modify: func(resp *Response) {
+				resp.Response = nil
+			},
+			expected: ResponseStatusMalformed,
+		},
+
+		{
+			name: "NotAResponse",
+			modify: func(resp *Response) {
+				resp.Response.Response = false
+			},
+			expected: ResponseStatusMalformed,
+		},
+
+		{
+			name: "Truncated",
+			modify: func(resp *Response) {
+				resp.Response.Truncated = true
+			},
+			expected: ResponseStatusTruncated,
+		},
+
+		{
+			name: "NXDOMAIN",
+			modify: func(resp *Response) {
+				resp.Response.Rcode = dns.RcodeNameError
+			},
+			expected: ResponseStatusNXDOMAIN,
+		},
+
+		{
+			name: "ServerFailure",
+			modify: func(resp *Response) {
+				resp.Response.Rcode = dns.RcodeServerFailure
+			},
+			expected: ResponseStatusServerFailure,
+		},
+
+		{
+			name: "NotImplemented",
+			modify: func(resp *Response) {
+				resp.Response.Rcode = dns.RcodeNotImplemented
+			},
+			expected: ResponseStatusServerFailure,
+		},
+
+		{
+			name: "Refused",
+			modify: func(resp *Response) {
+				resp.Response.Rcode = dns.RcodeRefused
+			},
+			expected: ResponseStatusRefused,
+		},
+
+		{
+			name:     "NODATA",
+			modify:   func(resp *Response) {},
+			expected: ResponseStatusNODATA,
+		},
+
+		{
+			name: "Referral",
+			modify: func(resp *Response) {
+				resp.Response.Ns = []dns.RR{&dns.NS{
+					Hdr: dns.RR_Header{
+						Name:   "example.com.",
+						Rrtype: dns.TypeNS,
+						Class:  dns.ClassINET,
+					},
+					Ns: "ns.example.com.",
+				}}
+			},
+			expected: ResponseStatusReferral,
+		},
+
+		{
+			name: "LameReferral",
+			modify: func(resp *Response) {
+				resp.Response.RecursionAvailable = false
+			},
+			expected: ResponseStatusReferral,
+		},
+
+		{
+			name: "AuthoritativeNODATA",
+			modify: func(resp *Response) {
+				resp.Response.RecursionAvailable = false
+				resp.Response.Authoritative = true
+			},
+			expected: ResponseStatusNODATA,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := new(dns.Msg)
+			query.SetQuestion("example.com.", dns.TypeA)
+			msg := new(dns.Msg)
+			msg.SetReply(query)
+			msg.RecursionAvailable = true
+			resp := &Response{Query: query, Response: msg, ValidRRs: []dns.RR{}}
+
+			tt.modify(resp)
+
+			require.Equal(t, tt.expected, resp.Status())
+		})
+	}
+}
+
+func TestResponseStatusString(t *testing.T) {
+	tests := []struct {
+		status   ResponseStatus
+		expected string
+	}{
+		{ResponseStatusMalformed, "Malformed"},
+		{ResponseStatusAnswered, "Answered"},
+		{ResponseStatusNXDOMAIN, "NXDOMAIN"},
+		{ResponseStatusNODATA, "NODATA"},
+		{ResponseStatusReferral, "Referral"},
+		{ResponseStatusServerFailure, "ServerFailure"},
+		{ResponseStatusRefused, "Refused"},
+		{ResponseStatusTruncated, "Truncated"},
+		{ResponseStatus(100), "ResponseStatus(100)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expected, func(t *testing.T) {
+			require.Equal(t, tt.expected, tt.status.String())
+		})
+	}
+}
+
+func TestResponseCNAMETargetsMatchData(t *testing.T) {
+	newCNAME := func(name, target string) dns.RR {
+		return &dns.CNAME{
+			Hdr: dns.RR_Header{
+				Name:   name,
+				Rrtype: dns.TypeCNAME,
+				Class:  dns.ClassINET,
+			},
+			Target: target,
+		}
+	}
+	newA := func(name string) dns.RR {
+		return &dns.A{
+			Hdr: dns.RR_Header{
+				Name:   name,
+				Rrtype: dns.TypeA,
+				Class:  dns.ClassINET,
+			},
+			A: net.IPv4(127, 0, 0, 1),
+		}
+	}
+
+	tests := []struct {
+		name     string
+		rrs      []dns.RR
+		expected bool
+	}{
+		{
+			name:     "NoCNAME",
+			rrs:      []dns.RR{newA("www.example.com.")},
+			expected: true,
+		},
+
+		{
+			name: "DataAtTerminal",
+			rrs: []dns.RR{
+				newCNAME("www.example.com.", "a.example.net."),
+				newCNAME("a.example.net.", "b.example.org."),
+				newA("B.Example.ORG."),
+			},
+			expected: true,
+		},
+
+		{
+			name: "SignedCNAME",
+			rrs: []dns.RR{
+				newCNAME("www.example.com.", "a.example.net."),
+				&dns.RRSIG{
+					Hdr: dns.RR_Header{
+						Name:   "www.example.com.",
+						Rrtype: dns.TypeRRSIG,
+						Class:  dns.ClassINET,
+					},
+					TypeCovered: dns.TypeCNAME,
+				},
+				newA("a.example.net."),
+			},
+			expected: true,
+		},
+
+		{
+			name: "DataAtMidChain",
+			rrs: []dns.RR{
+				newCNAME("www.example.com.", "a.example.net."),
+				newCNAME("a.example.net.", "b.example.org."),
+				newA("a.example.net."),
+			},
+			expected: false,
+		},
+
+		{
+			name: "DataAtQueryName",
+			rrs: []dns.RR{
+				newCNAME("www.example.com.", "a.example.net."),
+				newA("www.example.com."),
+			},
+			expected: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := new(dns.Msg)
+			query.SetQuestion("www.example.com.", dns.TypeA)
+			resp := &Response{Query: query, ValidRRs: tt.rrs}
+			require.Equal(t, tt.expected, resp.CNAMETargetsMatchData())
+		})
+	}
+}
+
+func TestResponseCNAMETargetsMatchDataInvalidQuery(t *testing.T) {
+	resp := &Response{Query: new(dns.Msg)}
+	require.False(t, resp.CNAMETargetsMatchData())
+}
+
+func TestResponseCanonicalName(t *testing.T) {
+	newCNAME := func(name, target string) dns.RR {
+		return &dns.CNAME{
+			Hdr: dns.RR_Header{
+				Name:   name,
+				Rrtype: dns.TypeCNAME,
+				Class:  dns.ClassINET,
+			},
+			Target: target,
+		}
+	}
+	newA := func(name string) dns.RR {
+		return &dns.A{
+			Hdr: dns.RR_Header{
+				Name:   name,
+				Rrtype: dns.TypeA,
+				Class:  dns.ClassINET,
+			},
+			A: net.IPv4(127, 0, 0, 1),
+		}
+	}
+
+	tests := []struct {
+		name        string
+		query       *dns.Msg
+		rrs         []dns.RR
+		expected    string
+		expectedErr error
+	}{
+		{
+			name:     "NoCNAME",
+			rrs:      []dns.RR{newA("www.example.com.")},
+			expected: "www.example.com.",
+		},
+
+		{
+			name: "TwoHops",
+			rrs: []dns.RR{
+				newCNAME("www.example.com.", "a.example.net."),
+				newCNAME("a.example.net.", "B.Example.ORG."),
+				newA("b.example.org."),
+			},
+			expected: "b.example.org.",
+		},
+
+		{
+			name: "DNAME",
+			rrs: []dns.RR{
+				&dns.DNAME{
+					Hdr: dns.RR_Header{
+						Name:   "example.com.",
+						Rrtype: dns.TypeDNAME,
+						Class:  dns.ClassINET,
+					},
+					Target: "example.net.",
+				},
+				newA("www.example.net."),
+			},
+			expected: "www.example.net.",
+		},
+
+		{
+			name:        "NoData",
+			rrs:         []dns.RR{},
+			expectedErr: ErrNoData,
+		},
+
+		{
+			name: "Loop",
+			rrs: []dns.RR{
+				newCNAME("www.example.com.", "a.example.net."),
+				newCNAME("a.example.net.", "www.example.com."),
+			},
+			expectedErr: ErrCNAMELoop,
+		},
+
+		{
+			name:        "InvalidQuery",
+			query:       new(dns.Msg),
+			rrs:         []dns.RR{newA("www.example.com.")},
+			expectedErr: ErrInvalidQuery,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := tt.query
+			if query == nil {
+				query = new(dns.Msg)
+				query.SetQuestion("www.example.com.", dns.TypeA)
+			}
+			resp := &Response{Query: query, ValidRRs: tt.rrs}
+			name, err := resp.CanonicalName()
+			if tt.expectedErr != nil {
+				require.ErrorIs(t, err, tt.expectedErr)
+				require.Empty(t, name)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, name)
+		})
+	}
+}
+
+func TestResponseServerCookie(t *testing.T) {
+	newResponse := func(options ...dns.EDNS0) *Response {
+		msg := new(dns.Msg)
+		msg.SetEdns0(QueryMaxResponseSizeUDP, false)
+		msg.IsEdns0().Option = options
+		rawMsg, err := msg.Pack()
+		require.NoError(t, err)
+		parsed := new(dns.Msg)
+		require.NoError(t, parsed.Unpack(rawMsg))
+		return &Response{Response: parsed}
+	}
+
+	t.Run("Present", func(t *testing.T) {
+		resp := newResponse(&dns.EDNS0_COOKIE{
+			Code:   dns.EDNS0COOKIE,
+			Cookie: "0102030405060708a1a2a3a4a5a6a7a8",
+		})
+		cookie, ok := resp.ServerCookie()
+		require.True(t, ok)
+		require.Equal(t, []byte{
+			1, 2, 3, 4, 5, 6, 7, 8,
+			0xa1, 0xa2, 0xa3, 0xa4, 0xa5, 0xa6, 0xa7, 0xa8,
+		}, cookie)
+	})
+
+	t.Run("AbsentOption", func(t *testing.T) {
+		resp := newResponse(&dns.EDNS0_NSID{Code: dns.EDNS0NSID})
+		cookie, ok := resp.ServerCookie()
+		require.False(t, ok)
+		require.Nil(t, cookie)
+	})
+
+	t.Run("AbsentOPT", func(t *testing.T) {
+		resp := &Response{Response: new(dns.Msg)}
+		cookie, ok := resp.ServerCookie()
+		require.False(t, ok)
+		require.Nil(t, cookie)
+	})
+
+	t.Run("InvalidEncoding", func(t *testing.T) {
+		msg := new(dns.Msg)
+		msg.SetEdns0(QueryMaxResponseSizeUDP, false)
+		msg.IsEdns0().Option = []dns.EDNS0{&dns.EDNS0_COOKIE{Code: dns.EDNS0COOKIE, Cookie: "zz"}}
+		resp := &Response{Response: msg}
+		cookie, ok := resp.ServerCookie()
+		require.False(t, ok)
+		require.Nil(t, cookie)
+	})
+}
+
+func TestResponseNSID(t *testing.T) {
+	newResponse := func(options ...dns.EDNS0) *Response {
+		msg := new(dns.Msg)
+		msg.SetEdns0(QueryMaxResponseSizeUDP, false)
+		msg.IsEdns0().Option = options
+		rawMsg, err := msg.Pack()
+		require.NoError(t, err)
+		parsed := new(dns.Msg)
+		require.NoError(t, parsed.Unpack(rawMsg))
+		return &Response{Response: parsed}
+	}
+
+	t.Run("Present", func(t *testing.T) {
+		resp := newResponse(&dns.EDNS0_NSID{
+			Code: dns.EDNS0NSID,
+			Nsid: hex.EncodeToString([]byte("fra-1.example")),
+		})
+		nsid, ok := resp.NSID()
+		require.True(t, ok)
+		require.Equal(t, "fra-1.example", nsid)
+	})
+
+	t.Run("AbsentOption", func(t *testing.T) {
+		resp := newResponse(&dns.EDNS0_COOKIE{
+			Code:   dns.EDNS0COOKIE,
+			Cookie: "0102030405060708",
+		})
+		nsid, ok := resp.NSID()
+		require.False(t, ok)
+		require.Empty(t, nsid)
+	})
+
+	t.Run("AbsentOPT", func(t *testing.T) {
+		resp := &Response{Response: new(dns.Msg)}
+		nsid, ok := resp.NSID()
+		require.False(t, ok)
+		require.Empty(t, nsid)
+	})
+
+	t.Run("InvalidEncoding", func(t *testing.T) {
+		msg := new(dns.Msg)
+		msg.SetEdns0(QueryMaxResponseSizeUDP, false)
+		msg.IsEdns0().Option = []dns.EDNS0{&dns.EDNS0_NSID{Code: dns.EDNS0NSID, Nsid: "zz"}}
+		resp := &Response{Response: msg}
+		nsid, ok := resp.NSID()
+		require.False(t, ok)
+		require.Empty(t, nsid)
+	})
+}
+
+func TestDiffAddrs(t *testing.T) {
+	newResponse := func(addrs ...string) *Response {
+		resp := &Response{}
+		for _, addr := range addrs {
+			ip := net.ParseIP(addr)
+			if !strings.Contains(addr, ":") {
+				resp.ValidRRs = append(resp.ValidRRs, &dns.A{
+					Hdr: dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeA, Class: dns.ClassINET},
+					A:   ip,
+				})
+				continue
+			}
+			resp.ValidRRs = append(resp.ValidRRs, &dns.AAAA{
+				Hdr:  dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeAAAA, Class: dns.ClassINET},
+				AAAA: ip,
+			})
+		}
+		return resp
+	}
+	addrs := func(values ...string) []netip.Addr {
+		var out []netip.Addr
+		for _, value := range values {
+			out = append(out, netip.MustParseAddr(value))
+		}
+		return out
+	}
+
+	tests := []struct {
+		name         string
+		a            *Response
+		b            *Response
+		expectOnlyA  []netip.Addr
+		expectOnlyB  []netip.Addr
+		expectCommon []netip.Addr
+	}{
+		{
+			name:        "Disjoint",
+			a:           newResponse("10.0.0.1", "2001:db8::1"),
+			b:           newResponse("10.0.0.2"),
+			expectOnlyA: addrs("10.0.0.1", "2001:db8::1"),
+			expectOnlyB: addrs("10.0.0.2"),
+		},
+
+		{
+			name:         "Overlapping",
+			a:            newResponse("10.0.0.2", "10.0.0.1", "2001:db8::1"),
+			b:            newResponse("2001:db8::2", "10.0.0.1", "2001:db8::1"),
+			expectOnlyA:  addrs("10.0.0.2"),
+			expectOnlyB:  addrs("2001:db8::2"),
+			expectCommon: addrs("10.0.0.1", "2001:db8::1"),
+		},
+
+		{
+			name:         "Identical",
+			a:            newResponse("10.0.0.1", "10.0.0.1", "2001:db8::1"),
+			b:            newResponse("2001:db8::1", "10.0.0.1"),
+			expectCommon: addrs("10.0.0.1", "2001:db8::1"),
+		},
+
+		{
+			name:         "IPv4MappedIPv6",
+			a:            newResponse("10.0.0.1"),
+			b:            newResponse("::ffff:10.0.0.1"),
+			expectCommon: addrs("10.0.0.1"),
+		},
+
+		{
+			name:        "NilAndEmpty",
+			a:           nil,
+			b:           newResponse(),
+			expectOnlyA: nil,
+		},
+
+		{
+			name:        "NilResponse",
+			a:           newResponse("10.0.0.1"),
+			b:           nil,
+			expectOnlyA: addrs("10.0.0.1"),
+		},
+	}
+
+	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			resp := tt.makeResp(tt.query)
-			_, err := ParseResponse(tt.query, resp)
-			if tt.expected != nil {
-				require.ErrorIs(t, err, tt.expected)
-				return
-			}
-			require.NoError(t, err)
+			onlyA, onlyB, common := DiffAddrs(tt.a, tt.b)
+			require.Equal(t, tt.expectOnlyA, onlyA)
+			require.Equal(t, tt.expectOnlyB, onlyB)
+			require.Equal(t, tt.expectCommon, common)
 		})
 	}
 }
 
-func TestResponseRecordsA(t *testing.T) {
+func TestResponseKeepaliveTimeout(t *testing.T) {
+	newResponse := func(options ...dns.EDNS0) *Response {
+		msg := new(dns.Msg)
+		msg.SetEdns0(QueryMaxResponseSizeUDP, false)
+		msg.IsEdns0().Option = options
+		rawMsg, err := msg.Pack()
+		require.NoError(t, err)
+		parsed := new(dns.Msg)
+		require.NoError(t, parsed.Unpack(rawMsg))
+		return &Response{Response: parsed}
+	}
+
+	t.Run("Present", func(t *testing.T) {
+		resp := newResponse(&dns.EDNS0_TCP_KEEPALIVE{
+			Code:    dns.EDNS0TCPKEEPALIVE,
+			Timeout: 150,
+		})
+		timeout, ok := resp.KeepaliveTimeout()
+		require.True(t, ok)
+		require.Equal(t, 15*time.Second, timeout)
+	})
+
+	t.Run("AbsentOption", func(t *testing.T) {
+		resp := newResponse(&dns.EDNS0_NSID{Code: dns.EDNS0NSID})
+		timeout, ok := resp.KeepaliveTimeout()
+		require.False(t, ok)
+		require.Zero(t, timeout)
+	})
+
+	t.Run("AbsentOPT", func(t *testing.T) {
+		resp := &Response{Response: new(dns.Msg)}
+		timeout, ok := resp.KeepaliveTimeout()
+		require.False(t, ok)
+		require.Zero(t, timeout)
+	})
+}
+
+func TestResponseAddrs(t *testing.T) {
 	resp := &Response{
 		ValidRRs: []dns.RR{
-			&dns.A{
+			&dns.AAAA{
 				Hdr: dns.RR_Header{
 					Name:   "example.com.",
-					Rrtype: dns.TypeA,
+					Rrtype: dns.TypeAAAA,
 					Class:  dns.ClassINET,
 				},
-				A: net.IPv4(127, 0, 0, 1),
+				AAAA: net.ParseIP("2001:db8::1"),
+			},
+			&dns.CNAME{
+				Hdr: dns.RR_Header{
+					Name:   "example.com.",
+					Rrtype: dns.TypeCNAME,
+					Class:  dns.ClassINET,
+				},
+				Target: "example.net.",
 			},
 			&dns.A{
 				Hdr: dns.RR_Header{
@@ -476,26 +4195,80 @@ func TestResponseRecordsA(t *testing.T) {
 					Rrtype: dns.TypeAAAA,
 					Class:  dns.ClassINET,
 				},
-				AAAA: net.ParseIP("2001:db8::1"),
+				AAAA: net.ParseIP("2001:db8::2"),
 			},
 		},
 	}
 
-	addrs, err := resp.RecordsA()
-	require.NoError(t, err)
-	require.Equal(t, []string{"127.0.0.1", "8.8.8.8"}, addrs)
+	tests := []struct {
+		name   string
+		addrs  func() ([]net.IP, error)
+		expect []net.IP
+	}{
+		{
+			name:   "AddrsA",
+			addrs:  resp.AddrsA,
+			expect: []net.IP{net.IPv4(8, 8, 8, 8)},
+		},
+
+		{
+			name:   "AddrsAAAA",
+			addrs:  resp.AddrsAAAA,
+			expect: []net.IP{net.ParseIP("2001:db8::1"), net.ParseIP("2001:db8::2")},
+		},
+
+		{
+			name:  "Addrs",
+			addrs: resp.Addrs,
+			expect: []net.IP{
+				net.ParseIP("2001:db8::1"),
+				net.IPv4(8, 8, 8, 8),
+				net.ParseIP("2001:db8::2"),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addrs, err := tt.addrs()
+			require.NoError(t, err)
+			require.Equal(t, tt.expect, addrs)
+		})
+	}
 }
 
-func TestResponseRecordsANoData(t *testing.T) {
+func TestResponseAddrsNoData(t *testing.T) {
 	resp := &Response{ValidRRs: []dns.RR{}}
-	addrs, err := resp.RecordsA()
-	require.ErrorIs(t, err, ErrNoData)
-	require.Nil(t, addrs)
+	for _, addrs := range []func() ([]net.IP, error){
+		resp.AddrsA,
+		resp.AddrsAAAA,
+		resp.Addrs,
+	} {
+		values, err := addrs()
+		require.ErrorIs(t, err, ErrNoData)
+		require.Nil(t, values)
+	}
 }
 
-func TestResponseRecordsAAAA(t *testing.T) {
+func TestResponseAddrsNetip(t *testing.T) {
 	resp := &Response{
 		ValidRRs: []dns.RR{
+			&dns.A{
+				Hdr: dns.RR_Header{
+					Name:   "example.com.",
+					Rrtype: dns.TypeA,
+					Class:  dns.ClassINET,
+				},
+				A: net.IPv4(8, 8, 8, 8), // 16-byte representation
+			},
+			&dns.A{
+				Hdr: dns.RR_Header{
+					Name:   "example.com.",
+					Rrtype: dns.TypeA,
+					Class:  dns.ClassINET,
+				},
+				A: net.IPv4(8, 8, 4, 4).To4(), // 4-byte representation
+			},
 			&dns.AAAA{
 				Hdr: dns.RR_Header{
 					Name:   "example.com.",
@@ -510,61 +4283,420 @@ func TestResponseRecordsAAAA(t *testing.T) {
 					Rrtype: dns.TypeA,
 					Class:  dns.ClassINET,
 				},
-				A: net.IPv4(127, 0, 0, 1),
+				A: net.IP{1, 2, 3}, // malformed
 			},
 		},
 	}
 
-	addrs, err := resp.RecordsAAAA()
+	addrs, err := resp.AddrsNetip()
 	require.NoError(t, err)
-	require.Equal(t, []string{"2001:db8::1"}, addrs)
+	require.Equal(t, []netip.Addr{
+		netip.MustParseAddr("8.8.8.8"),
+		netip.MustParseAddr("8.8.4.4"),
+		netip.MustParseAddr("2001:db8::1"),
+	}, addrs)
+	require.True(t, addrs[0].Is4())
+	require.True(t, addrs[1].Is4())
+	require.True(t, addrs[2].Is6())
 }
 
-func TestResponseRecordsAAAANoData(t *testing.T) {
+func TestResponseAddrsNetipNoData(t *testing.T) {
 	resp := &Response{ValidRRs: []dns.RR{}}
-	addrs, err := resp.RecordsAAAA()
+	addrs, err := resp.AddrsNetip()
 	require.ErrorIs(t, err, ErrNoData)
 	require.Nil(t, addrs)
 }
 
-func TestResponseRecordsCNAME(t *testing.T) {
+func TestResponseAddrsInterleaved(t *testing.T) {
+	newA := func(addr string) dns.RR {
+		return &dns.A{
+			Hdr: dns.RR_Header{
+				Name:   "example.com.",
+				Rrtype: dns.TypeA,
+				Class:  dns.ClassINET,
+			},
+			A: net.ParseIP(addr),
+		}
+	}
+	newAAAA := func(addr string) dns.RR {
+		return &dns.AAAA{
+			Hdr: dns.RR_Header{
+				Name:   "example.com.",
+				Rrtype: dns.TypeAAAA,
+				Class:  dns.ClassINET,
+			},
+			AAAA: net.ParseIP(addr),
+		}
+	}
+
+	tests := []struct {
+		name   string
+		rrs    []dns.RR
+		expect []string
+	}{
+		{
+			name: "ThreeAAAAOneA",
+			rrs: []dns.RR{
+				newA("10.0.0.1"),
+				newAAAA("2001:db8::1"),
+				newAAAA("2001:db8::2"),
+				newAAAA("2001:db8::3"),
+			},
+			expect: []string{"2001:db8::1", "10.0.0.1", "2001:db8::2", "2001:db8::3"},
+		},
+
+		{
+			name: "OneAAAAThreeA",
+			rrs: []dns.RR{
+				newA("10.0.0.1"),
+				newA("10.0.0.2"),
+				newAAAA("2001:db8::1"),
+				newA("10.0.0.3"),
+			},
+			expect: []string{"2001:db8::1", "10.0.0.1", "10.0.0.2", "10.0.0.3"},
+		},
+
+		{
+			name:   "OnlyA",
+			rrs:    []dns.RR{newA("10.0.0.1"), newA("10.0.0.2")},
+			expect: []string{"10.0.0.1", "10.0.0.2"},
+		},
+
+		{
+			name:   "OnlyAAAA",
+			rrs:    []dns.RR{newAAAA("2001:db8::1")},
+			expect: []string{"2001:db8::1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &Response{ValidRRs: tt.rrs}
+			addrs, err := resp.AddrsInterleaved()
+			require.NoError(t, err)
+			var got []string
+			for _, addr := range addrs {
+				got = append(got, addr.String())
+			}
+			require.Equal(t, tt.expect, got)
+		})
+	}
+
+	t.Run("NoData", func(t *testing.T) {
+		resp := &Response{ValidRRs: []dns.RR{}}
+		addrs, err := resp.AddrsInterleaved()
+		require.ErrorIs(t, err, ErrNoData)
+		require.Nil(t, addrs)
+	})
+}
+
+func TestResponseContainsBogon(t *testing.T) {
+	newResponse := func(addrs ...string) *Response {
+		resp := &Response{}
+		for _, addr := range addrs {
+			ip := net.ParseIP(addr)
+			if !strings.Contains(addr, ":") {
+				resp.ValidRRs = append(resp.ValidRRs, &dns.A{
+					Hdr: dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeA, Class: dns.ClassINET},
+					A:   ip,
+				})
+				continue
+			}
+			resp.ValidRRs = append(resp.ValidRRs, &dns.AAAA{
+				Hdr:  dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeAAAA, Class: dns.ClassINET},
+				AAAA: ip,
+			})
+		}
+		return resp
+	}
+
+	tests := []struct {
+		name     string
+		resp     *Response
+		expected bool
+	}{
+		{"Loopback", newResponse("127.0.0.1"), true},
+		{"Private", newResponse("8.8.4.4", "10.0.0.1"), true},
+		{"IPv4Mapped", newResponse("::ffff:192.168.1.1"), true},
+		{"IPv6LinkLocal", newResponse("fe80::1"), true},
+		{"Public", newResponse("8.8.8.8", "2001:4860:4860::8888"), false},
+		{"NoAddrs", newResponse(), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.expected, tt.resp.ContainsBogon())
+		})
+	}
+
+	t.Run("ExtendedTable", func(t *testing.T) {
+		saved := BogonPrefixes
+		t.Cleanup(func() { BogonPrefixes = saved })
+		BogonPrefixes = append(slices.Clone(saved), netip.MustParsePrefix("8.8.8.0/24"))
+		require.True(t, newResponse("8.8.8.8").ContainsBogon())
+	})
+
+	t.Run("ContainsAddr", func(t *testing.T) {
+		resp := newResponse("8.8.8.8", "::ffff:1.2.3.4", "2001:4860:4860::8888")
+		require.True(t, resp.ContainsAddr(netip.MustParseAddr("8.8.8.8")))
+		require.True(t, resp.ContainsAddr(netip.MustParseAddr("1.2.3.4")))
+		require.True(t, resp.ContainsAddr(netip.MustParseAddr("::ffff:8.8.8.8")))
+		require.True(t, resp.ContainsAddr(netip.MustParseAddr("2001:4860:4860::8888")))
+		require.False(t, resp.ContainsAddr(netip.MustParseAddr("8.8.4.4")))
+	})
+}
+
+func TestResponseReachableAddrs(t *testing.T) {
+	newA := func(addr string) dns.RR {
+		return &dns.A{
+			Hdr: dns.RR_Header{
+				Name:   "example.com.",
+				Rrtype: dns.TypeA,
+				Class:  dns.ClassINET,
+			},
+			A: net.ParseIP(addr),
+		}
+	}
+	newAAAA := func(addr string) dns.RR {
+		return &dns.AAAA{
+			Hdr: dns.RR_Header{
+				Name:   "example.com.",
+				Rrtype: dns.TypeAAAA,
+				Class:  dns.ClassINET,
+			},
+			AAAA: net.ParseIP(addr),
+		}
+	}
 	resp := &Response{
 		ValidRRs: []dns.RR{
-			&dns.CNAME{
-				Hdr: dns.RR_Header{
-					Name:   "www.example.com.",
-					Rrtype: dns.TypeCNAME,
-					Class:  dns.ClassINET,
-				},
-				Target: "example.com.",
+			newAAAA("2001:db8::1"),
+			newA("93.184.216.34"),
+			newAAAA("fe80::1"),
+			newA("169.254.1.1"),
+			newA("127.0.0.1"),
+		},
+	}
+
+	tests := []struct {
+		name       string
+		ifaceAddrs []string
+		expected   []string
+	}{
+		{
+			name:       "IPv4Only",
+			ifaceAddrs: []string{"127.0.0.1", "192.168.1.10"},
+			expected:   []string{"93.184.216.34", "127.0.0.1"},
+		},
+
+		{
+			name:       "IPv6LinkLocalOnly",
+			ifaceAddrs: []string{"::1", "fe80::abcd"},
+			expected:   []string{"fe80::1"},
+		},
+
+		{
+			name:       "DualStack",
+			ifaceAddrs: []string{"192.168.1.10", "169.254.3.3", "2001:db8::2"},
+			expected:   []string{"2001:db8::1", "93.184.216.34", "169.254.1.1", "127.0.0.1"},
+		},
+
+		{
+			name:       "NoInterfaces",
+			ifaceAddrs: nil,
+			expected:   nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ifaceAddrs []net.IP
+			for _, addr := range tt.ifaceAddrs {
+				ifaceAddrs = append(ifaceAddrs, net.ParseIP(addr))
+			}
+
+			addrs, err := resp.ReachableAddrs(ifaceAddrs)
+			if tt.expected == nil {
+				require.ErrorIs(t, err, ErrNoData)
+				require.Nil(t, addrs)
+				return
+			}
+			require.NoError(t, err)
+
+			var got []string
+			for _, addr := range addrs {
+				got = append(got, addr.String())
+			}
+			require.Equal(t, tt.expected, got)
+		})
+	}
+}
+
+func TestResponseUnsolicitedRRSIGs(t *testing.T) {
+	newRRs := func(withRRSIG bool) []dns.RR {
+		rrs := []dns.RR{&dns.A{
+			Hdr: dns.RR_Header{
+				Name:   "example.com.",
+				Rrtype: dns.TypeA,
+				Class:  dns.ClassINET,
 			},
-			&dns.CNAME{
+			A: net.IPv4(127, 0, 0, 1),
+		}}
+		if withRRSIG {
+			rrs = append(rrs, &dns.RRSIG{
 				Hdr: dns.RR_Header{
 					Name:   "example.com.",
-					Rrtype: dns.TypeCNAME,
+					Rrtype: dns.TypeRRSIG,
 					Class:  dns.ClassINET,
 				},
-				Target: "example.net.",
+				TypeCovered: dns.TypeA,
+			})
+		}
+		return rrs
+	}
+	newQuery := func(edns, do bool) *dns.Msg {
+		msg := new(dns.Msg)
+		msg.SetQuestion("example.com.", dns.TypeA)
+		if edns {
+			msg.SetEdns0(QueryMaxResponseSizeUDP, do)
+		}
+		return msg
+	}
+
+	tests := []struct {
+		name     string
+		query    *dns.Msg
+		rrs      []dns.RR
+		expected bool
+	}{
+		{"NoEDNSWithRRSIG", newQuery(false, false), newRRs(true), true},
+		{"NoDOWithRRSIG", newQuery(true, false), newRRs(true), true},
+		{"NoDOWithoutRRSIG", newQuery(true, false), newRRs(false), false},
+		{"DOWithRRSIG", newQuery(true, true), newRRs(true), false},
+		{"MissingQuery", nil, newRRs(true), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &Response{Query: tt.query, ValidRRs: tt.rrs}
+			require.Equal(t, tt.expected, resp.UnsolicitedRRSIGs())
+		})
+	}
+}
+
+func TestResponseTrustLevel(t *testing.T) {
+	newA := func(name string) dns.RR {
+		return &dns.A{
+			Hdr: dns.RR_Header{
+				Name:   name,
+				Rrtype: dns.TypeA,
+				Class:  dns.ClassINET,
 			},
-			&dns.A{
-				Hdr: dns.RR_Header{
-					Name:   "example.net.",
-					Rrtype: dns.TypeA,
-					Class:  dns.ClassINET,
-				},
-				A: net.IPv4(127, 0, 0, 1),
+			A: net.IPv4(127, 0, 0, 1),
+		}
+	}
+	newNS := func() dns.RR {
+		return &dns.NS{
+			Hdr: dns.RR_Header{
+				Name:   "example.com.",
+				Rrtype: dns.TypeNS,
+				Class:  dns.ClassINET,
+			},
+			Ns: "ns.example.com.",
+		}
+	}
+
+	tests := []struct {
+		name     string
+		modify   func(resp *Response)
+		expected TrustLevel
+	}{
+		{
+			name: "MissingMessage",
+			modify: func(resp *Response) {
+				resp.Response = nil
+			},
+			expected: TrustLevelNone,
+		},
+
+		{
+			name: "OnlyOPT",
+			modify: func(resp *Response) {
+				resp.Response.SetEdns0(QueryMaxResponseSizeUDP, false)
+			},
+			expected: TrustLevelNone,
+		},
+
+		{
+			name: "Additional",
+			modify: func(resp *Response) {
+				resp.Response.SetEdns0(QueryMaxResponseSizeUDP, false)
+				resp.Response.Extra = append(resp.Response.Extra, newA("ns.example.com."))
+			},
+			expected: TrustLevelAdditional,
+		},
+
+		{
+			name: "NonauthAuthority",
+			modify: func(resp *Response) {
+				resp.Response.Ns = []dns.RR{newNS()}
+			},
+			expected: TrustLevelNonauthAuthority,
+		},
+
+		{
+			name: "AuthAuthority",
+			modify: func(resp *Response) {
+				resp.Response.Authoritative = true
+				resp.Response.Ns = []dns.RR{newNS()}
+			},
+			expected: TrustLevelAuthAuthority,
+		},
+
+		{
+			name: "NonauthAnswer",
+			modify: func(resp *Response) {
+				resp.Response.Ns = []dns.RR{newNS()}
+				resp.ValidRRs = []dns.RR{newA("example.com.")}
+			},
+			expected: TrustLevelNonauthAnswer,
+		},
+
+		{
+			name: "AuthAnswer",
+			modify: func(resp *Response) {
+				resp.Response.Authoritative = true
+				resp.ValidRRs = []dns.RR{newA("example.com.")}
 			},
+			expected: TrustLevelAuthAnswer,
 		},
 	}
 
-	cnames, err := resp.RecordsCNAME()
-	require.NoError(t, err)
-	require.Equal(t, []string{"example.com.", "example.net."}, cnames)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &Response{Response: new(dns.Msg)}
+			tt.modify(resp)
+			require.Equal(t, tt.expected, resp.TrustLevel())
+		})
+	}
 }
 
-func TestResponseRecordsCNAMENoData(t *testing.T) {
-	resp := &Response{ValidRRs: []dns.RR{}}
-	cnames, err := resp.RecordsCNAME()
-	require.ErrorIs(t, err, ErrNoData)
-	require.Nil(t, cnames)
+func TestTrustLevelString(t *testing.T) {
+	tests := []struct {
+		level    TrustLevel
+		expected string
+	}{
+		{TrustLevelNone, "None"},
+		{TrustLevelAdditional, "Additional"},
+		{TrustLevelNonauthAuthority, "NonauthAuthority"},
+		{TrustLevelNonauthAnswer, "NonauthAnswer"},
+		{TrustLevelAuthAuthority, "AuthAuthority"},
+		{TrustLevelAuthAnswer, "AuthAnswer"},
+		{TrustLevel(100), "TrustLevel(100)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expected, func(t *testing.T) {
+			require.Equal(t, tt.expected, tt.level.String())
+		})
+	}
 }
@@ -0,0 +1,128 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnscodec
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/miekg/dns"
+)
+
+// ErrInvalidTCPMessage indicates that a length-prefixed DNS message is invalid.
+var ErrInvalidTCPMessage = errors.New("invalid length-prefixed DNS message")
+
+// NewTCPMessage returns the query serialized for DNS-over-TCP or DNS-over-TLS.
+//
+// As required by RFC1035 section 4.2.2, the packed query is prefixed
+// by its length encoded as a two-byte big-endian integer.
+//
+// This method returns [ErrInvalidTCPMessage] if the packed query does
+// not fit into the two-byte length prefix.
+func (q *Query) NewTCPMessage() ([]byte, error) {
+	rawQuery, err := q.Pack()
+	if err != nil {
+		return nil, err
+	}
+	if len(rawQuery) > math.MaxUint16 {
+		return nil, ErrInvalidTCPMessage
+	}
+	rawMsg := make([]byte, 2, 2+len(rawQuery))
+	binary.BigEndian.PutUint16(rawMsg, uint16(len(rawQuery)))
+	return append(rawMsg, rawQuery...), nil
+}
+
+// ReadTCPMessage reads a length-prefixed DNS message from the given reader.
+//
+// This function reads the two-byte big-endian length prefix and then
+// exactly that many bytes, returning the message without the prefix.
+//
+// This function returns [io.EOF] if the reader is at EOF before reading
+// the length prefix, [io.ErrUnexpectedEOF] if the reader returns EOF
+// in the middle of the message, and [ErrInvalidTCPMessage] if the
+// length prefix is zero.
+func ReadTCPMessage(r io.Reader) ([]byte, error) {
+	// 1. read the length prefix
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	length := binary.BigEndian.Uint16(header)
+	if length == 0 {
+		return nil, ErrInvalidTCPMessage
+	}
+
+	// 2. read the message body
+	rawMsg := make([]byte, length)
+	if _, err := io.ReadFull(r, rawMsg); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return rawMsg, nil
+}
+
+// ResponseReader reads length-prefixed DNS messages from a stream.
+//
+// Use it to read the responses to pipelined queries sent over a single
+// DNS-over-TCP or DNS-over-TLS connection, and match each response to
+// its query using the message ID. Construct using [NewResponseReader].
+type ResponseReader struct {
+	r io.Reader
+}
+
+// NewResponseReader returns a new [*ResponseReader] reading from r.
+func NewResponseReader(r io.Reader) *ResponseReader {
+	return &ResponseReader{r: r}
+}
+
+// Next reads and unpacks the next message from the stream.
+//
+// This method uses [ReadTCPMessage], so a message is read correctly even
+// when the length prefix or the message body spans several reads, and
+// returns the same errors, including [io.EOF] at the end of the stream.
+// This method returns [ErrCannotUnmarshalMessage] when the message cannot
+// be unpacked, in which case the following messages may still be read.
+//
+// The returned message is not validated: use [ParseResponse] to validate
+// it against the matching query message.
+func (rr *ResponseReader) Next() (*dns.Msg, error) {
+	rawMsg, err := ReadTCPMessage(rr.r)
+	if err != nil {
+		return nil, err
+	}
+	msg := new(dns.Msg)
+	if err := responseRecoverPanic(func() error { return msg.Unpack(rawMsg) }); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrCannotUnmarshalMessage, err.Error())
+	}
+	return msg, nil
+}
+
+// MatchResponse returns the query message to which resp is a response.
+//
+// Use this function to correlate responses to pipelined queries, which
+// may arrive out of order. A query matches when [ValidateResponseForQuery]
+// accepts the response for it, so queries with the same ID are still
+// disambiguated by their question (e.g., by the query type).
+//
+// When the response matches a query but is truncated, this function
+// returns BOTH the matching query and [ErrTruncatedResponse], such that
+// the caller knows which query to retry (e.g., using another transport).
+// This function returns nil and an error wrapping [ErrInvalidResponse]
+// if no query matches the response.
+func MatchResponse(queries []*dns.Msg, resp *dns.Msg) (*dns.Msg, error) {
+	for _, query := range queries {
+		_, err := ValidateResponseForQuery(query, resp)
+		switch {
+		case err == nil:
+			return query, nil
+		case errors.Is(err, ErrTruncatedResponse):
+			return query, err
+		}
+	}
+	return nil, fmt.Errorf("%w: no matching query", ErrInvalidResponse)
+}
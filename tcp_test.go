@@ -0,0 +1,246 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnscodec
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"testing/iotest"
+
+	"github.com/bassosimone/runtimex"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueryNewTCPMessage(t *testing.T) {
+	query := NewQuery("www.example.com", dns.TypeA)
+
+	rawMsg, err := query.NewTCPMessage()
+	require.NoError(t, err)
+	require.True(t, len(rawMsg) > 2)
+	require.Equal(t, len(rawMsg)-2, int(binary.BigEndian.Uint16(rawMsg)))
+
+	msg := new(dns.Msg)
+	require.NoError(t, msg.Unpack(rawMsg[2:]))
+	require.Equal(t, query.ID, msg.Id)
+	require.Equal(t, "www.example.com.", msg.Question[0].Name)
+}
+
+func TestQueryNewTCPMessageRoundTrip(t *testing.T) {
+	query := NewQuery("www.example.com", dns.TypeAAAA)
+	rawMsg := runtimex.PanicOnError1(query.NewTCPMessage())
+
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	go func() {
+		// Note: write twice to make sure the reader consumes exactly
+		// one message and leaves the following one untouched.
+		client.Write(rawMsg)
+		client.Write(rawMsg)
+	}()
+
+	for range 2 {
+		rawQuery, err := ReadTCPMessage(server)
+		require.NoError(t, err)
+		require.Equal(t, rawMsg[2:], rawQuery)
+	}
+}
+
+func TestReadTCPMessage(t *testing.T) {
+	tests := []struct {
+		name        string
+		input       []byte
+		expected    []byte
+		expectedErr error
+	}{
+		{
+			name:     "ValidMessage",
+			input:    []byte{0, 3, 'a', 'b', 'c'},
+			expected: []byte{'a', 'b', 'c'},
+		},
+
+		{
+			name:        "EmptyReader",
+			input:       []byte{},
+			expectedErr: io.EOF,
+		},
+
+		{
+			name:        "ShortLengthPrefix",
+			input:       []byte{0},
+			expectedErr: io.ErrUnexpectedEOF,
+		},
+
+		{
+			name:        "ShortBody",
+			input:       []byte{0, 3, 'a'},
+			expectedErr: io.ErrUnexpectedEOF,
+		},
+
+		{
+			name:        "MissingBody",
+			input:       []byte{0, 3},
+			expectedErr: io.ErrUnexpectedEOF,
+		},
+
+		{
+			name:        "ZeroLength",
+			input:       []byte{0, 0},
+			expectedErr: ErrInvalidTCPMessage,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rawMsg, err := ReadTCPMessage(bytes.NewReader(tt.input))
+			if tt.expectedErr != nil {
+				require.ErrorIs(t, err, tt.expectedErr)
+				require.Nil(t, rawMsg)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, rawMsg)
+		})
+	}
+}
+
+func TestResponseReader(t *testing.T) {
+	frame := func(msg *dns.Msg) []byte {
+		rawMsg := runtimex.PanicOnError1(msg.Pack())
+		out := binary.BigEndian.AppendUint16(nil, uint16(len(rawMsg)))
+		return append(out, rawMsg...)
+	}
+	newResponse := func(id uint16, qtype uint16) *dns.Msg {
+		query := new(dns.Msg)
+		query.SetQuestion("www.example.com.", qtype)
+		query.Id = id
+		resp := new(dns.Msg)
+		resp.SetReply(query)
+		return resp
+	}
+
+	t.Run("TwoMessages", func(t *testing.T) {
+		var stream []byte
+		stream = append(stream, frame(newResponse(1, dns.TypeA))...)
+		stream = append(stream, frame(newResponse(2, dns.TypeAAAA))...)
+
+		// Note: reading one byte at a time ensures that we handle
+		// the length prefix and the body spanning several reads.
+		reader := NewResponseReader(iotest.OneByteReader(bytes.NewReader(stream)))
+
+		msg, err := reader.Next()
+		require.NoError(t, err)
+		require.Equal(t, uint16(1), msg.Id)
+		require.Equal(t, dns.TypeA, msg.Question[0].Qtype)
+
+		msg, err = reader.Next()
+		require.NoError(t, err)
+		require.Equal(t, uint16(2), msg.Id)
+		require.Equal(t, dns.TypeAAAA, msg.Question[0].Qtype)
+
+		msg, err = reader.Next()
+		require.ErrorIs(t, err, io.EOF)
+		require.Nil(t, msg)
+	})
+
+	t.Run("InvalidMessage", func(t *testing.T) {
+		var stream []byte
+		stream = append(stream, 0, 3, 1, 2, 3)
+		stream = append(stream, frame(newResponse(3, dns.TypeA))...)
+		reader := NewResponseReader(bytes.NewReader(stream))
+
+		msg, err := reader.Next()
+		require.ErrorIs(t, err, ErrCannotUnmarshalMessage)
+		require.Nil(t, msg)
+
+		msg, err = reader.Next()
+		require.NoError(t, err)
+		require.Equal(t, uint16(3), msg.Id)
+	})
+
+	t.Run("TruncatedStream", func(t *testing.T) {
+		stream := frame(newResponse(4, dns.TypeA))
+		reader := NewResponseReader(bytes.NewReader(stream[:len(stream)-1]))
+
+		msg, err := reader.Next()
+		require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+		require.Nil(t, msg)
+	})
+}
+
+func TestMatchResponse(t *testing.T) {
+	newQuery := func(id uint16, qtype uint16) *dns.Msg {
+		query := new(dns.Msg)
+		query.SetQuestion("www.example.com.", qtype)
+		query.Id = id
+		return query
+	}
+	queryA := newQuery(1, dns.TypeA)
+	queryAAAA := newQuery(1, dns.TypeAAAA)
+	queryMX := newQuery(2, dns.TypeMX)
+	queries := []*dns.Msg{queryA, queryAAAA, queryMX}
+
+	tests := []struct {
+		name        string
+		resp        func() *dns.Msg
+		expected    *dns.Msg
+		expectedErr error
+	}{
+		{
+			name: "SameIDDisambiguatedByType",
+			resp: func() *dns.Msg {
+				return new(dns.Msg).SetReply(queryAAAA)
+			},
+			expected: queryAAAA,
+		},
+
+		{
+			name: "OutOfOrder",
+			resp: func() *dns.Msg {
+				return new(dns.Msg).SetReply(queryMX)
+			},
+			expected: queryMX,
+		},
+
+		{
+			name: "NoMatchingQuery",
+			resp: func() *dns.Msg {
+				return new(dns.Msg).SetReply(newQuery(1, dns.TypeTXT))
+			},
+			expectedErr: ErrInvalidResponse,
+		},
+
+		{
+			name: "Truncated",
+			resp: func() *dns.Msg {
+				resp := new(dns.Msg).SetReply(queryA)
+				resp.Truncated = true
+				return resp
+			},
+			expected:    queryA,
+			expectedErr: ErrTruncatedResponse,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, err := MatchResponse(queries, tt.resp())
+			if tt.expectedErr != nil {
+				require.ErrorIs(t, err, tt.expectedErr)
+			} else {
+				require.NoError(t, err)
+			}
+			if tt.expected == nil {
+				require.Nil(t, query)
+				return
+			}
+			require.NotNil(t, query)
+			require.Same(t, tt.expected, query)
+		})
+	}
+}
@@ -0,0 +1,76 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnscodec
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/miekg/dns"
+)
+
+// ErrIncompleteXFR indicates that a zone transfer is not bracketed by
+// matching opening and closing SOA records (RFC5936 section 2.2).
+var ErrIncompleteXFR = errors.New("incomplete DNS zone transfer")
+
+// ParseXFR returns a [*Response] given an AXFR or IXFR query message and
+// the response messages carrying the zone transfer, or an error.
+//
+// Each response message is validated against the query message using
+// [ValidateResponseForQuery] and [ResponseErrorFromRCODE]. Because RFC5936
+// section 2.2.1 allows the messages following the first one to have an
+// empty question section, we only validate their question when present.
+//
+// The valid RRs of the returned [*Response] contain the answer RRs of all
+// the messages in order, including the opening and closing SOA records. The
+// returned [*Response] points to the first response message.
+//
+// This function returns [ErrIncompleteXFR] if there are no response messages,
+// if the first answer RR is not a SOA for the queried zone, or if the last
+// answer RR is not a SOA with the same serial. As a special case, an IXFR
+// consisting of a single SOA record, meaning that the client is up to date
+// (RFC1995 section 2), is complete.
+func ParseXFR(query *dns.Msg, msgs []*dns.Msg) (*Response, error) {
+	// 1. validate each response message and collect the answer RRs
+	if len(msgs) < 1 {
+		return nil, fmt.Errorf("%w: no response messages", ErrIncompleteXFR)
+	}
+	var (
+		q0   dns.Question
+		rrs  []dns.RR
+		resp = msgs[0]
+	)
+	for idx, msg := range msgs {
+		if idx > 0 && len(msg.Question) == 0 && len(query.Question) > 0 {
+			envelope := *msg
+			envelope.Question = query.Question
+			msg = &envelope
+		}
+		qx, err := ValidateResponseForQuery(query, msg)
+		if err != nil {
+			return nil, err
+		}
+		if err := ResponseErrorFromRCODE(msg); err != nil {
+			return nil, err
+		}
+		q0 = qx
+		rrs = append(rrs, msg.Answer...)
+	}
+
+	// 2. make sure the opening and closing SOA bracket the stream
+	if len(rrs) < 1 {
+		return nil, fmt.Errorf("%w: no answer RRs", ErrIncompleteXFR)
+	}
+	first, ok := rrs[0].(*dns.SOA)
+	if !ok || responseCanonicalName(first.Hdr.Name) != responseCanonicalName(q0.Name) {
+		return nil, fmt.Errorf("%w: missing opening SOA", ErrIncompleteXFR)
+	}
+	if len(rrs) == 1 && q0.Qtype == dns.TypeIXFR {
+		return &Response{Query: query, Response: resp, ValidRRs: rrs}, nil
+	}
+	last, ok := rrs[len(rrs)-1].(*dns.SOA)
+	if len(rrs) < 2 || !ok || last.Serial != first.Serial {
+		return nil, fmt.Errorf("%w: missing closing SOA", ErrIncompleteXFR)
+	}
+	return &Response{Query: query, Response: resp, ValidRRs: rrs}, nil
+}
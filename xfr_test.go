@@ -0,0 +1,114 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnscodec
+
+import (
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseXFR(t *testing.T) {
+	newSOA := func(serial uint32) *dns.SOA {
+		return &dns.SOA{
+			Hdr: dns.RR_Header{
+				Name:   "example.com.",
+				Rrtype: dns.TypeSOA,
+				Class:  dns.ClassINET,
+			},
+			Ns:     "ns.example.com.",
+			Mbox:   "admin.example.com.",
+			Serial: serial,
+		}
+	}
+	newA := func(name string) *dns.A {
+		return &dns.A{
+			Hdr: dns.RR_Header{
+				Name:   name,
+				Rrtype: dns.TypeA,
+				Class:  dns.ClassINET,
+			},
+			A: net.IPv4(127, 0, 0, 1),
+		}
+	}
+	newQuery := func(qtype uint16) *dns.Msg {
+		query := new(dns.Msg)
+		query.SetQuestion("example.com.", qtype)
+		return query
+	}
+	newEnvelope := func(query *dns.Msg, withQuestion bool, answer ...dns.RR) *dns.Msg {
+		msg := new(dns.Msg)
+		msg.SetReply(query)
+		msg.Authoritative = true
+		if !withQuestion {
+			msg.Question = nil
+		}
+		msg.Answer = answer
+		return msg
+	}
+	soa := newSOA(2024010101)
+	www := newA("www.example.com.")
+	mail := newA("mail.example.com.")
+
+	t.Run("TwoEnvelopesAXFR", func(t *testing.T) {
+		query := newQuery(dns.TypeAXFR)
+		msgs := []*dns.Msg{
+			newEnvelope(query, true, soa, www),
+			newEnvelope(query, false, mail, newSOA(2024010101)),
+		}
+		resp, err := ParseXFR(query, msgs)
+		require.NoError(t, err)
+		require.Same(t, msgs[0], resp.Response)
+		require.Same(t, query, resp.Query)
+		require.Len(t, resp.ValidRRs, 4)
+		require.Same(t, soa, resp.ValidRRs[0])
+		require.Same(t, www, resp.ValidRRs[1])
+		require.Same(t, mail, resp.ValidRRs[2])
+	})
+
+	t.Run("UpToDateIXFR", func(t *testing.T) {
+		query := newQuery(dns.TypeIXFR)
+		resp, err := ParseXFR(query, []*dns.Msg{newEnvelope(query, true, soa)})
+		require.NoError(t, err)
+		require.Len(t, resp.ValidRRs, 1)
+	})
+
+	t.Run("Failures", func(t *testing.T) {
+		query := newQuery(dns.TypeAXFR)
+		wrongID := newEnvelope(query, true, www, soa)
+		wrongID.Id++
+		refused := newEnvelope(query, true)
+		refused.Rcode = dns.RcodeRefused
+
+		tests := []struct {
+			name     string
+			msgs     []*dns.Msg
+			expected error
+		}{
+			{"NoMessages", nil, ErrIncompleteXFR},
+			{"NoAnswers", []*dns.Msg{newEnvelope(query, true)}, ErrIncompleteXFR},
+			{"MissingOpeningSOA", []*dns.Msg{newEnvelope(query, true, www, soa)}, ErrIncompleteXFR},
+			{"ForeignOpeningSOA", []*dns.Msg{newEnvelope(query, true, &dns.SOA{
+				Hdr: dns.RR_Header{Name: "example.org.", Rrtype: dns.TypeSOA, Class: dns.ClassINET},
+			}, www, soa)}, ErrIncompleteXFR},
+			{"MissingClosingSOA", []*dns.Msg{
+				newEnvelope(query, true, soa, www),
+				newEnvelope(query, false, mail),
+			}, ErrIncompleteXFR},
+			{"SingleSOA", []*dns.Msg{newEnvelope(query, true, soa)}, ErrIncompleteXFR},
+			{"SerialMismatch", []*dns.Msg{newEnvelope(query, true, soa, www, newSOA(1))}, ErrIncompleteXFR},
+			{"WrongID", []*dns.Msg{newEnvelope(query, true, soa), wrongID}, ErrInvalidResponse},
+			{"Refused", []*dns.Msg{refused}, ErrServerMisbehaving},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				resp, err := ParseXFR(query, tt.msgs)
+				require.ErrorIs(t, err, tt.expected)
+				require.Nil(t, resp)
+			})
+		}
+	})
+}